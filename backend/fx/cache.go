@@ -0,0 +1,103 @@
+package fx
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// maxCacheEntries bounds the memory a cache can use. A full cache is
+// emptied rather than evicting entries one by one.
+const maxCacheEntries = 10000
+
+// Cache remembers the rates another provider returns. A rate fetched after
+// its day was over doesn't change, so it is kept until the cache fills up;
+// one fetched on the day itself (or for a later day) may have been
+// published since, so it is refetched after the TTL.
+//
+// Concurrent misses for the same rate share a single lookup, so a burst of
+// expenses in one currency asks the provider once.
+type Cache struct {
+	provider Provider
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[cacheKey]cacheEntry
+	pending singleflight.Group
+}
+
+type cacheKey struct {
+	base, quote, day string
+}
+
+type cacheEntry struct {
+	rate    float64
+	fetched time.Time
+}
+
+// NewCache wraps a provider with a cache
+func NewCache(provider Provider, ttl time.Duration) *Cache {
+	return &Cache{
+		provider: provider,
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  make(map[cacheKey]cacheEntry),
+	}
+}
+
+// Rate returns a cached rate, asking the wrapped provider on a miss.
+// Failed lookups aren't cached.
+func (c *Cache) Rate(ctx context.Context, base, quote string, date time.Time) (float64, error) {
+	key := cacheKey{strings.ToUpper(base), strings.ToUpper(quote), day(date)}
+	if rate, ok := c.cached(key); ok {
+		return rate, nil
+	}
+
+	// The shared lookup outlives any one caller giving up on it; the
+	// provider's own timeout still bounds it
+	lookup := c.pending.DoChan(key.base+"/"+key.quote+"/"+key.day, func() (interface{}, error) {
+		if rate, ok := c.cached(key); ok {
+			return rate, nil
+		}
+
+		now := c.now()
+		rate, err := c.provider.Rate(context.WithoutCancel(ctx), base, quote, date)
+		if err != nil {
+			return 0.0, err
+		}
+
+		c.mu.Lock()
+		if len(c.entries) >= maxCacheEntries {
+			c.entries = make(map[cacheKey]cacheEntry)
+		}
+		c.entries[key] = cacheEntry{rate: rate, fetched: now}
+		c.mu.Unlock()
+		return rate, nil
+	})
+
+	select {
+	case <-ctx.Done():
+		return 0, ctx.Err()
+	case result := <-lookup:
+		if result.Err != nil {
+			return 0, result.Err
+		}
+		return result.Val.(float64), nil
+	}
+}
+
+// cached returns the rate stored under a key, unless it may be out of date
+func (c *Cache) cached(key cacheKey) (float64, bool) {
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+
+	if ok && (key.day < day(entry.fetched) || c.now().Sub(entry.fetched) < c.ttl) {
+		return entry.rate, true
+	}
+	return 0, false
+}
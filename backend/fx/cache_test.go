@@ -0,0 +1,155 @@
+package fx
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingProvider answers every lookup with the same rate or error,
+// counting how often it is asked. Lookups wait for release when it is set.
+type countingProvider struct {
+	rate    float64
+	err     error
+	release chan struct{}
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (p *countingProvider) Rate(ctx context.Context, base, quote string, date time.Time) (float64, error) {
+	p.mu.Lock()
+	p.calls++
+	p.mu.Unlock()
+
+	if p.release != nil {
+		<-p.release
+	}
+	return p.rate, p.err
+}
+
+func (p *countingProvider) count() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.calls
+}
+
+func TestCacheTTL(t *testing.T) {
+	now := time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)
+	p := &countingProvider{rate: 1.08}
+	c := NewCache(p, time.Hour)
+	c.now = func() time.Time { return now }
+
+	lookup := func(date time.Time) {
+		t.Helper()
+		if rate, err := c.Rate(context.Background(), "EUR", "USD", date); err != nil || rate != 1.08 {
+			t.Fatalf("Rate = %v, %v", rate, err)
+		}
+	}
+
+	// Today's rate may still be published, so it is only kept for the TTL
+	today := now
+	lookup(today)
+	lookup(today)
+	now = now.Add(59 * time.Minute)
+	lookup(today)
+	if p.count() != 1 {
+		t.Errorf("%d lookups of today within the TTL, want 1", p.count())
+	}
+	now = now.Add(2 * time.Minute)
+	lookup(today)
+	if p.count() != 2 {
+		t.Errorf("%d lookups of today after the TTL, want 2", p.count())
+	}
+
+	// A rate for a day that was over when it was fetched is kept
+	yesterday := now.AddDate(0, 0, -1)
+	lookup(yesterday)
+	now = now.AddDate(0, 1, 0)
+	lookup(yesterday)
+	if p.count() != 3 {
+		t.Errorf("%d lookups after a past day was fetched twice, want 3", p.count())
+	}
+
+	// A later day is no more final than today
+	tomorrow := now.AddDate(0, 0, 1)
+	lookup(tomorrow)
+	now = now.Add(2 * time.Hour)
+	lookup(tomorrow)
+	if p.count() != 5 {
+		t.Errorf("%d lookups after a later day was fetched twice, want 5", p.count())
+	}
+
+	// Currency codes are matched ignoring case
+	if _, err := c.Rate(context.Background(), "eur", "usd", yesterday); err != nil || p.count() != 5 {
+		t.Errorf("lower case codes missed the cache: %v, %d lookups", err, p.count())
+	}
+}
+
+func TestCacheErrors(t *testing.T) {
+	p := &countingProvider{err: ErrNoRate}
+	c := NewCache(p, time.Hour)
+	past := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 2; i++ {
+		if _, err := c.Rate(context.Background(), "EUR", "XXX", past); err != ErrNoRate {
+			t.Fatalf("got error %v, want ErrNoRate", err)
+		}
+	}
+	if p.count() != 2 {
+		t.Errorf("%d lookups, want failed ones not to be cached", p.count())
+	}
+}
+
+func TestCacheSharesLookups(t *testing.T) {
+	// The lookup fails, so nothing is cached: callers only get away with
+	// one lookup by sharing it
+	p := &countingProvider{err: errors.New("rates API is slow"), release: make(chan struct{})}
+	c := NewCache(p, time.Hour)
+	date := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	const callers = 10
+	errs := make(chan error, callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			_, err := c.Rate(context.Background(), "EUR", "USD", date)
+			errs <- err
+		}()
+	}
+
+	// Give every caller time to join the lookup before it finishes
+	time.Sleep(50 * time.Millisecond)
+	close(p.release)
+	for i := 0; i < callers; i++ {
+		if err := <-errs; err != p.err {
+			t.Errorf("got error %v, want %v", err, p.err)
+		}
+	}
+	if p.count() != 1 {
+		t.Errorf("%d lookups for %d concurrent callers, want 1", p.count(), callers)
+	}
+}
+
+func TestCacheCallerGivesUp(t *testing.T) {
+	p := &countingProvider{rate: 1.08, release: make(chan struct{})}
+	c := NewCache(p, time.Hour)
+	date := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := c.Rate(ctx, "EUR", "USD", date); err != context.DeadlineExceeded {
+		t.Fatalf("got error %v, want the deadline", err)
+	}
+
+	// The lookup carries on, and the next caller either joins it or finds
+	// its rate cached
+	close(p.release)
+	if rate, err := c.Rate(context.Background(), "EUR", "USD", date); err != nil || rate != 1.08 {
+		t.Fatalf("Rate = %v, %v", rate, err)
+	}
+	if p.count() != 1 {
+		t.Errorf("%d lookups, want the abandoned one to be reused", p.count())
+	}
+}
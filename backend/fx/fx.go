@@ -0,0 +1,108 @@
+// Package fx looks up currency exchange rates. Rates come either from a
+// table loaded from a JSON file or MongoDB collection, which works offline,
+// or from an HTTP rates API.
+package fx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"split-it/backend/config"
+	"split-it/backend/models"
+	"split-it/backend/money"
+	"time"
+)
+
+// ErrNoRate is returned when no rate is known for a pair of currencies
+var ErrNoRate = errors.New("no exchange rate")
+
+// Provider looks up historical exchange rates
+type Provider interface {
+	// Rate returns how many units of the quote currency one unit of the
+	// base currency was worth on the given day. Only the UTC calendar day
+	// of date matters.
+	Rate(ctx context.Context, base, quote string, date time.Time) (float64, error)
+}
+
+// Rates lists what one unit of Base was worth in other currencies on a day.
+// It is both the format of rate tables and of HTTP API responses.
+type Rates struct {
+	// Date is the day the rates apply to, as YYYY-MM-DD
+	Date  string             `json:"date" bson:"date"`
+	Base  string             `json:"base" bson:"base"`
+	Rates map[string]float64 `json:"rates" bson:"rates"`
+}
+
+// dayLayout is the format of Rates.Date
+const dayLayout = "2006-01-02"
+
+// day returns the UTC calendar day of a time, formatted like Rates.Date
+func day(t time.Time) string {
+	return t.UTC().Format(dayLayout)
+}
+
+// ToBase converts an expense to a base currency. An expense without a
+// currency is taken to be in the base currency, which converts at 1. Any
+// other currency uses the expense's exchange rate, or the rate p has for
+// the expense's date if it has none; ErrNoRate is returned when p is nil.
+func ToBase(ctx context.Context, p Provider, expense *models.Expense, base string) error {
+	if expense.Currency == "" {
+		expense.Currency = base
+	}
+
+	if expense.Currency == base {
+		expense.ExchangeRate = 1
+	} else if expense.ExchangeRate == 0 {
+		if p == nil {
+			return ErrNoRate
+		}
+
+		date := expense.Date
+		if date.IsZero() {
+			date = time.Now()
+		}
+		rate, err := p.Rate(ctx, expense.Currency, base, date)
+		if err != nil {
+			return err
+		}
+		expense.ExchangeRate = rate
+	}
+	expense.BaseAmount = money.Convert(expense.Amount, expense.ExchangeRate)
+	return nil
+}
+
+// Open returns the provider selected by the FX_PROVIDER environment
+// variable, or nil when it is unset or "none", in which case every
+// exchange rate has to be given by the client.
+//
+//   - "file" loads a table from the JSON file at FX_RATES_FILE
+//   - "mongo" loads a table from the exchange_rates collection
+//   - "http" queries the API at FX_API_URL, caching the answers
+func Open(ctx context.Context) (Provider, error) {
+	provider := os.Getenv("FX_PROVIDER")
+
+	switch provider {
+	case "", "none":
+		return nil, nil
+	case "file":
+		path := os.Getenv("FX_RATES_FILE")
+		if path == "" {
+			path = "exchange-rates.json"
+		}
+		return LoadFile(path)
+	case "mongo":
+		if config.GetDB() == nil {
+			config.ConnectDB()
+		}
+		return LoadCollection(ctx, config.GetDB().Collection("exchange_rates"))
+	case "http":
+		url := os.Getenv("FX_API_URL")
+		if url == "" {
+			url = DefaultAPIURL
+		}
+		return NewCache(NewHTTPProvider(url), time.Hour), nil
+	}
+
+	return nil, fmt.Errorf("unknown FX_PROVIDER %q", provider)
+}
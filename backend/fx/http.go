@@ -0,0 +1,71 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultAPIURL is the rates API used when FX_API_URL isn't set. It serves
+// the European Central Bank's reference rates.
+const DefaultAPIURL = "https://api.frankfurter.dev/v1"
+
+// HTTPProvider looks up rates from a Frankfurter-compatible API, which
+// answers GET {url}/{YYYY-MM-DD}?from=EUR&to=USD with the Rates for the
+// most recent working day on or before the date. Pointing it at a local
+// stub is enough to test against.
+type HTTPProvider struct {
+	url    string
+	client *http.Client
+}
+
+// NewHTTPProvider returns a provider for the API at a base URL
+func NewHTTPProvider(baseURL string) *HTTPProvider {
+	return &HTTPProvider{
+		url:    strings.TrimSuffix(baseURL, "/"),
+		client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+// Rate asks the API for the rate between two currencies on a day
+func (p *HTTPProvider) Rate(ctx context.Context, base, quote string, date time.Time) (float64, error) {
+	base, quote = strings.ToUpper(base), strings.ToUpper(quote)
+	if base == quote {
+		return 1, nil
+	}
+
+	query := url.Values{"from": {base}, "to": {quote}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.url+"/"+day(date)+"?"+query.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// Unsupported currencies and dates before the API's data starts are
+	// reported as client errors
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusUnprocessableEntity {
+		return 0, ErrNoRate
+	}
+	if res.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("rates API returned %s", res.Status)
+	}
+
+	var rates Rates
+	if err := json.NewDecoder(res.Body).Decode(&rates); err != nil {
+		return 0, fmt.Errorf("decoding rates: %w", err)
+	}
+	rate, ok := rates.cross(base, quote)
+	if !ok || rate <= 0 {
+		return 0, ErrNoRate
+	}
+	return rate, nil
+}
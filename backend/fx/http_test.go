@@ -0,0 +1,69 @@
+package fx
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHTTPProvider(t *testing.T) {
+	var gotPath, gotQuery string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath, gotQuery = r.URL.Path, r.URL.RawQuery
+
+		switch r.URL.Query().Get("to") {
+		case "USD":
+			w.Write([]byte(`{"date": "2024-03-01", "base": "EUR", "rates": {"USD": 1.0834}}`))
+		case "CHF":
+			// Answered for another pair than was asked
+			w.Write([]byte(`{"date": "2024-03-01", "base": "EUR", "rates": {"GBP": 0.85}}`))
+		case "XXX":
+			http.Error(w, `{"message": "not found"}`, http.StatusNotFound)
+		case "YYY":
+			http.Error(w, `{"message": "invalid"}`, http.StatusUnprocessableEntity)
+		case "GBP":
+			w.Write([]byte(`not json`))
+		default:
+			http.Error(w, "down", http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	p := NewHTTPProvider(server.URL + "/")
+	date := time.Date(2024, 3, 3, 23, 30, 0, 0, time.UTC)
+
+	rate, err := p.Rate(context.Background(), "eur", "usd", date)
+	if err != nil || rate != 1.0834 {
+		t.Fatalf("Rate = %v, %v; want 1.0834", rate, err)
+	}
+	if gotPath != "/2024-03-03" || gotQuery != "from=EUR&to=USD" {
+		t.Errorf("asked for %s?%s", gotPath, gotQuery)
+	}
+
+	if rate, err := p.Rate(context.Background(), "CHF", "chf", date); err != nil || rate != 1 {
+		t.Errorf("same currency = %v, %v; want 1", rate, err)
+	}
+
+	tests := []struct {
+		name    string
+		quote   string
+		noRate  bool
+		failing bool
+	}{
+		{"missing quote in the answer", "CHF", true, false},
+		{"not found", "XXX", true, false},
+		{"unprocessable", "YYY", true, false},
+		{"bad body", "GBP", false, true},
+		{"server error", "JPY", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := p.Rate(context.Background(), "EUR", tt.quote, date)
+			if (err == ErrNoRate) != tt.noRate || (err != nil) != (tt.noRate || tt.failing) {
+				t.Errorf("got error %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxLookbackDays is how far before a day a table looks for a rate. Gaps
+// such as weekends and holidays are a few days long; a longer one means the
+// table has stopped being updated, and its last rate is too old to use.
+const maxLookbackDays = 7
+
+// Table is a provider backed by a fixed list of daily rates. The rate for a
+// day is taken from the most recent entry on or before it that quotes both
+// currencies, so gaps such as weekends are covered by the last entry
+// before them. Entries more than maxLookbackDays before the day aren't used.
+type Table struct {
+	// days is sorted by date, oldest first
+	days []Rates
+}
+
+// NewTable builds a table from daily rates in any order. Currency codes are
+// upper-cased; dates must be YYYY-MM-DD and rates positive.
+func NewTable(days []Rates) (*Table, error) {
+	t := &Table{days: make([]Rates, 0, len(days))}
+	for _, d := range days {
+		if _, err := time.Parse(dayLayout, d.Date); err != nil {
+			return nil, fmt.Errorf("invalid date %q", d.Date)
+		}
+		if d.Base == "" {
+			return nil, fmt.Errorf("rates for %s have no base currency", d.Date)
+		}
+
+		rates := make(map[string]float64, len(d.Rates))
+		for code, rate := range d.Rates {
+			if rate <= 0 {
+				return nil, fmt.Errorf("rate for %s on %s must be positive", code, d.Date)
+			}
+			rates[strings.ToUpper(code)] = rate
+		}
+		t.days = append(t.days, Rates{Date: d.Date, Base: strings.ToUpper(d.Base), Rates: rates})
+	}
+
+	sort.SliceStable(t.days, func(i, j int) bool {
+		return t.days[i].Date < t.days[j].Date
+	})
+	return t, nil
+}
+
+// LoadFile reads a table from a JSON file holding an array of Rates
+func LoadFile(path string) (*Table, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var days []Rates
+	if err := json.Unmarshal(data, &days); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return NewTable(days)
+}
+
+// LoadCollection reads a table from a MongoDB collection of Rates documents.
+// The table is a snapshot; rates added later are picked up on restart.
+func LoadCollection(ctx context.Context, collection *mongo.Collection) (*Table, error) {
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var days []Rates
+	if err := cursor.All(ctx, &days); err != nil {
+		return nil, err
+	}
+	return NewTable(days)
+}
+
+// Rate returns the rate between two currencies on a day
+func (t *Table) Rate(ctx context.Context, base, quote string, date time.Time) (float64, error) {
+	base, quote = strings.ToUpper(base), strings.ToUpper(quote)
+	if base == quote {
+		return 1, nil
+	}
+
+	// Index of the first entry after the day
+	end := sort.Search(len(t.days), func(i int) bool {
+		return t.days[i].Date > day(date)
+	})
+	oldest := day(date.AddDate(0, 0, -maxLookbackDays))
+	for i := end - 1; i >= 0 && t.days[i].Date >= oldest; i-- {
+		if rate, ok := t.days[i].cross(base, quote); ok {
+			return rate, nil
+		}
+	}
+	return 0, ErrNoRate
+}
+
+// cross derives the rate between two currencies from one day's rates,
+// going through the day's base currency if neither of them is it
+func (r Rates) cross(base, quote string) (float64, bool) {
+	from, ok := r.value(base)
+	if !ok {
+		return 0, false
+	}
+	to, ok := r.value(quote)
+	if !ok {
+		return 0, false
+	}
+	return to / from, true
+}
+
+// value returns what one unit of r.Base was worth in a currency
+func (r Rates) value(code string) (float64, bool) {
+	if code == r.Base {
+		return 1, true
+	}
+	rate, ok := r.Rates[code]
+	return rate, ok
+}
@@ -0,0 +1,73 @@
+package fx
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTable(t *testing.T) {
+	table, err := NewTable([]Rates{
+		{Date: "2024-03-04", Base: "eur", Rates: map[string]float64{"usd": 1.0855, "CHF": 0.9580}},
+		{Date: "2024-03-01", Base: "EUR", Rates: map[string]float64{"USD": 1.0834, "CHF": 0.9556}},
+		{Date: "2024-03-05", Base: "EUR", Rates: map[string]float64{"USD": 1.0860}},
+	})
+	if err != nil {
+		t.Fatalf("NewTable: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		base, quote string
+		date        string
+		want        float64
+		err         error
+	}{
+		{"same currency", "JPY", "jpy", "2020-01-01", 1, nil},
+		{"from the base", "EUR", "USD", "2024-03-04", 1.0855, nil},
+		{"to the base", "USD", "EUR", "2024-03-01", 1 / 1.0834, nil},
+		{"through the base", "USD", "CHF", "2024-03-04", 0.9580 / 1.0855, nil},
+		{"lower case", "eur", "usd", "2024-03-01", 1.0834, nil},
+		{"weekend uses the Friday", "EUR", "USD", "2024-03-03", 1.0834, nil},
+		{"latest entry quoting both", "EUR", "CHF", "2024-03-05", 0.9580, nil},
+		{"a week after the last entry", "EUR", "USD", "2024-03-12", 1.0860, nil},
+		{"over a week after the last entry", "EUR", "USD", "2024-03-13", 0, ErrNoRate},
+		{"over a week after the last entry quoting both", "EUR", "CHF", "2024-03-12", 0, ErrNoRate},
+		{"before the first entry", "EUR", "USD", "2024-02-29", 0, ErrNoRate},
+		{"unknown currency", "EUR", "GBP", "2024-03-04", 0, ErrNoRate},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			date, _ := time.Parse(dayLayout, tt.date)
+			got, err := table.Rate(context.Background(), tt.base, tt.quote, date.Add(15*time.Hour))
+			if err != tt.err {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if math.Abs(got-tt.want) > 1e-12 {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewTable(t *testing.T) {
+	tests := []struct {
+		name string
+		days []Rates
+	}{
+		{"bad date", []Rates{{Date: "01/03/2024", Base: "EUR", Rates: map[string]float64{"USD": 1.08}}}},
+		{"no base", []Rates{{Date: "2024-03-01", Rates: map[string]float64{"USD": 1.08}}}},
+		{"zero rate", []Rates{{Date: "2024-03-01", Base: "EUR", Rates: map[string]float64{"USD": 0}}}},
+		{"negative rate", []Rates{{Date: "2024-03-01", Base: "EUR", Rates: map[string]float64{"USD": -1}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTable(tt.days); err == nil {
+				t.Errorf("NewTable(%+v) succeeded", tt.days)
+			}
+		})
+	}
+}
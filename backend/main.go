@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
 	"fmt"
 	"log"
 	"os"
 	"split-it/backend/config"
+	"split-it/backend/fx"
+	"split-it/backend/middleware"
+	"split-it/backend/migrations"
+	"split-it/backend/recurring"
 	"split-it/backend/routes"
+	"split-it/backend/store"
+	"split-it/backend/trash"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -23,14 +32,52 @@ func main() {
 		log.Println("⚠️  No .env file found")
 	}
 
-	// Initialize database
-	config.ConnectDB()
+	// `backend migrate` applies pending migrations and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		config.ConnectDB()
+		runMigrations()
+		return
+	}
+
+	// Initialize storage
+	db, err := store.Open()
+	if err != nil {
+		log.Fatalf("❌ Storage Error: %v", err)
+	}
+
+	// Bring the MongoDB collections up to date
+	if config.GetDB() != nil {
+		runMigrations()
+	}
+
+	// Initialize the exchange rate provider, if one is configured
+	rates, err := fx.Open(context.Background())
+	if err != nil {
+		log.Fatalf("❌ Exchange Rate Error: %v", err)
+	}
+
+	// Initialize attachment storage
+	blobs, err := store.OpenBlobs()
+	if err != nil {
+		log.Fatalf("❌ Attachment Storage Error: %v", err)
+	}
+
+	// Add recurring expenses as they fall due
+	go recurring.NewScheduler(db, db, db, db, rates, recurring.SystemClock{}).Run(context.Background())
+
+	// Permanently delete what has been in the trash for too long
+	retention := trashRetention()
+	go trash.NewPurger(db, db, blobs, retention).Run(context.Background())
 
 	// Initialize Firebase
 	config.InitializeFirebase()
 
 	// Create Fiber app
 	app := fiber.New(fiber.Config{
+		// Bodies are streamed so that LimitBody can let attachment uploads
+		// past the default limit while every other route keeps it
+		StreamRequestBody:            true,
+		DisablePreParseMultipartForm: true,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
 			if e, ok := err.(*fiber.Error); ok {
@@ -47,6 +94,7 @@ func main() {
 	app.Use(recover.New())
 	app.Use(logger.New())
 	app.Use(helmet.New())
+	app.Use(middleware.LimitBody(fiber.DefaultBodyLimit, routes.IsAttachmentUpload))
 
 	// CORS configuration
 	allowedOrigin := os.Getenv("CLIENT_URL")
@@ -57,7 +105,8 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     allowedOrigin + ",http://localhost:3000,http://localhost:3001",
 		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin,Content-Type,Accept,Authorization",
+		AllowHeaders:     "Origin,Content-Type,Accept,Authorization,If-Match,If-None-Match",
+		ExposeHeaders:    "ETag",
 		AllowCredentials: true,
 	}))
 
@@ -83,8 +132,10 @@ func main() {
 	})
 
 	// Setup routes
-	routes.SetupUserRoutes(app)
-	routes.SetupGroupRoutes(app)
+	routes.SetupUserRoutes(app, db)
+	routes.SetupGroupRoutes(app, db, db, db, db, db, blobs, rates, retention)
+	routes.SetupInviteRoutes(app, db, db)
+	routes.SetupAttachmentRoutes(app, db, blobs, attachmentURLKey())
 
 	// 404 handler
 	app.Use(func(c *fiber.Ctx) error {
@@ -106,3 +157,46 @@ func main() {
 
 	log.Fatal(app.Listen(":" + port))
 }
+
+// attachmentURLKey returns the key attachment download links are signed
+// with. Without ATTACHMENT_URL_KEY a random key is used, so links stop
+// working when the server restarts and only work on the instance that
+// handed them out.
+func attachmentURLKey() []byte {
+	if key := os.Getenv("ATTACHMENT_URL_KEY"); key != "" {
+		return []byte(key)
+	}
+
+	log.Println("⚠️  No ATTACHMENT_URL_KEY set, attachment links only work until restart")
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatalf("❌ Attachment URL Key Error: %v", err)
+	}
+	return key
+}
+
+// trashRetention returns how long deleted groups and expenses are kept in
+// the trash, from TRASH_RETENTION_DAYS
+func trashRetention() time.Duration {
+	days := os.Getenv("TRASH_RETENTION_DAYS")
+	if days == "" {
+		return trash.DefaultRetention
+	}
+
+	n, err := strconv.Atoi(days)
+	if err != nil || n < 1 {
+		log.Fatalf("❌ Trash Retention Error: TRASH_RETENTION_DAYS must be a positive number of days, got %q", days)
+	}
+	return time.Duration(n) * 24 * time.Hour
+}
+
+// runMigrations applies pending MongoDB migrations, exiting on failure
+func runMigrations() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	if err := migrations.Run(ctx, config.GetDB()); err != nil {
+		log.Fatalf("❌ Migration Error: %v", err)
+	}
+	fmt.Printf("✅ Schema at version %d\n", migrations.Latest())
+}
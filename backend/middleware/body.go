@@ -0,0 +1,54 @@
+package middleware
+
+import (
+	"io"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// LimitBody rejects requests whose body is larger than limit bytes. Requests
+// skip reports true for, if skip isn't nil, are left to a limit of their own.
+//
+// The server has to stream request bodies for this to raise the limit on a
+// route: otherwise it refuses bodies over its own limit before any handler
+// runs, and reads the rest whole.
+func LimitBody(limit int, skip func(c *fiber.Ctx) bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if skip != nil && skip(c) {
+			return c.Next()
+		}
+
+		req := c.Request()
+		if req.Header.ContentLength() > limit {
+			return bodyTooLarge(c)
+		}
+
+		// A streamed body is read here, with the limit, so handlers can't
+		// read more of it than that
+		if stream := req.BodyStream(); stream != nil {
+			body, err := io.ReadAll(io.LimitReader(stream, int64(limit)+1))
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+					"success": false,
+					"message": "Invalid request body",
+				})
+			}
+			if len(body) > limit {
+				return bodyTooLarge(c)
+			}
+			req.SetBody(body)
+		}
+
+		return c.Next()
+	}
+}
+
+// bodyTooLarge refuses a request and closes the connection, since the rest
+// of the body is left unread
+func bodyTooLarge(c *fiber.Ctx) error {
+	c.Context().SetConnectionClose()
+	return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+		"success": false,
+		"message": "Request body is too large",
+	})
+}
@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"split-it/backend/models"
+)
+
+// Permission is an action a user may take on a group
+type Permission string
+
+const (
+	// PermViewGroup allows reading the group, its expenses and balances
+	PermViewGroup Permission = "group:view"
+	// PermEditGroup allows renaming the group and adding members
+	PermEditGroup Permission = "group:edit"
+	// PermEditExpenses allows adding, editing and deleting expenses and payments
+	PermEditExpenses Permission = "expenses:edit"
+	// PermManageMembers allows removing members, changing roles and inviting people
+	PermManageMembers Permission = "members:manage"
+	// PermDeleteGroup allows deleting the group
+	PermDeleteGroup Permission = "group:delete"
+)
+
+var rolePermissions = map[models.Role][]Permission{
+	models.RoleOwner:  {PermViewGroup, PermEditGroup, PermEditExpenses, PermManageMembers, PermDeleteGroup},
+	models.RoleAdmin:  {PermViewGroup, PermEditGroup, PermEditExpenses, PermManageMembers},
+	models.RoleMember: {PermViewGroup, PermEditGroup, PermEditExpenses},
+	models.RoleViewer: {PermViewGroup},
+}
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role models.Role) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// HasPermission reports whether a role grants a permission
+func HasPermission(role models.Role, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// CanAccessGroup reports whether the authenticated user holds a permission
+// on the given group
+func CanAccessGroup(user *UserContext, group models.Group, perm Permission) bool {
+	if user == nil {
+		return false
+	}
+	return HasPermission(group.RoleOf(user.UID), perm)
+}
@@ -0,0 +1,145 @@
+// Package migrations brings the MongoDB collections up to date. Each
+// migration runs once; the versions that have been applied are recorded in
+// the schema_migrations collection.
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Migration is a single schema or data change. Up must be idempotent: if
+// the process dies after Up but before the version is recorded, it runs
+// again on the next start.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// Record is the document stored for each applied migration
+type Record struct {
+	Version     int       `bson:"_id"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"appliedAt"`
+}
+
+const (
+	versionsCollection = "schema_migrations"
+	lockCollection     = "schema_migrations_lock"
+
+	// A lock older than this is assumed to belong to a crashed process
+	staleLockAge = 10 * time.Minute
+)
+
+// Run applies every pending migration in version order. Only one process
+// migrates at a time; others wait for it to finish.
+func Run(ctx context.Context, db *mongo.Database) error {
+	release, err := lock(ctx, db)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	applied, err := Applied(ctx, db)
+	if err != nil {
+		return err
+	}
+	done := make(map[int]bool, len(applied))
+	for _, r := range applied {
+		done[r.Version] = true
+	}
+
+	for _, m := range sorted() {
+		if done[m.Version] {
+			continue
+		}
+
+		if err := m.Up(ctx, db); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+		}
+
+		record := Record{Version: m.Version, Description: m.Description, AppliedAt: time.Now()}
+		if _, err := db.Collection(versionsCollection).InsertOne(ctx, record); err != nil {
+			return fmt.Errorf("recording migration %d: %w", m.Version, err)
+		}
+		fmt.Printf("✅ Applied migration %d: %s\n", m.Version, m.Description)
+	}
+	return nil
+}
+
+// Applied returns the migrations that have been applied, oldest first
+func Applied(ctx context.Context, db *mongo.Database) ([]Record, error) {
+	cursor, err := db.Collection(versionsCollection).Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+
+	var records []Record
+	if err := cursor.All(ctx, &records); err != nil {
+		return nil, err
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Version < records[j].Version })
+	return records, nil
+}
+
+// Latest returns the highest known migration version
+func Latest() int {
+	latest := 0
+	for _, m := range all {
+		if m.Version > latest {
+			latest = m.Version
+		}
+	}
+	return latest
+}
+
+func sorted() []Migration {
+	migrations := append([]Migration(nil), all...)
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations
+}
+
+// lock takes the migration lock, waiting while another process holds it.
+// The returned function releases the lock.
+func lock(ctx context.Context, db *mongo.Database) (func(), error) {
+	collection := db.Collection(lockCollection)
+	host, _ := os.Hostname()
+	owner := fmt.Sprintf("%s:%d:%d", host, os.Getpid(), time.Now().UnixNano())
+
+	for {
+		_, err := collection.InsertOne(ctx, bson.M{"_id": "lock", "owner": owner, "lockedAt": time.Now()})
+		if err == nil {
+			break
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, fmt.Errorf("taking migration lock: %w", err)
+		}
+
+		// Clear a lock left behind by a process that died mid-migration
+		if _, err := collection.DeleteOne(ctx, bson.M{
+			"_id":      "lock",
+			"lockedAt": bson.M{"$lt": time.Now().Add(-staleLockAge)},
+		}); err != nil {
+			return nil, fmt.Errorf("clearing stale migration lock: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("waiting for migration lock: %w", ctx.Err())
+		case <-time.After(time.Second):
+		}
+	}
+
+	return func() {
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		collection.DeleteOne(releaseCtx, bson.M{"_id": "lock", "owner": owner})
+	}, nil
+}
@@ -0,0 +1,364 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"split-it/backend/models"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// all lists every migration. Append new ones with the next version number;
+// never renumber or remove a migration that has shipped.
+var all = []Migration{
+	{
+		Version:     1,
+		Description: "Index users by Firebase UID",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("users"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "firebaseUid", Value: 1}},
+				Options: options.Index().SetUnique(true),
+			})
+		},
+	},
+	{
+		Version:     2,
+		Description: "Index groups by ID, owner and linked members",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("groups"),
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "id", Value: 1}, {Key: "userId", Value: 1}},
+					Options: options.Index().SetUnique(true),
+				},
+				mongo.IndexModel{Keys: bson.D{{Key: "userId", Value: 1}, {Key: "createdAt", Value: -1}}},
+				mongo.IndexModel{Keys: bson.D{{Key: "members.userId", Value: 1}}},
+			)
+		},
+	},
+	{
+		Version:     3,
+		Description: "Index invites by token and group",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("invites"),
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "token", Value: 1}},
+					Options: options.Index().SetUnique(true),
+				},
+				mongo.IndexModel{Keys: bson.D{{Key: "groupId", Value: 1}}},
+			)
+		},
+	},
+	{
+		Version:     4,
+		Description: "Store amounts as integer cents",
+		Up:          convertAmountsToCents,
+	},
+	{
+		Version:     5,
+		Description: "Move expenses out of group documents",
+		Up:          moveExpensesToCollection,
+	},
+	{
+		Version:     6,
+		Description: "Index expenses by category and tag",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("expenses"),
+				mongo.IndexModel{Keys: bson.D{{Key: "groupId", Value: 1}, {Key: "category", Value: 1}}},
+				mongo.IndexModel{Keys: bson.D{{Key: "groupId", Value: 1}, {Key: "tags", Value: 1}}},
+			)
+		},
+	},
+	{
+		Version:     7,
+		Description: "Index recurring expenses by group and next run",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("recurring_expenses"),
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "groupId", Value: 1}, {Key: "id", Value: 1}},
+					Options: options.Index().SetUnique(true),
+				},
+				mongo.IndexModel{Keys: bson.D{{Key: "nextRun", Value: 1}}},
+			)
+		},
+	},
+	{
+		Version:     8,
+		Description: "Index activity by group and time",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			return createIndexes(ctx, db.Collection("activity"), mongo.IndexModel{
+				Keys: bson.D{{Key: "groupId", Value: 1}, {Key: "createdAt", Value: -1}, {Key: "id", Value: -1}},
+			})
+		},
+	},
+	{
+		Version:     9,
+		Description: "Index the trash by group and deletion time",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			err := createIndexes(ctx, db.Collection("trashed_expenses"),
+				mongo.IndexModel{
+					Keys:    bson.D{{Key: "groupId", Value: 1}, {Key: "expense.id", Value: 1}},
+					Options: options.Index().SetUnique(true),
+				},
+				mongo.IndexModel{Keys: bson.D{{Key: "deletedAt", Value: 1}}},
+			)
+			if err != nil {
+				return err
+			}
+			return createIndexes(ctx, db.Collection("groups"), mongo.IndexModel{
+				Keys:    bson.D{{Key: "deletedAt", Value: 1}},
+				Options: options.Index().SetSparse(true),
+			})
+		},
+	},
+	{
+		Version:     10,
+		Description: "Make group IDs unique",
+		Up:          uniqueGroupIDs,
+	},
+}
+
+// createIndexes creates indexes on a collection. Creating an index that
+// already exists with the same options is a no-op.
+func createIndexes(ctx context.Context, collection *mongo.Collection, indexes ...mongo.IndexModel) error {
+	_, err := collection.Indexes().CreateMany(ctx, indexes)
+	return err
+}
+
+// legacyAmount matches amounts stored as floating point or 32-bit integer
+// major units by older versions
+var legacyAmount = bson.M{"$type": bson.A{"double", "int"}}
+
+// maxConversionPasses bounds how often groups that changed while being
+// converted are retried
+const maxConversionPasses = 5
+
+// convertAmountsToCents rewrites expenses and payments whose amounts are
+// still in major units. Decoding with the money package converts them, so
+// each group is read and its lists written back. A group is only written if
+// its version hasn't changed since it was read; groups that were edited in
+// the meantime are picked up by the next pass. Groups without legacy
+// amounts are never touched, so running this again is harmless.
+func convertAmountsToCents(ctx context.Context, db *mongo.Database) error {
+	collection := db.Collection("groups")
+	filter := bson.M{"$or": bson.A{
+		bson.M{"expenses.amount": legacyAmount},
+		bson.M{"expenses.payers.amount": legacyAmount},
+		bson.M{"expenses.split.parts.amount": legacyAmount},
+		bson.M{"payments.amount": legacyAmount},
+	}}
+
+	for pass := 0; pass < maxConversionPasses; pass++ {
+		cursor, err := collection.Find(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		var groups []models.Group
+		if err := cursor.All(ctx, &groups); err != nil {
+			return err
+		}
+		if len(groups) == 0 {
+			return nil
+		}
+
+		for _, g := range groups {
+			// Missing lists are left alone rather than set to null, which
+			// would break later $push updates
+			set := bson.M{}
+			if g.Expenses != nil {
+				set["expenses"] = g.Expenses
+			}
+			if g.Payments != nil {
+				set["payments"] = g.Payments
+			}
+
+			// The version isn't bumped: the amounts mean the same thing,
+			// so clients' copies are still current
+			_, err := collection.UpdateOne(ctx,
+				bson.M{"_id": g.ID, "version": versionFilter(g.Version)},
+				bson.M{"$set": set},
+			)
+			if err != nil {
+				return fmt.Errorf("converting group %s: %w", g.GroupID, err)
+			}
+		}
+	}
+
+	return checkRemaining(ctx, collection, filter)
+}
+
+// moveExpensesToCollection copies the expenses embedded in each group into
+// the expenses collection, then removes them from the group. Copies are
+// upserts keyed by group and expense ID, so a group that is copied twice
+// (because it changed before its expenses were removed, or the migration
+// was interrupted) doesn't end up with duplicates. Embedded expenses that
+// share an ID are renamed first, as otherwise all but one would be lost.
+func moveExpensesToCollection(ctx context.Context, db *mongo.Database) error {
+	expenses := db.Collection("expenses")
+	err := createIndexes(ctx, expenses,
+		mongo.IndexModel{
+			Keys:    bson.D{{Key: "groupId", Value: 1}, {Key: "id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		mongo.IndexModel{Keys: bson.D{{Key: "groupId", Value: 1}, {Key: "date", Value: -1}, {Key: "id", Value: -1}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	groups := db.Collection("groups")
+	filter := bson.M{"expenses": bson.M{"$exists": true}}
+
+	for pass := 0; pass < maxConversionPasses; pass++ {
+		cursor, err := groups.Find(ctx, filter)
+		if err != nil {
+			return err
+		}
+
+		var docs []models.Group
+		if err := cursor.All(ctx, &docs); err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			return nil
+		}
+
+		for _, g := range docs {
+			if renamed := renameDuplicateExpenses(g.Expenses); len(renamed) > 0 {
+				log.Printf("⚠️  Group %s has expenses sharing an ID, renamed %s", g.GroupID, strings.Join(renamed, ", "))
+			}
+
+			// The embedded list is still authoritative, so anything copied
+			// on an earlier pass that has since been deleted goes too
+			ids := make(bson.A, len(g.Expenses))
+			writes := []mongo.WriteModel{
+				mongo.NewDeleteManyModel().SetFilter(bson.M{"groupId": g.GroupID, "id": bson.M{"$nin": ids}}),
+			}
+			for i, e := range g.Expenses {
+				ids[i] = e.ID
+				e.GroupID = g.GroupID
+				writes = append(writes, mongo.NewReplaceOneModel().
+					SetFilter(bson.M{"groupId": g.GroupID, "id": e.ID}).
+					SetReplacement(e).
+					SetUpsert(true))
+			}
+			if _, err := expenses.BulkWrite(ctx, writes); err != nil {
+				return fmt.Errorf("copying expenses of group %s: %w", g.GroupID, err)
+			}
+
+			// Only drop the embedded list if nothing was added since it was
+			// copied; otherwise the group is copied again on the next pass
+			_, err := groups.UpdateOne(ctx,
+				bson.M{"_id": g.ID, "version": versionFilter(g.Version)},
+				bson.M{"$unset": bson.M{"expenses": ""}},
+			)
+			if err != nil {
+				return fmt.Errorf("moving expenses of group %s: %w", g.GroupID, err)
+			}
+		}
+	}
+
+	return checkRemaining(ctx, groups, filter)
+}
+
+// renameDuplicateExpenses gives every expense after the first with a given
+// ID a new one, made by appending the lowest free "-2", "-3"... to it. The
+// names only depend on the order of the list, so a group copied again on a
+// later pass gets the same ones. It returns each rename as "old -> new".
+func renameDuplicateExpenses(expenses []models.Expense) []string {
+	taken := make(map[string]bool, len(expenses))
+	for _, e := range expenses {
+		taken[e.ID] = true
+	}
+
+	var renamed []string
+	seen := make(map[string]bool, len(expenses))
+	for i := range expenses {
+		id := expenses[i].ID
+		if !seen[id] {
+			seen[id] = true
+			continue
+		}
+
+		n := 2
+		for taken[fmt.Sprintf("%s-%d", id, n)] {
+			n++
+		}
+		newID := fmt.Sprintf("%s-%d", id, n)
+		taken[newID] = true
+		seen[newID] = true
+		expenses[i].ID = newID
+		renamed = append(renamed, fmt.Sprintf("%q -> %q", id, newID))
+	}
+	return renamed
+}
+
+// maxReportedDuplicates is the most shared group IDs listed when
+// uniqueGroupIDs can't go ahead
+const maxReportedDuplicates = 20
+
+// uniqueGroupIDs adds a unique index on the group ID alone, which is how
+// groups and everything stored under them are looked up. Groups that share
+// an ID can't be told apart automatically, since their expenses, recurring
+// expenses, activity and trash are stored under it too, so they are listed
+// and the migration fails before creating the index. Once they have been
+// given their own IDs, running it again goes ahead.
+func uniqueGroupIDs(ctx context.Context, db *mongo.Database) error {
+	groups := db.Collection("groups")
+	cursor, err := groups.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": "$id", "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+		{{Key: "$limit", Value: maxReportedDuplicates}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var duplicates []struct {
+		ID    string `bson:"_id"`
+		Count int    `bson:"count"`
+	}
+	if err := cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		ids := make([]string, len(duplicates))
+		for i, d := range duplicates {
+			ids[i] = fmt.Sprintf("%q (%d groups)", d.ID, d.Count)
+		}
+		return fmt.Errorf("group IDs shared by more than one group, showing up to %d: %s; give each group its own ID and run the migration again",
+			maxReportedDuplicates, strings.Join(ids, ", "))
+	}
+
+	return createIndexes(ctx, groups, mongo.IndexModel{
+		Keys:    bson.D{{Key: "id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+}
+
+// versionFilter matches a group at the given version. Groups created before
+// versioning have no version field, which is treated as version 0.
+func versionFilter(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
+}
+
+// checkRemaining fails if any group still matches a migration's filter
+// after the last pass
+func checkRemaining(ctx context.Context, collection *mongo.Collection, filter bson.M) error {
+	remaining, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if remaining > 0 {
+		return fmt.Errorf("%d groups kept changing during the migration; run it again", remaining)
+	}
+	return nil
+}
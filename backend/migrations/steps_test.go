@@ -0,0 +1,109 @@
+package migrations
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"split-it/backend/models"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestRenameDuplicateExpenses(t *testing.T) {
+	tests := []struct {
+		name    string
+		ids     []string
+		want    []string
+		renamed int
+	}{
+		{"unique", []string{"e1", "e2"}, []string{"e1", "e2"}, 0},
+		{"shared", []string{"e1", "e1", "e1"}, []string{"e1", "e1-2", "e1-3"}, 2},
+		{"suffix taken", []string{"e1", "e1", "e1-2"}, []string{"e1", "e1-3", "e1-2"}, 1},
+		{"none", nil, nil, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expenses := make([]models.Expense, len(tt.ids))
+			for i, id := range tt.ids {
+				expenses[i] = models.Expense{ID: id}
+			}
+
+			renamed := renameDuplicateExpenses(expenses)
+			if len(renamed) != tt.renamed {
+				t.Errorf("renamed %v, want %d renames", renamed, tt.renamed)
+			}
+			for i, e := range expenses {
+				if e.ID != tt.want[i] {
+					t.Errorf("expense %d has ID %q, want %q", i, e.ID, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// TestMoveExpensesToCollection runs against the server at MONGODB_TEST_URI,
+// and is skipped without one
+func TestMoveExpensesToCollection(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+
+	db := client.Database(fmt.Sprintf("split-it-migrations-test-%d", time.Now().UnixNano()))
+	defer db.Drop(context.Background())
+
+	_, err = db.Collection("groups").InsertOne(ctx, bson.M{
+		"id":      "g1",
+		"name":    "Trip",
+		"version": int64(1),
+		"expenses": bson.A{
+			bson.M{"id": "e1", "description": "Dinner", "amount": int64(3000), "paidBy": "m1"},
+			bson.M{"id": "e1", "description": "Taxi", "amount": int64(1500), "paidBy": "m2"},
+			bson.M{"id": "e2", "description": "Museum", "amount": int64(2000), "paidBy": "m1"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("InsertOne: %v", err)
+	}
+
+	if err := moveExpensesToCollection(ctx, db); err != nil {
+		t.Fatalf("moveExpensesToCollection: %v", err)
+	}
+
+	cursor, err := db.Collection("expenses").Find(ctx, bson.M{"groupId": "g1"}, options.Find().SetSort(bson.D{{Key: "id", Value: 1}}))
+	if err != nil {
+		t.Fatalf("Find: %v", err)
+	}
+	var expenses []models.Expense
+	if err := cursor.All(ctx, &expenses); err != nil {
+		t.Fatalf("decoding expenses: %v", err)
+	}
+
+	want := map[string]string{"e1": "Dinner", "e1-2": "Taxi", "e2": "Museum"}
+	if len(expenses) != len(want) {
+		t.Fatalf("moved %+v, want %v", expenses, want)
+	}
+	for _, e := range expenses {
+		if want[e.ID] != e.Description {
+			t.Errorf("expense %s is %q, want %q", e.ID, e.Description, want[e.ID])
+		}
+	}
+
+	remaining, err := db.Collection("groups").CountDocuments(ctx, bson.M{"expenses": bson.M{"$exists": true}})
+	if err != nil || remaining != 0 {
+		t.Errorf("%d groups still embed expenses (%v)", remaining, err)
+	}
+}
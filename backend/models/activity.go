@@ -0,0 +1,68 @@
+package models
+
+import "time"
+
+// ActivityAction identifies the kind of change an activity records
+type ActivityAction string
+
+const (
+	ActivityGroupCreated     ActivityAction = "group.created"
+	ActivityGroupUpdated     ActivityAction = "group.updated"
+	ActivityGroupDeleted     ActivityAction = "group.deleted"
+	ActivityGroupRestored    ActivityAction = "group.restored"
+	ActivityExpenseAdded     ActivityAction = "expense.added"
+	ActivityExpenseUpdated   ActivityAction = "expense.updated"
+	ActivityExpenseDeleted   ActivityAction = "expense.deleted"
+	ActivityExpenseRestored  ActivityAction = "expense.restored"
+	ActivityRecurringAdded   ActivityAction = "recurring.added"
+	ActivityRecurringUpdated ActivityAction = "recurring.updated"
+	ActivityRecurringDeleted ActivityAction = "recurring.deleted"
+	// ActivityRecurringRun is the scheduler adding a run of a recurring
+	// expense
+	ActivityRecurringRun ActivityAction = "recurring.run"
+	// ActivityRecurringSkipped is the scheduler skipping a run in a
+	// foreign currency because no exchange rate is known for its day
+	ActivityRecurringSkipped  ActivityAction = "recurring.skipped"
+	ActivityPaymentAdded      ActivityAction = "payment.added"
+	ActivityPaymentDeleted    ActivityAction = "payment.deleted"
+	ActivityMemberJoined      ActivityAction = "member.joined"
+	ActivityMemberRoleChanged ActivityAction = "member.role_changed"
+	ActivityMemberRemoved     ActivityAction = "member.removed"
+	ActivityAttachmentAdded   ActivityAction = "attachment.added"
+	ActivityAttachmentDeleted ActivityAction = "attachment.deleted"
+)
+
+// Activity is an entry in a group's append-only activity log: who changed
+// what, and when. Before and After hold what the change applied to as it
+// was before and after it; Before is left out for additions and restores
+// and After for deletions, and groups moving in and out of the trash have
+// neither. TargetID is the ID of what the action applied to: the expense
+// for expense and attachment actions, and otherwise the recurring expense,
+// payment or member. Actor is the Firebase UID of the user who made the
+// change, and ActorName their name at the time; both are empty for
+// recurring runs, which the server makes on its own.
+type Activity struct {
+	ID        string            `bson:"id" json:"id"`
+	GroupID   string            `bson:"groupId" json:"-"`
+	Actor     string            `bson:"actor" json:"actor"`
+	ActorName string            `bson:"actorName,omitempty" json:"actorName,omitempty"`
+	Action    ActivityAction    `bson:"action" json:"action"`
+	TargetID  string            `bson:"targetId,omitempty" json:"targetId,omitempty"`
+	Before    *ActivitySnapshot `bson:"before,omitempty" json:"before,omitempty"`
+	After     *ActivitySnapshot `bson:"after,omitempty" json:"after,omitempty"`
+	CreatedAt time.Time         `bson:"createdAt" json:"createdAt"`
+}
+
+// ActivitySnapshot is the state of a group or of one thing in it. Group
+// snapshots leave out the expenses; a change that replaced them lists the
+// IDs of those it changed or removed under ExpenseIDs before the change,
+// and of those it added or changed after it.
+type ActivitySnapshot struct {
+	Group      *GroupResponse    `bson:"group,omitempty" json:"group,omitempty"`
+	ExpenseIDs []string          `bson:"expenseIds,omitempty" json:"expenseIds,omitempty"`
+	Expense    *Expense          `bson:"expense,omitempty" json:"expense,omitempty"`
+	Recurring  *RecurringExpense `bson:"recurring,omitempty" json:"recurring,omitempty"`
+	Payment    *Payment          `bson:"payment,omitempty" json:"payment,omitempty"`
+	Member     *Member           `bson:"member,omitempty" json:"member,omitempty"`
+	Attachment *Attachment       `bson:"attachment,omitempty" json:"attachment,omitempty"`
+}
@@ -1,44 +1,264 @@
 package models
 
 import (
+	"slices"
+	"split-it/backend/money"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// Member represents a member in a group
+// Role determines what a linked member may do in a group
+type Role string
+
+const (
+	// RoleOwner is the user who created the group
+	RoleOwner Role = "owner"
+	// RoleAdmin can manage members in addition to everything a member can do
+	RoleAdmin Role = "admin"
+	// RoleMember can edit the group and its expenses
+	RoleMember Role = "member"
+	// RoleViewer has read-only access
+	RoleViewer Role = "viewer"
+)
+
+// Member represents a member in a group.
+// UserID optionally links the member to a user account (Firebase UID);
+// linked members can see the group and act on it according to their Role.
+// Unlinked members are placeholders for people without an account.
 type Member struct {
-	ID   string `bson:"id" json:"id"`
-	Name string `bson:"name" json:"name"`
+	ID     string `bson:"id" json:"id"`
+	Name   string `bson:"name" json:"name"`
+	UserID string `bson:"userId,omitempty" json:"userId,omitempty"`
+	Role   Role   `bson:"role,omitempty" json:"role,omitempty"`
+}
+
+// SplitType identifies how an expense is divided between participants
+type SplitType string
+
+const (
+	// SplitEqual divides the amount evenly between participants
+	SplitEqual SplitType = "equal"
+	// SplitExact assigns an explicit amount to each participant
+	SplitExact SplitType = "exact"
+	// SplitPercent assigns a percentage of the amount to each participant
+	SplitPercent SplitType = "percent"
+	// SplitShares divides the amount by weighted shares (e.g. 2 for a couple)
+	SplitShares SplitType = "shares"
+	// SplitItemized divides the amount by line items, each shared equally
+	// by its own participants, with tax and tip spread in proportion
+	SplitItemized SplitType = "itemized"
+)
+
+// SplitPart describes one participant's portion of an expense.
+// Only the field matching the split type is used.
+type SplitPart struct {
+	MemberID string       `bson:"memberId" json:"memberId"`
+	Amount   money.Amount `bson:"amount,omitempty" json:"amount,omitempty"`
+	Percent  float64      `bson:"percent,omitempty" json:"percent,omitempty"`
+	Shares   int64        `bson:"shares,omitempty" json:"shares,omitempty"`
+}
+
+// LineItem is one item on an itemized bill, like a dish on a restaurant bill
+type LineItem struct {
+	Description  string       `bson:"description" json:"description"`
+	Amount       money.Amount `bson:"amount" json:"amount"`
+	Participants []string     `bson:"participants" json:"participants"`
+}
+
+// Split specifies how an expense is divided between participants.
+// Items, Tax and Tip are only used by itemized splits, whose parts hold the
+// amount each member's items, tax and tip come to.
+type Split struct {
+	Type  SplitType    `bson:"type" json:"type"`
+	Parts []SplitPart  `bson:"parts" json:"parts"`
+	Items []LineItem   `bson:"items,omitempty" json:"items,omitempty"`
+	Tax   money.Amount `bson:"tax,omitempty" json:"tax,omitempty"`
+	Tip   money.Amount `bson:"tip,omitempty" json:"tip,omitempty"`
+}
+
+// DefaultCategories are the expense categories every group has. Groups can
+// add their own on top of these.
+var DefaultCategories = []string{
+	"food", "groceries", "transport", "accommodation", "entertainment",
+	"shopping", "utilities", "rent", "health", "gifts", "fees", "other",
+}
+
+// Payer records how much a member contributed towards paying an expense
+type Payer struct {
+	MemberID string       `bson:"memberId" json:"memberId"`
+	Amount   money.Amount `bson:"amount" json:"amount"`
 }
 
-// Expense represents an expense in a group
+// Expense represents an expense in a group.
+// PaidBy is kept for single-payer expenses and older documents; when Payers
+// is set it holds the first payer.
+// Expenses are stored in their own collection; GroupID links them to their
+// group. Older group documents embedded them without it.
+// Amount, payers and split are in the expense's Currency. ExchangeRate is
+// the number of units of the group's base currency per unit of Currency,
+// captured when the expense was recorded, and BaseAmount is Amount converted
+// with it. Expenses without a currency predate currencies and are in the
+// group's base currency.
+// Category is one of DefaultCategories or the group's own categories, and
+// Tags are free-form labels; both are lower case and optional.
+// Attachments only hold the details of attached files; their contents are
+// kept in a blob store.
 type Expense struct {
-	ID           string    `bson:"id" json:"id"`
-	Description  string    `bson:"description" json:"description"`
-	Amount       float64   `bson:"amount" json:"amount"`
-	PaidBy       string    `bson:"paidBy" json:"paidBy"`
-	Participants []string  `bson:"participants" json:"participants"`
-	Date         time.Time `bson:"date" json:"date"`
+	ID           string       `bson:"id" json:"id"`
+	GroupID      string       `bson:"groupId,omitempty" json:"-"`
+	Description  string       `bson:"description" json:"description"`
+	Amount       money.Amount `bson:"amount" json:"amount"`
+	Currency     string       `bson:"currency,omitempty" json:"currency,omitempty"`
+	ExchangeRate float64      `bson:"exchangeRate,omitempty" json:"exchangeRate,omitempty"`
+	BaseAmount   money.Amount `bson:"baseAmount,omitempty" json:"baseAmount,omitempty"`
+	Category     string       `bson:"category,omitempty" json:"category,omitempty"`
+	Tags         []string     `bson:"tags,omitempty" json:"tags,omitempty"`
+	PaidBy       string       `bson:"paidBy" json:"paidBy"`
+	Payers       []Payer      `bson:"payers,omitempty" json:"payers,omitempty"`
+	Participants []string     `bson:"participants" json:"participants"`
+	Split        *Split       `bson:"split,omitempty" json:"split,omitempty"`
+	Attachments  []Attachment `bson:"attachments,omitempty" json:"attachments,omitempty"`
+	Date         time.Time    `bson:"date" json:"date"`
 }
 
-// Group represents a group with members and expenses
+// Attachment is a file, like a photo of a receipt, attached to an expense.
+// URL is a short-lived download link filled in by the API; it isn't stored.
+type Attachment struct {
+	ID          string    `bson:"id" json:"id"`
+	Filename    string    `bson:"filename" json:"filename"`
+	ContentType string    `bson:"contentType" json:"contentType"`
+	Size        int64     `bson:"size" json:"size"`
+	UploadedBy  string    `bson:"uploadedBy" json:"uploadedBy"`
+	UploadedAt  time.Time `bson:"uploadedAt" json:"uploadedAt"`
+	URL         string    `bson:"-" json:"url,omitempty"`
+}
+
+// TrashedExpense is a deleted expense kept in its group's trash, from which
+// it can be restored until it is purged. ExpiresAt is when that happens; it
+// is filled in by the API and isn't stored.
+type TrashedExpense struct {
+	GroupID   string    `bson:"groupId" json:"-"`
+	Expense   Expense   `bson:"expense" json:"expense"`
+	DeletedBy string    `bson:"deletedBy" json:"deletedBy"`
+	DeletedAt time.Time `bson:"deletedAt" json:"deletedAt"`
+	ExpiresAt time.Time `bson:"-" json:"expiresAt"`
+}
+
+// AmountInBase returns the expense amount in the group's base currency
+func (e Expense) AmountInBase() money.Amount {
+	if e.Currency == "" {
+		return e.Amount
+	}
+	return e.BaseAmount
+}
+
+// Payment records money handed from one member to another to settle up.
+// Payments move balances but are not counted as spending.
+type Payment struct {
+	ID     string       `bson:"id" json:"id"`
+	From   string       `bson:"from" json:"from"`
+	To     string       `bson:"to" json:"to"`
+	Amount money.Amount `bson:"amount" json:"amount"`
+	Note   string       `bson:"note,omitempty" json:"note,omitempty"`
+	Date   time.Time    `bson:"date" json:"date"`
+}
+
+// Group represents a group with members and expenses.
+// Version is incremented on every change and is used for optimistic
+// concurrency control; documents created before it existed read as 0.
+// Expenses live in their own collection and are only filled in when they
+// have been loaded separately.
+// Currency is the base currency balances are kept in; groups created before
+// currencies existed have none and use money.DefaultCurrency.
+// Categories are the group's own expense categories, in addition to
+// DefaultCategories.
+// DeletedAt and DeletedBy are set while the group is in the trash.
 type Group struct {
-	ID        primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
-	GroupID   string             `bson:"id" json:"id"`
-	Name      string             `bson:"name" json:"name"`
-	Members   []Member           `bson:"members" json:"members"`
-	Expenses  []Expense          `bson:"expenses" json:"expenses"`
-	UserID    string             `bson:"userId" json:"userId"`
-	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
-	UpdatedAt time.Time          `bson:"updatedAt" json:"updatedAt"`
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"_id,omitempty"`
+	GroupID    string             `bson:"id" json:"id"`
+	Name       string             `bson:"name" json:"name"`
+	Currency   string             `bson:"currency,omitempty" json:"currency,omitempty"`
+	Categories []string           `bson:"categories,omitempty" json:"categories,omitempty"`
+	Members    []Member           `bson:"members" json:"members"`
+	Expenses   []Expense          `bson:"expenses,omitempty" json:"expenses,omitempty"`
+	Payments   []Payment          `bson:"payments" json:"payments"`
+	UserID     string             `bson:"userId" json:"userId"`
+	Version    int64              `bson:"version" json:"version"`
+	CreatedAt  time.Time          `bson:"createdAt" json:"createdAt"`
+	UpdatedAt  time.Time          `bson:"updatedAt" json:"updatedAt"`
+	DeletedAt  *time.Time         `bson:"deletedAt,omitempty" json:"deletedAt,omitempty"`
+	DeletedBy  string             `bson:"deletedBy,omitempty" json:"deletedBy,omitempty"`
 }
 
-// GroupResponse is the response structure for group data
+// GroupResponse is the response structure for group data, and is also how
+// groups are kept in activity snapshots.
+// Expenses are left out when they weren't loaded. Categories only lists the
+// group's own categories, not DefaultCategories.
 type GroupResponse struct {
-	ID        string    `json:"id"`
-	Name      string    `json:"name"`
-	Members   []Member  `json:"members"`
-	Expenses  []Expense `json:"expenses"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID         string    `bson:"id" json:"id"`
+	Name       string    `bson:"name" json:"name"`
+	Currency   string    `bson:"currency" json:"currency"`
+	Categories []string  `bson:"categories" json:"categories"`
+	Members    []Member  `bson:"members" json:"members"`
+	Expenses   []Expense `bson:"expenses,omitempty" json:"expenses,omitempty"`
+	Payments   []Payment `bson:"payments" json:"payments"`
+	Version    int64     `bson:"version" json:"version"`
+	CreatedAt  time.Time `bson:"createdAt" json:"createdAt"`
+}
+
+// GroupSummary is the compact form of a group used in group lists.
+// MyBalance is the requesting user's net balance, and is only set when they
+// are linked to a member of the group. LastActivity is the time of the most
+// recent change to the group, its expenses or its payments. DeletedAt and
+// ExpiresAt are only set for groups in the trash.
+type GroupSummary struct {
+	ID           string        `json:"id"`
+	Name         string        `json:"name"`
+	Currency     string        `json:"currency"`
+	Members      []Member      `json:"members"`
+	MemberCount  int           `json:"memberCount"`
+	ExpenseCount int64         `json:"expenseCount"`
+	TotalAmount  money.Amount  `json:"totalAmount"`
+	MyBalance    *money.Amount `json:"myBalance,omitempty"`
+	Version      int64         `json:"version"`
+	CreatedAt    time.Time     `json:"createdAt"`
+	LastActivity time.Time     `json:"lastActivity"`
+	DeletedAt    *time.Time    `json:"deletedAt,omitempty"`
+	ExpiresAt    *time.Time    `json:"expiresAt,omitempty"`
+}
+
+// BaseCurrency returns the currency the group's balances are kept in
+func (g Group) BaseCurrency() string {
+	if g.Currency == "" {
+		return money.DefaultCurrency
+	}
+	return g.Currency
+}
+
+// HasCategory reports whether an expense category is available in the
+// group. The empty category, meaning uncategorized, always is.
+func (g Group) HasCategory(category string) bool {
+	return category == "" || slices.Contains(DefaultCategories, category) || slices.Contains(g.Categories, category)
+}
+
+// RoleOf returns the role of the given user in the group, or an empty role
+// if the user has no access. Linked members without a stored role are
+// regular members.
+func (g Group) RoleOf(uid string) Role {
+	if uid == "" {
+		return ""
+	}
+	if g.UserID == uid {
+		return RoleOwner
+	}
+	for _, m := range g.Members {
+		if m.UserID == uid {
+			if m.Role == "" {
+				return RoleMember
+			}
+			return m.Role
+		}
+	}
+	return ""
 }
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Invite lets users join a group through a shareable link or code.
+// When MemberID is set the invite claims that placeholder member; otherwise
+// the accepting user picks a placeholder or is added as a new member.
+// Users joining through the invite get Role, which is never owner.
+type Invite struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"-"`
+	Token     string             `bson:"token" json:"token"`
+	GroupID   string             `bson:"groupId" json:"groupId"`
+	MemberID  string             `bson:"memberId,omitempty" json:"memberId,omitempty"`
+	Role      Role               `bson:"role,omitempty" json:"role,omitempty"`
+	CreatedBy string             `bson:"createdBy" json:"createdBy"`
+	MaxUses   int                `bson:"maxUses" json:"maxUses"`
+	Uses      int                `bson:"uses" json:"uses"`
+	ExpiresAt time.Time          `bson:"expiresAt" json:"expiresAt"`
+	CreatedAt time.Time          `bson:"createdAt" json:"createdAt"`
+}
+
+// InvitePreview is what an invited user sees before accepting.
+// Placeholders lists the unlinked members the user can claim.
+type InvitePreview struct {
+	GroupID      string    `json:"groupId"`
+	GroupName    string    `json:"groupName"`
+	MemberID     string    `json:"memberId,omitempty"`
+	Placeholders []Member  `json:"placeholders"`
+	ExpiresAt    time.Time `json:"expiresAt"`
+}
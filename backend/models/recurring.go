@@ -0,0 +1,85 @@
+package models
+
+import (
+	"split-it/backend/money"
+	"time"
+)
+
+// Frequency is the unit a recurring expense repeats in
+type Frequency string
+
+const (
+	FrequencyDaily   Frequency = "daily"
+	FrequencyWeekly  Frequency = "weekly"
+	FrequencyMonthly Frequency = "monthly"
+	FrequencyYearly  Frequency = "yearly"
+)
+
+// ExpenseTemplate holds the fields copied into every expense a recurring
+// expense creates. ExchangeRate is optional; without it the rate is looked
+// up on the day of each run.
+type ExpenseTemplate struct {
+	Description  string       `bson:"description" json:"description"`
+	Amount       money.Amount `bson:"amount" json:"amount"`
+	Currency     string       `bson:"currency,omitempty" json:"currency,omitempty"`
+	ExchangeRate float64      `bson:"exchangeRate,omitempty" json:"exchangeRate,omitempty"`
+	Category     string       `bson:"category,omitempty" json:"category,omitempty"`
+	Tags         []string     `bson:"tags,omitempty" json:"tags,omitempty"`
+	PaidBy       string       `bson:"paidBy" json:"paidBy"`
+	Payers       []Payer      `bson:"payers,omitempty" json:"payers,omitempty"`
+	Participants []string     `bson:"participants" json:"participants"`
+	Split        *Split       `bson:"split,omitempty" json:"split,omitempty"`
+}
+
+// NewExpenseTemplate returns a template that creates copies of an expense
+func NewExpenseTemplate(e Expense) ExpenseTemplate {
+	return ExpenseTemplate{
+		Description:  e.Description,
+		Amount:       e.Amount,
+		Currency:     e.Currency,
+		ExchangeRate: e.ExchangeRate,
+		Category:     e.Category,
+		Tags:         e.Tags,
+		PaidBy:       e.PaidBy,
+		Payers:       e.Payers,
+		Participants: e.Participants,
+		Split:        e.Split,
+	}
+}
+
+// Expense returns the expense the template creates with the given ID and date
+func (t ExpenseTemplate) Expense(id string, date time.Time) Expense {
+	return Expense{
+		ID:           id,
+		Description:  t.Description,
+		Amount:       t.Amount,
+		Currency:     t.Currency,
+		ExchangeRate: t.ExchangeRate,
+		Category:     t.Category,
+		Tags:         t.Tags,
+		PaidBy:       t.PaidBy,
+		Payers:       t.Payers,
+		Participants: t.Participants,
+		Split:        t.Split,
+		Date:         date,
+	}
+}
+
+// RecurringExpense adds an expense to its group on a schedule: every
+// Interval days, weeks, months or years from StartDate, until EndDate
+// (exclusive) if it has one. Monthly and yearly runs that fall on a day the
+// month doesn't have, like the 31st, happen on the month's last day.
+// NextRun is when the next expense is due; it is nil once the schedule has
+// ended.
+type RecurringExpense struct {
+	ID        string          `bson:"id" json:"id"`
+	GroupID   string          `bson:"groupId" json:"-"`
+	Template  ExpenseTemplate `bson:"template" json:"template"`
+	Frequency Frequency       `bson:"frequency" json:"frequency"`
+	Interval  int             `bson:"interval" json:"interval"`
+	StartDate time.Time       `bson:"startDate" json:"startDate"`
+	EndDate   *time.Time      `bson:"endDate,omitempty" json:"endDate,omitempty"`
+	NextRun   *time.Time      `bson:"nextRun,omitempty" json:"nextRun,omitempty"`
+	CreatedBy string          `bson:"createdBy" json:"createdBy"`
+	CreatedAt time.Time       `bson:"createdAt" json:"createdAt"`
+}
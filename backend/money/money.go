@@ -0,0 +1,233 @@
+// Package money provides exact arithmetic on monetary amounts.
+//
+// Amounts are stored as integer minor units (cents) so that sums and splits
+// never accumulate floating point drift. In JSON they are still written as
+// plain decimal numbers (e.g. 12.34) to stay compatible with existing clients.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/x/bsonx/bsoncore"
+)
+
+// Scale is the number of minor units in one major unit
+const Scale = 100
+
+// Amount is a monetary amount expressed in minor units
+type Amount int64
+
+var (
+	// ErrInvalidAmount is returned when a value cannot be parsed as an amount
+	ErrInvalidAmount = errors.New("invalid amount")
+	// ErrTooPrecise is returned when a value has more than two decimal places
+	ErrTooPrecise = errors.New("amount has more than two decimal places")
+)
+
+// FromFloat converts a floating point major-unit value to an Amount,
+// rounding half away from zero to the nearest minor unit
+func FromFloat(f float64) Amount {
+	return Amount(math.Round(f * Scale))
+}
+
+// decimalPattern matches a plain decimal with at most two places, and
+// precisePattern one with more. Anything else, such as "1/2" or "1e3", isn't
+// an amount.
+var (
+	decimalPattern = regexp.MustCompile(`^([+-]?)(\d+)(?:\.(\d{1,2}))?$`)
+	precisePattern = regexp.MustCompile(`^[+-]?\d+\.\d+$`)
+)
+
+// Parse parses a decimal string such as "12", "12.5" or "-0.01"
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	m := decimalPattern.FindStringSubmatch(s)
+	if m == nil {
+		if precisePattern.MatchString(s) {
+			return 0, ErrTooPrecise
+		}
+		return 0, ErrInvalidAmount
+	}
+
+	// Pad the fraction to two places, so "12.5" reads as 1250 cents
+	v, err := strconv.ParseInt(m[2]+(m[3] + "00")[:2], 10, 64)
+	if err != nil {
+		return 0, ErrInvalidAmount
+	}
+	if m[1] == "-" {
+		v = -v
+	}
+	return Amount(v), nil
+}
+
+// Float64 returns the amount in major units as a float
+func (a Amount) Float64() float64 {
+	return float64(a) / Scale
+}
+
+// String formats the amount as a decimal with two places, e.g. "-12.30"
+func (a Amount) String() string {
+	sign := ""
+	v := int64(a)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/Scale, v%Scale)
+}
+
+// MarshalJSON writes the amount as a JSON number in major units
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON accepts a JSON number or a quoted decimal string
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	}
+
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// MarshalBSONValue stores the amount as a 64-bit integer of minor units
+func (a Amount) MarshalBSONValue() (bsontype.Type, []byte, error) {
+	return bsontype.Int64, bsoncore.AppendInt64(nil, int64(a)), nil
+}
+
+// UnmarshalBSONValue decodes an amount from MongoDB.
+//
+// Amounts written by this package are always int64 minor units. Documents
+// created before amounts were stored as integers hold a double (or an int32
+// written by the old Node.js backend) in major units; those are converted on
+// read so legacy data keeps working until it is rewritten.
+func (a *Amount) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	v := bsoncore.Value{Type: t, Data: data}
+
+	switch t {
+	case bsontype.Int64:
+		*a = Amount(v.Int64())
+	case bsontype.Int32:
+		*a = Amount(int64(v.Int32()) * Scale)
+	case bsontype.Double:
+		*a = FromFloat(v.Double())
+	case bsontype.Null, bsontype.Undefined:
+		*a = 0
+	default:
+		return fmt.Errorf("cannot decode BSON %s into money.Amount", t)
+	}
+	return nil
+}
+
+// Split divides total into n parts that sum exactly to total.
+//
+// When the total does not divide evenly, the leftover minor units are handed
+// out one at a time to the first parts, so the result is deterministic for a
+// given participant order.
+func Split(total Amount, n int) []Amount {
+	if n <= 0 {
+		return nil
+	}
+
+	sign := Amount(1)
+	if total < 0 {
+		sign = -1
+		total = -total
+	}
+
+	base := total / Amount(n)
+	remainder := int(total % Amount(n))
+
+	parts := make([]Amount, n)
+	for i := range parts {
+		parts[i] = base
+		if i < remainder {
+			parts[i]++
+		}
+		parts[i] *= sign
+	}
+	return parts
+}
+
+// Allocate divides total in proportion to weights, returning parts that sum
+// exactly to total.
+//
+// Each part first receives the rounded-down proportional amount. The leftover
+// minor units then go one at a time to the parts with the largest dropped
+// fractions, with ties resolved in favour of earlier parts. All weights must
+// be non-negative and at least one must be positive.
+func Allocate(total Amount, weights []int64) []Amount {
+	var sum int64
+	for _, w := range weights {
+		if w < 0 {
+			return nil
+		}
+		sum += w
+	}
+	if sum <= 0 {
+		return nil
+	}
+
+	sign := Amount(1)
+	if total < 0 {
+		sign = -1
+		total = -total
+	}
+
+	parts := make([]Amount, len(weights))
+	remainders := make([]*big.Int, len(weights))
+	allocated := Amount(0)
+
+	bigTotal := big.NewInt(int64(total))
+	bigSum := big.NewInt(sum)
+	for i, w := range weights {
+		q, r := new(big.Int).QuoRem(new(big.Int).Mul(bigTotal, big.NewInt(w)), bigSum, new(big.Int))
+		parts[i] = Amount(q.Int64())
+		remainders[i] = r
+		allocated += parts[i]
+	}
+
+	order := make([]int, len(weights))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]].Cmp(remainders[order[b]]) > 0
+	})
+
+	for k := 0; allocated < total; k++ {
+		parts[order[k%len(order)]]++
+		allocated++
+	}
+
+	for i := range parts {
+		parts[i] *= sign
+	}
+	return parts
+}
+
+// Sum adds up a list of amounts
+func Sum(amounts ...Amount) Amount {
+	var total Amount
+	for _, a := range amounts {
+		total += a
+	}
+	return total
+}
@@ -0,0 +1,145 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+		err  error
+	}{
+		{"12", 1200, nil},
+		{"12.5", 1250, nil},
+		{"12.34", 1234, nil},
+		{"-0.01", -1, nil},
+		{"+3.10", 310, nil},
+		{"0", 0, nil},
+		{" 7.25 ", 725, nil},
+		{"92233720368547758.07", 9223372036854775807, nil},
+		{"12.345", 0, ErrTooPrecise},
+		{"0.001", 0, ErrTooPrecise},
+		{"", 0, ErrInvalidAmount},
+		{"abc", 0, ErrInvalidAmount},
+		{"1/2", 0, ErrInvalidAmount},
+		{"1e3", 0, ErrInvalidAmount},
+		{"1E-2", 0, ErrInvalidAmount},
+		{"0x10", 0, ErrInvalidAmount},
+		{".5", 0, ErrInvalidAmount},
+		{"5.", 0, ErrInvalidAmount},
+		{"1,000", 0, ErrInvalidAmount},
+		{"--1", 0, ErrInvalidAmount},
+		{"92233720368547758.08", 0, ErrInvalidAmount},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.in)
+		if err != tt.err || got != tt.want {
+			t.Errorf("Parse(%q) = %v, %v; want %v, %v", tt.in, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestAmountJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want Amount
+		ok   bool
+	}{
+		{`12.5`, 1250, true},
+		{`"12.50"`, 1250, true},
+		{`-3`, -300, true},
+		{`1e3`, 0, false},
+		{`"1/2"`, 0, false},
+		{`0.125`, 0, false},
+	}
+
+	for _, tt := range tests {
+		var got Amount
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("unmarshalling %s = %v, %v; want %v and ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+
+	out, err := json.Marshal(Amount(-1205))
+	if err != nil || string(out) != "-12.05" {
+		t.Errorf("marshalling -12.05 = %s, %v", out, err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		total Amount
+		n     int
+		want  []Amount
+	}{
+		{900, 3, []Amount{300, 300, 300}},
+		{1000, 3, []Amount{334, 333, 333}},
+		{1001, 3, []Amount{334, 334, 333}},
+		{2, 3, []Amount{1, 1, 0}},
+		{-1000, 3, []Amount{-334, -333, -333}},
+		{0, 2, []Amount{0, 0}},
+		{1000, 1, []Amount{1000}},
+		{1000, 0, nil},
+	}
+
+	for _, tt := range tests {
+		got := Split(tt.total, tt.n)
+		if !equalAmounts(got, tt.want) {
+			t.Errorf("Split(%v, %d) = %v, want %v", tt.total, tt.n, got, tt.want)
+		}
+		if got != nil && Sum(got...) != tt.total {
+			t.Errorf("Split(%v, %d) sums to %v", tt.total, tt.n, Sum(got...))
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   Amount
+		weights []int64
+		want    []Amount
+	}{
+		{"even", 1000, []int64{1, 1}, []Amount{500, 500}},
+		{"proportional", 1000, []int64{1, 3}, []Amount{250, 750}},
+		// 333.33 each; the cent left over goes to the first of the tie
+		{"tie goes to the earlier part", 1000, []int64{1, 1, 1}, []Amount{334, 333, 333}},
+		// 142.857, 285.714 and 571.428: the largest fractions get the cents
+		{"largest remainder", 1000, []int64{1, 2, 4}, []Amount{143, 286, 571}},
+		{"zero weight gets nothing", 1000, []int64{0, 1, 1}, []Amount{0, 500, 500}},
+		{"negative total", -1000, []int64{1, 2, 4}, []Amount{-143, -286, -571}},
+		{"negative total with a tie", -100, []int64{1, 1, 1}, []Amount{-34, -33, -33}},
+		{"zero total", 0, []int64{1, 2}, []Amount{0, 0}},
+		{"no weight", 1000, []int64{0, 0}, nil},
+		{"negative weight", 1000, []int64{1, -1}, nil},
+		{"no parts", 1000, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Allocate(tt.total, tt.weights)
+			if !equalAmounts(got, tt.want) {
+				t.Errorf("Allocate(%v, %v) = %v, want %v", tt.total, tt.weights, got, tt.want)
+			}
+			if got != nil && Sum(got...) != tt.total {
+				t.Errorf("Allocate(%v, %v) sums to %v", tt.total, tt.weights, Sum(got...))
+			}
+		})
+	}
+}
+
+func equalAmounts(a, b []Amount) bool {
+	if (a == nil) != (b == nil) || len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
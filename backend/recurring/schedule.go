@@ -0,0 +1,118 @@
+// Package recurring computes the schedules of recurring expenses and runs
+// the scheduler that adds them to their groups when they fall due.
+package recurring
+
+import (
+	"split-it/backend/models"
+	"strings"
+	"time"
+)
+
+// expenseIDPrefix starts the ID of every expense the scheduler adds
+const expenseIDPrefix = "rec-"
+
+// ValidFrequency reports whether a frequency is supported
+func ValidFrequency(f models.Frequency) bool {
+	switch f {
+	case models.FrequencyDaily, models.FrequencyWeekly, models.FrequencyMonthly, models.FrequencyYearly:
+		return true
+	}
+	return false
+}
+
+// NextRun returns the first run of a schedule at or after from, or nil if
+// the schedule ends before then
+func NextRun(r models.RecurringExpense, from time.Time) *time.Time {
+	n := estimate(r, from)
+	run := occurrence(r, n)
+	for run.Before(from) {
+		n++
+		run = occurrence(r, n)
+	}
+
+	if r.EndDate != nil && !run.Before(*r.EndDate) {
+		return nil
+	}
+	return &run
+}
+
+// ExpenseID is the ID of the expense created by the run of a recurring
+// expense on the given date. Runs are at least a day apart, so the day
+// alone tells them apart, and adding the same run twice fails.
+func ExpenseID(r models.RecurringExpense, run time.Time) string {
+	return expenseIDPrefix + r.ID + "-" + run.UTC().Format("20060102")
+}
+
+// ReservedExpenseID reports whether an expense ID has the form of the IDs
+// the scheduler gives its runs. Clients can't use such IDs, or one could
+// take a run's ID before the scheduler gets to it.
+func ReservedExpenseID(id string) bool {
+	return strings.HasPrefix(id, expenseIDPrefix)
+}
+
+// Backdated reports whether a schedule starts more than one interval
+// before now, so that starting it would add several past runs at once
+func Backdated(r models.RecurringExpense, now time.Time) bool {
+	return occurrence(r, 1).Before(now)
+}
+
+// occurrence returns the nth run of a schedule, counting from 0 at the
+// start date. Runs are computed from the start date rather than from each
+// other so that a run moved to the end of a short month doesn't pull the
+// later ones with it.
+func occurrence(r models.RecurringExpense, n int) time.Time {
+	start := r.StartDate.UTC()
+	steps := n * interval(r)
+
+	switch r.Frequency {
+	case models.FrequencyWeekly:
+		return start.AddDate(0, 0, 7*steps)
+	case models.FrequencyMonthly:
+		return addMonths(start, steps)
+	case models.FrequencyYearly:
+		return addMonths(start, 12*steps)
+	}
+	return start.AddDate(0, 0, steps)
+}
+
+// estimate returns a run number whose run is no later than from, close
+// enough that NextRun only has a few runs to step through
+func estimate(r models.RecurringExpense, from time.Time) int {
+	start := r.StartDate.UTC()
+	from = from.UTC()
+	if !from.After(start) {
+		return 0
+	}
+
+	var n int
+	switch r.Frequency {
+	case models.FrequencyDaily:
+		n = int(from.Sub(start)/(24*time.Hour)) / interval(r)
+	case models.FrequencyWeekly:
+		n = int(from.Sub(start)/(7*24*time.Hour)) / interval(r)
+	case models.FrequencyMonthly:
+		n = monthsBetween(start, from)/interval(r) - 1
+	case models.FrequencyYearly:
+		n = monthsBetween(start, from)/(12*interval(r)) - 1
+	}
+	return max(n, 0)
+}
+
+// interval returns the number of units between runs, at least 1
+func interval(r models.RecurringExpense) int {
+	return max(r.Interval, 1)
+}
+
+// addMonths moves a time by whole months, keeping its day of the month
+// unless the target month is shorter, in which case it lands on the last day
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	last := first.AddDate(0, 1, -1).Day()
+	return first.AddDate(0, 0, min(day, last)-1)
+}
+
+// monthsBetween counts the calendar months from one time to a later one
+func monthsBetween(from, to time.Time) int {
+	return (to.Year()-from.Year())*12 + int(to.Month()-from.Month())
+}
@@ -0,0 +1,243 @@
+package recurring
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"split-it/backend/fx"
+	"split-it/backend/models"
+	"split-it/backend/store"
+	"strconv"
+	"time"
+)
+
+const (
+	// PollInterval is how often the scheduler looks for due expenses
+	PollInterval = time.Minute
+	// batchSize is the number of due recurring expenses fetched at a time
+	batchSize = 100
+	// maxCatchUp bounds the runs made for one recurring expense per batch,
+	// so a long-overdue daily schedule can't hold up the others
+	maxCatchUp = 366
+)
+
+// Clock tells the scheduler the time and when to look again. Tests can
+// drive the scheduler with a fake clock.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+// SystemClock is the real clock
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time                         { return time.Now() }
+func (SystemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Scheduler adds recurring expenses to their groups as they fall due.
+//
+// Everything it needs to know is in the store, so a restart picks up where
+// it left off and runs missed while it was down are made on the next pass.
+// A run's expense has an ID derived from the run's date, so if adding it
+// succeeds but moving the schedule on doesn't, retrying the run finds it
+// already added instead of adding it again. Several instances can run at
+// once: only one of them moves a schedule on from a given run.
+//
+// Runs that fall due while their group is in the trash are skipped, and so
+// are runs in a foreign currency that no exchange rate is known for on the
+// day. Runs that are added, and runs skipped for want of a rate, are
+// recorded in their group's activity log.
+type Scheduler struct {
+	groups    store.GroupStore
+	recurring store.RecurringStore
+	trash     store.TrashStore
+	activity  store.ActivityStore
+	rates     fx.Provider
+	clock     Clock
+}
+
+// NewScheduler returns a scheduler. rates, which may be nil, fills in the
+// exchange rate of runs in a foreign currency whose template has none.
+func NewScheduler(groups store.GroupStore, recurring store.RecurringStore, trash store.TrashStore, activity store.ActivityStore, rates fx.Provider, clock Clock) *Scheduler {
+	return &Scheduler{groups: groups, recurring: recurring, trash: trash, activity: activity, rates: rates, clock: clock}
+}
+
+// Run makes due runs every PollInterval until the context is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		if _, err := s.RunDue(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("⚠️  Recurring expenses: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.clock.After(PollInterval):
+		}
+	}
+}
+
+// RunDue makes every run that is due by now and returns the number of
+// expenses added. A recurring expense that fails is left due and retried
+// on the next call; the others still run.
+func (s *Scheduler) RunDue(ctx context.Context) (int, error) {
+	now := s.clock.Now()
+	added := 0
+	var firstErr error
+
+	for {
+		due, err := s.recurring.DueRecurring(ctx, now, batchSize)
+		if err != nil {
+			return added, err
+		}
+
+		progress := false
+		for _, r := range due {
+			n, moved, err := s.catchUp(ctx, r, now)
+			added += n
+			progress = progress || moved
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+
+		// A full batch may have more behind it, unless nothing in it could
+		// be moved on, in which case the same batch would come back
+		if len(due) < batchSize || !progress {
+			return added, firstErr
+		}
+	}
+}
+
+// catchUp makes the due runs of one recurring expense, reporting how many
+// expenses it added and whether its schedule moved on
+func (s *Scheduler) catchUp(ctx context.Context, r models.RecurringExpense, now time.Time) (int, bool, error) {
+	groupID := r.GroupID
+	group, err := s.groups.GetGroup(ctx, groupID)
+	if err == store.ErrNotFound {
+		if _, err := s.trash.GetTrashedGroup(ctx, groupID); err == nil {
+			moved, err := s.skip(ctx, r, now)
+			return 0, moved, err
+		} else if err != store.ErrNotFound {
+			return 0, false, err
+		}
+
+		// The group is gone; its recurring expenses normally go with it,
+		// but a delete that was cut short can leave them behind
+		return 0, false, s.recurring.DeleteRecurring(ctx, groupID, r.ID)
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	added, moved := 0, false
+	for i := 0; i < maxCatchUp && r.NextRun != nil && !r.NextRun.After(now); i++ {
+		due := *r.NextRun
+
+		// A day without a rate won't get one later, so retrying the run
+		// would hold the schedule up for good; it is skipped instead.
+		// Other failures, like the rates API being down, are retried.
+		expense := r.Template.Expense(ExpenseID(r, due), due)
+		noRate := false
+		if err := fx.ToBase(ctx, s.rates, &expense, group.BaseCurrency()); errors.Is(err, fx.ErrNoRate) {
+			noRate = true
+		} else if err != nil {
+			return added, moved, fmt.Errorf("recurring expense %s in group %s: exchange rate: %w", r.ID, groupID, err)
+		} else {
+			isNew, err := s.addRun(ctx, groupID, &expense)
+			if err != nil {
+				return added, moved, fmt.Errorf("recurring expense %s in group %s: %w", r.ID, groupID, err)
+			}
+			if isNew {
+				added++
+				s.recordRun(ctx, r, models.ActivityRecurringRun, expense)
+			}
+		}
+
+		next := NextRun(r, due.Add(time.Nanosecond))
+		err := s.recurring.AdvanceRecurring(ctx, groupID, r.ID, due, next)
+		if err == store.ErrConflict || err == store.ErrNotFound {
+			// Someone else moved it on, edited or deleted it
+			return added, true, nil
+		} else if err != nil {
+			return added, moved, err
+		}
+		// Only the instance that moved the schedule on records the skip
+		if noRate {
+			s.recordRun(ctx, r, models.ActivityRecurringSkipped, expense)
+		}
+		r.NextRun = next
+		moved = true
+	}
+	return added, moved, nil
+}
+
+// maxRunIDs bounds the IDs tried for one run
+const maxRunIDs = 10
+
+// addRun adds the expense for a run, reporting false if an earlier attempt
+// already added it. Run IDs only depend on the recurring expense's ID and
+// the run's date, so an expense with the ID may instead be a run of an
+// earlier recurring expense that had the same ID. The run then gets the
+// first ID with a "-2", "-3"... suffix that isn't taken by another expense,
+// and expense is updated to match.
+func (s *Scheduler) addRun(ctx context.Context, groupID string, expense *models.Expense) (bool, error) {
+	id := expense.ID
+	for n := 2; n <= maxRunIDs+1; n++ {
+		err := s.groups.AddExpense(ctx, groupID, *expense)
+		if err != store.ErrDuplicate {
+			return err == nil, err
+		}
+
+		existing, err := s.groups.GetExpense(ctx, groupID, expense.ID)
+		if err != nil {
+			return false, err
+		}
+		if sameRun(existing, *expense) {
+			return false, nil
+		}
+		expense.ID = id + "-" + strconv.Itoa(n)
+	}
+	return false, fmt.Errorf("expense IDs %s to %s are all taken by other expenses", id, expense.ID)
+}
+
+// sameRun reports whether a stored expense is the given run of a recurring
+// expense. The run's own fields are compared; the exchange rate isn't, since
+// it may have been looked up again since.
+func sameRun(stored, run models.Expense) bool {
+	return stored.Date.Equal(run.Date) &&
+		stored.Description == run.Description &&
+		stored.Amount == run.Amount &&
+		stored.Currency == run.Currency &&
+		stored.PaidBy == run.PaidBy
+}
+
+// recordRun adds a run to its group's activity log. The run has been added
+// or skipped by then, so failing to record it is only logged.
+func (s *Scheduler) recordRun(ctx context.Context, r models.RecurringExpense, action models.ActivityAction, expense models.Expense) {
+	activity := models.Activity{
+		ID:        strconv.FormatInt(time.Now().UnixNano(), 10),
+		GroupID:   r.GroupID,
+		Action:    action,
+		TargetID:  r.ID,
+		After:     &models.ActivitySnapshot{Expense: &expense},
+		CreatedAt: s.clock.Now(),
+	}
+	if err := s.activity.AddActivity(ctx, activity); err != nil {
+		log.Printf("⚠️  Recording run of recurring expense %s in group %s: %v", r.ID, r.GroupID, err)
+	}
+}
+
+// skip moves a recurring expense on to its first run after now without
+// adding the runs in between, reporting whether its schedule moved on
+func (s *Scheduler) skip(ctx context.Context, r models.RecurringExpense, now time.Time) (bool, error) {
+	next := NextRun(r, now.Add(time.Nanosecond))
+	err := s.recurring.AdvanceRecurring(ctx, r.GroupID, r.ID, *r.NextRun, next)
+	if err == store.ErrConflict || err == store.ErrNotFound {
+		// Someone else moved it on, edited or deleted it
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("recurring expense %s in group %s: %w", r.ID, r.GroupID, err)
+	}
+	return true, nil
+}
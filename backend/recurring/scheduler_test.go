@@ -0,0 +1,316 @@
+package recurring_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"split-it/backend/fx"
+	"split-it/backend/models"
+	"split-it/backend/recurring"
+	"split-it/backend/store"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when told to, and never wakes the scheduler
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time                       { return c.now }
+func (c *fakeClock) After(time.Duration) <-chan time.Time { return nil }
+
+// newScheduler starts a scheduler afresh on the store, as a restart would
+func newScheduler(s store.Store, clock recurring.Clock) *recurring.Scheduler {
+	return recurring.NewScheduler(s, s, s, s, nil, clock)
+}
+
+func TestSchedulerRestarts(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	group := models.Group{
+		GroupID:  "g1",
+		Name:     "Flat",
+		Currency: "USD",
+		Members: []models.Member{
+			{ID: "m1", Name: "Alice", UserID: "u1", Role: models.RoleOwner},
+			{ID: "m2", Name: "Bob"},
+		},
+		UserID:    "u1",
+		Version:   1,
+		CreatedAt: start,
+		UpdatedAt: start,
+	}
+	if err := s.CreateGroup(ctx, group); err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+
+	r := models.RecurringExpense{
+		ID:      "r1",
+		GroupID: "g1",
+		Template: models.NewExpenseTemplate(models.Expense{
+			Description:  "Coffee",
+			Amount:       450,
+			PaidBy:       "m1",
+			Participants: []string{"m1", "m2"},
+		}),
+		Frequency: models.FrequencyDaily,
+		Interval:  1,
+		StartDate: start,
+		NextRun:   &start,
+		CreatedBy: "u1",
+		CreatedAt: start,
+	}
+	if err := s.CreateRecurring(ctx, r); err != nil {
+		t.Fatalf("CreateRecurring: %v", err)
+	}
+
+	runDue := func(clock *fakeClock, want int) {
+		t.Helper()
+		added, err := newScheduler(s, clock).RunDue(ctx)
+		if err != nil {
+			t.Fatalf("RunDue at %v: %v", clock.now, err)
+		}
+		if added != want {
+			t.Errorf("RunDue at %v added %d expenses, want %d", clock.now, added, want)
+		}
+	}
+	expenseIDs := func() []string {
+		t.Helper()
+		expenses, err := s.GroupExpenses(ctx, "g1")
+		if err != nil {
+			t.Fatalf("GroupExpenses: %v", err)
+		}
+		var ids []string
+		for _, e := range expenses {
+			ids = append(ids, e.ID)
+		}
+		slices.Sort(ids)
+		return ids
+	}
+	nextRun := func() time.Time {
+		t.Helper()
+		stored, err := s.GetRecurring(ctx, "g1", "r1")
+		if err != nil {
+			t.Fatalf("GetRecurring: %v", err)
+		}
+		if stored.NextRun == nil {
+			t.Fatalf("schedule has ended")
+		}
+		return *stored.NextRun
+	}
+
+	// Two and a half days in, the first three runs are due
+	clock := &fakeClock{now: start.Add(60 * time.Hour)}
+	runDue(clock, 3)
+	want := []string{"rec-r1-20240301", "rec-r1-20240302", "rec-r1-20240303"}
+	if got := expenseIDs(); !slices.Equal(got, want) {
+		t.Fatalf("expenses = %v, want %v", got, want)
+	}
+	if got := nextRun(); !got.Equal(start.Add(72 * time.Hour)) {
+		t.Errorf("next run = %v, want %v", got, start.Add(72*time.Hour))
+	}
+
+	// Restarting at the same time adds nothing
+	runDue(clock, 0)
+
+	// A process that died after adding its runs but before moving the
+	// schedule on leaves them due; the next one finds them already added
+	due := nextRun()
+	if err := s.AdvanceRecurring(ctx, "g1", "r1", due, &start); err != nil {
+		t.Fatalf("AdvanceRecurring: %v", err)
+	}
+	runDue(clock, 0)
+	if got := expenseIDs(); !slices.Equal(got, want) {
+		t.Errorf("expenses after retrying added runs = %v, want %v", got, want)
+	}
+	if got := nextRun(); !got.Equal(due) {
+		t.Errorf("next run after retrying added runs = %v, want %v", got, due)
+	}
+
+	// Runs missed while down are made on the next start, once each
+	clock = &fakeClock{now: clock.now.Add(48 * time.Hour)}
+	runDue(clock, 2)
+	runDue(clock, 0)
+	want = append(want, "rec-r1-20240304", "rec-r1-20240305")
+	if got := expenseIDs(); !slices.Equal(got, want) {
+		t.Errorf("expenses after the restart = %v, want %v", got, want)
+	}
+
+	// Each run added is logged once, with no one as its actor
+	page, err := s.ListActivity(ctx, "g1", store.ActivityQuery{Limit: store.MaxPageSize})
+	if err != nil {
+		t.Fatalf("ListActivity: %v", err)
+	}
+	var logged []string
+	for _, a := range page.Activity {
+		if a.Action != models.ActivityRecurringRun || a.TargetID != "r1" || a.Actor != "" || a.After == nil || a.After.Expense == nil {
+			t.Errorf("unexpected activity %+v", a)
+			continue
+		}
+		logged = append(logged, a.After.Expense.ID)
+	}
+	slices.Sort(logged)
+	if !slices.Equal(logged, want) {
+		t.Errorf("runs logged = %v, want %v", logged, want)
+	}
+}
+
+// dailyRates knows the rate of one currency pair on some days. Other days
+// have no rate, except those marked down, where the lookup fails.
+type dailyRates struct {
+	rates map[string]float64
+	down  map[string]bool
+}
+
+func (p dailyRates) Rate(ctx context.Context, base, quote string, date time.Time) (float64, error) {
+	day := date.UTC().Format("2006-01-02")
+	if p.down[day] {
+		return 0, errors.New("rates API is down")
+	}
+	if rate, ok := p.rates[day]; ok {
+		return rate, nil
+	}
+	return 0, fx.ErrNoRate
+}
+
+// createDaily creates a group and a daily recurring expense in it that
+// starts at start
+func createDaily(t *testing.T, s store.Store, start time.Time, template models.Expense) {
+	t.Helper()
+	ctx := context.Background()
+
+	group := models.Group{
+		GroupID:   "g1",
+		Name:      "Flat",
+		Currency:  "USD",
+		Members:   []models.Member{{ID: "m1", Name: "Alice", UserID: "u1", Role: models.RoleOwner}, {ID: "m2", Name: "Bob"}},
+		UserID:    "u1",
+		Version:   1,
+		CreatedAt: start,
+		UpdatedAt: start,
+	}
+	if err := s.CreateGroup(ctx, group); err != nil {
+		t.Fatalf("CreateGroup: %v", err)
+	}
+
+	r := models.RecurringExpense{
+		ID:        "r1",
+		GroupID:   "g1",
+		Template:  models.NewExpenseTemplate(template),
+		Frequency: models.FrequencyDaily,
+		Interval:  1,
+		StartDate: start,
+		NextRun:   &start,
+		CreatedBy: "u1",
+		CreatedAt: start,
+	}
+	if err := s.CreateRecurring(ctx, r); err != nil {
+		t.Fatalf("CreateRecurring: %v", err)
+	}
+}
+
+func TestSchedulerSkipsRunsWithoutRate(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	createDaily(t, s, start, models.Expense{
+		Description:  "Croissants",
+		Amount:       500,
+		Currency:     "EUR",
+		PaidBy:       "m1",
+		Participants: []string{"m1", "m2"},
+	})
+
+	rates := dailyRates{
+		rates: map[string]float64{"2024-03-01": 1.1, "2024-03-03": 1.2},
+		down:  map[string]bool{"2024-03-04": true},
+	}
+
+	// The 2nd has no rate and is skipped; the runs around it go ahead
+	clock := &fakeClock{now: start.Add(50 * time.Hour)}
+	added, err := recurring.NewScheduler(s, s, s, s, rates, clock).RunDue(ctx)
+	if err != nil || added != 2 {
+		t.Fatalf("RunDue = %d, %v; want 2 runs added", added, err)
+	}
+	expenses, err := s.GroupExpenses(ctx, "g1")
+	if err != nil {
+		t.Fatalf("GroupExpenses: %v", err)
+	}
+	if len(expenses) != 2 || expenses[0].ID != "rec-r1-20240301" || expenses[0].BaseAmount != 550 || expenses[1].ID != "rec-r1-20240303" || expenses[1].BaseAmount != 600 {
+		t.Errorf("expenses = %+v", expenses)
+	}
+
+	page, err := s.ListActivity(ctx, "g1", store.ActivityQuery{Limit: store.MaxPageSize})
+	if err != nil {
+		t.Fatalf("ListActivity: %v", err)
+	}
+	var skipped []string
+	for _, a := range page.Activity {
+		if a.Action == models.ActivityRecurringSkipped && a.TargetID == "r1" && a.After != nil && a.After.Expense != nil {
+			skipped = append(skipped, a.After.Expense.ID)
+		}
+	}
+	if !slices.Equal(skipped, []string{"rec-r1-20240302"}) {
+		t.Errorf("skipped runs logged = %v, want [rec-r1-20240302]", skipped)
+	}
+
+	// A lookup that fails for another reason leaves the run due
+	clock.now = clock.now.Add(24 * time.Hour)
+	if added, err := recurring.NewScheduler(s, s, s, s, rates, clock).RunDue(ctx); err == nil || added != 0 {
+		t.Errorf("RunDue with the rates API down = %d, %v; want an error", added, err)
+	}
+	stored, err := s.GetRecurring(ctx, "g1", "r1")
+	if err != nil {
+		t.Fatalf("GetRecurring: %v", err)
+	}
+	if want := start.Add(72 * time.Hour); stored.NextRun == nil || !stored.NextRun.Equal(want) {
+		t.Errorf("next run = %v, want %v", stored.NextRun, want)
+	}
+}
+
+func TestSchedulerRunIDTaken(t *testing.T) {
+	ctx := context.Background()
+	s := store.NewMemoryStore()
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	createDaily(t, s, start, models.Expense{
+		Description:  "Coffee",
+		Amount:       450,
+		PaidBy:       "m1",
+		Participants: []string{"m1", "m2"},
+	})
+
+	// A run of an earlier recurring expense that had the same ID
+	earlier := models.Expense{ID: "rec-r1-20240301", Description: "Rent", Amount: 90000, Currency: "USD", ExchangeRate: 1, BaseAmount: 90000, PaidBy: "m2", Participants: []string{"m1", "m2"}, Date: start}
+	if err := s.AddExpense(ctx, "g1", earlier); err != nil {
+		t.Fatalf("AddExpense: %v", err)
+	}
+
+	clock := &fakeClock{now: start.Add(time.Hour)}
+	if added, err := newScheduler(s, clock).RunDue(ctx); err != nil || added != 1 {
+		t.Fatalf("RunDue = %d, %v; want 1 run added", added, err)
+	}
+
+	// Retrying the run after a crash finds it under the ID it was given
+	if err := s.AdvanceRecurring(ctx, "g1", "r1", start.Add(24*time.Hour), &start); err != nil {
+		t.Fatalf("AdvanceRecurring: %v", err)
+	}
+	if added, err := newScheduler(s, clock).RunDue(ctx); err != nil || added != 0 {
+		t.Fatalf("RunDue again = %d, %v; want nothing added", added, err)
+	}
+
+	expenses, err := s.GroupExpenses(ctx, "g1")
+	if err != nil {
+		t.Fatalf("GroupExpenses: %v", err)
+	}
+	var got []string
+	for _, e := range expenses {
+		got = append(got, e.ID+" "+e.Description)
+	}
+	slices.Sort(got)
+	if want := []string{"rec-r1-20240301 Rent", "rec-r1-20240301-2 Coffee"}; !slices.Equal(got, want) {
+		t.Errorf("expenses = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,126 @@
+package routes
+
+import (
+	"context"
+	"log"
+	"split-it/backend/middleware"
+	"split-it/backend/models"
+	"split-it/backend/store"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var activityStore store.ActivityStore
+
+func getActivity(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+
+	query := store.ActivityQuery{
+		Cursor: c.Query("cursor"),
+		Limit:  c.QueryInt("limit", store.DefaultPageSize),
+	}
+	if query.Limit < 1 || query.Limit > store.MaxPageSize {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Limit must be between 1 and " + strconv.Itoa(store.MaxPageSize),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, status, message := authorizeGroup(ctx, groupId, user, middleware.PermViewGroup); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	page, err := activityStore.ListActivity(ctx, groupId, query)
+	if err == store.ErrInvalidCursor {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid cursor",
+		})
+	} else if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Group not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error fetching activity",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    page,
+	})
+}
+
+// recordActivity appends an entry to a group's activity log. It is called
+// once a change has been made, so failing to record it is only logged
+// rather than failing the request.
+func recordActivity(ctx context.Context, groupId string, user *middleware.UserContext, action models.ActivityAction, targetId string, before, after *models.ActivitySnapshot) {
+	activity := models.Activity{
+		ID:        strconv.FormatInt(time.Now().UnixNano(), 10),
+		GroupID:   groupId,
+		Actor:     user.UID,
+		ActorName: user.Name,
+		Action:    action,
+		TargetID:  targetId,
+		Before:    before,
+		After:     after,
+		CreatedAt: time.Now(),
+	}
+	if err := activityStore.AddActivity(ctx, activity); err != nil {
+		log.Printf("⚠️  Recording %s activity in group %s: %v", action, groupId, err)
+	}
+}
+
+// groupSnapshot returns the state of a group for the activity log, without
+// its expenses
+func groupSnapshot(g models.Group) *models.ActivitySnapshot {
+	g.Expenses = nil
+	group := toGroupResponse(g)
+	return &models.ActivitySnapshot{Group: &group}
+}
+
+// expenseSnapshot returns the state of an expense for the activity log
+func expenseSnapshot(e models.Expense) *models.ActivitySnapshot {
+	return &models.ActivitySnapshot{Expense: &e}
+}
+
+// recurringSnapshot returns the state of a recurring expense for the
+// activity log
+func recurringSnapshot(r models.RecurringExpense) *models.ActivitySnapshot {
+	return &models.ActivitySnapshot{Recurring: &r}
+}
+
+// paymentSnapshot returns the state of a payment for the activity log
+func paymentSnapshot(p models.Payment) *models.ActivitySnapshot {
+	return &models.ActivitySnapshot{Payment: &p}
+}
+
+// memberSnapshot returns the state of a member for the activity log
+func memberSnapshot(m models.Member) *models.ActivitySnapshot {
+	return &models.ActivitySnapshot{Member: &m}
+}
+
+// attachmentSnapshot returns the state of an attachment for the activity
+// log
+func attachmentSnapshot(a models.Attachment) *models.ActivitySnapshot {
+	return &models.ActivitySnapshot{Attachment: &a}
+}
@@ -0,0 +1,492 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"slices"
+	"split-it/backend/middleware"
+	"split-it/backend/models"
+	"split-it/backend/store"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	// maxAttachmentSize is the largest file that can be attached, in bytes
+	maxAttachmentSize = 10 << 20
+	// maxUploadSize is the largest upload request, leaving room for the
+	// multipart envelope around an attachment
+	maxUploadSize = maxAttachmentSize + 1<<20
+	// maxAttachments is the number of files an expense can have attached
+	maxAttachments = 10
+	// maxFilenameLength is the longest attachment name kept, in characters
+	maxFilenameLength = 255
+	// attachmentURLTTL is how long a download link works for
+	attachmentURLTTL = 15 * time.Minute
+)
+
+// attachmentTypes are the content types that can be attached: photos and
+// PDFs. Types are detected from the file's contents; what the client claims
+// is ignored.
+var attachmentTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp", "application/pdf"}
+
+var (
+	blobStore store.BlobStore
+	// attachmentURLKey signs download links; without it none are handed out
+	attachmentURLKey []byte
+)
+
+// SetupAttachmentRoutes configures the route behind attachment download
+// links. The links carry a signature made with urlKey instead of requiring
+// authentication, so they work where no Authorization header can be sent,
+// such as in an <img> tag.
+func SetupAttachmentRoutes(app *fiber.App, groups store.GroupStore, blobs store.BlobStore, urlKey []byte) {
+	groupStore = groups
+	blobStore = blobs
+	attachmentURLKey = urlKey
+
+	app.Get("/api/attachments/:groupId/:expenseId/:attachmentId", downloadLinkedAttachment)
+}
+
+// IsAttachmentUpload reports whether a request is to upload an attachment.
+// Uploads can be larger than other requests, up to maxUploadSize, which
+// their route enforces itself.
+func IsAttachmentUpload(c *fiber.Ctx) bool {
+	parts := strings.Split(strings.Trim(c.Path(), "/"), "/")
+	return c.Method() == fiber.MethodPost && len(parts) == 6 &&
+		parts[0] == "api" && parts[1] == "groups" && parts[3] == "expenses" && parts[5] == "attachments"
+}
+
+func getAttachments(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+	expenseId := c.Params("expenseId")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, status, message := authorizeGroup(ctx, groupId, user, middleware.PermViewGroup); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	expense, err := groupStore.GetExpense(ctx, groupId, expenseId)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Expense not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error fetching attachments",
+		})
+	}
+
+	attachments := expense.Attachments
+	if attachments == nil {
+		attachments = []models.Attachment{}
+	}
+	addAttachmentURLs(c, groupId, expenseId, attachments)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    attachments,
+	})
+}
+
+func addAttachment(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+	expenseId := c.Params("expenseId")
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "A file is required",
+		})
+	}
+	if header.Size == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "The file is empty",
+		})
+	}
+	if header.Size > maxAttachmentSize {
+		return c.Status(fiber.StatusRequestEntityTooLarge).JSON(fiber.Map{
+			"success": false,
+			"message": "Attachments can be at most " + strconv.Itoa(maxAttachmentSize>>20) + " MB",
+		})
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error reading file",
+		})
+	}
+	defer file.Close()
+
+	// Sniffing looks at no more than the first 512 bytes
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error reading file",
+		})
+	}
+	head = head[:n]
+
+	contentType, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	if !slices.Contains(attachmentTypes, contentType) {
+		return c.Status(fiber.StatusUnsupportedMediaType).JSON(fiber.Map{
+			"success": false,
+			"message": "Only JPEG, PNG, GIF and WebP images and PDFs can be attached",
+		})
+	}
+
+	attachment := models.Attachment{
+		ID:          strconv.FormatInt(time.Now().UnixNano(), 10),
+		Filename:    attachmentFilename(header.Filename),
+		ContentType: contentType,
+		Size:        header.Size,
+		UploadedBy:  user.UID,
+		UploadedAt:  time.Now(),
+	}
+
+	// Uploading to a remote blob store can take a while
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	if _, status, message := authorizeGroup(ctx, groupId, user, middleware.PermEditExpenses); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	expense, err := groupStore.GetExpense(ctx, groupId, expenseId)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Expense not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error adding attachment",
+		})
+	}
+
+	if len(expense.Attachments) >= maxAttachments {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "An expense can have at most " + strconv.Itoa(maxAttachments) + " attachments",
+		})
+	}
+
+	key, err := store.AttachmentKey(groupId, expenseId, attachment.ID)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Expenses with this ID can't have attachments",
+		})
+	}
+
+	// The file is stored before it is recorded, so a recorded attachment
+	// always has its contents
+	if err := blobStore.Put(ctx, key, io.MultiReader(bytes.NewReader(head), file), header.Size, contentType); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error saving attachment",
+		})
+	}
+
+	err = groupStore.AddAttachment(ctx, groupId, expenseId, attachment)
+	if err != nil {
+		deleteBlob(key)
+	}
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Expense not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error adding attachment",
+		})
+	}
+
+	recordActivity(ctx, groupId, user, models.ActivityAttachmentAdded, expenseId, nil, attachmentSnapshot(attachment))
+
+	attachment.URL = attachmentURL(c, groupId, expenseId, attachment.ID)
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    attachment,
+	})
+}
+
+func downloadAttachment(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, status, message := authorizeGroup(ctx, groupId, user, middleware.PermViewGroup); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	return sendAttachment(ctx, c, groupId, c.Params("expenseId"), c.Params("attachmentId"))
+}
+
+// downloadLinkedAttachment serves a download link handed out by
+// attachmentURL. The signature stands in for authentication.
+func downloadLinkedAttachment(c *fiber.Ctx) error {
+	groupId := c.Params("groupId")
+	expenseId := c.Params("expenseId")
+	attachmentId := c.Params("attachmentId")
+
+	expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+	signature, hexErr := hex.DecodeString(c.Query("signature"))
+	path, pathErr := attachmentPath(groupId, expenseId, attachmentId)
+	if err != nil || hexErr != nil || pathErr != nil || len(attachmentURLKey) == 0 ||
+		!hmac.Equal(signature, signAttachmentURL(path, expires)) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid download link",
+		})
+	}
+	if time.Now().Unix() > expires {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"success": false,
+			"message": "Download link has expired",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	return sendAttachment(ctx, c, groupId, expenseId, attachmentId)
+}
+
+func deleteAttachment(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+	expenseId := c.Params("expenseId")
+	attachmentId := c.Params("attachmentId")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, status, message := authorizeGroup(ctx, groupId, user, middleware.PermEditExpenses); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	// The attachment as it was, for the activity log
+	var before *models.ActivitySnapshot
+	if expense, err := groupStore.GetExpense(ctx, groupId, expenseId); err == nil {
+		if i := slices.IndexFunc(expense.Attachments, func(a models.Attachment) bool { return a.ID == attachmentId }); i >= 0 {
+			before = attachmentSnapshot(expense.Attachments[i])
+		}
+	}
+
+	err := groupStore.RemoveAttachment(ctx, groupId, expenseId, attachmentId)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Attachment not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error deleting attachment",
+		})
+	}
+
+	// An attachment without a key was never stored
+	if key, err := store.AttachmentKey(groupId, expenseId, attachmentId); err == nil {
+		deleteBlob(key)
+	}
+	recordActivity(ctx, groupId, user, models.ActivityAttachmentDeleted, expenseId, before, nil)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Attachment deleted successfully",
+	})
+}
+
+// sendAttachment responds with the contents of an attachment, as long as
+// it is still attached to its expense
+func sendAttachment(ctx context.Context, c *fiber.Ctx, groupId, expenseId, attachmentId string) error {
+	expense, err := groupStore.GetExpense(ctx, groupId, expenseId)
+	if err != nil && err != store.ErrNotFound {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error fetching attachment",
+		})
+	}
+
+	i := slices.IndexFunc(expense.Attachments, func(a models.Attachment) bool { return a.ID == attachmentId })
+	if i < 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Attachment not found",
+		})
+	}
+	attachment := expense.Attachments[i]
+
+	// The body is streamed after the handler returns, so reading it can't
+	// be bound to the handler's context
+	key, err := store.AttachmentKey(groupId, expenseId, attachmentId)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Attachment not found",
+		})
+	}
+	body, err := blobStore.Get(context.Background(), key)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Attachment not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error fetching attachment",
+		})
+	}
+
+	disposition := mime.FormatMediaType("inline", map[string]string{"filename": attachment.Filename})
+	if disposition == "" {
+		disposition = "inline"
+	}
+	c.Set(fiber.HeaderContentType, attachment.ContentType)
+	c.Set(fiber.HeaderContentDisposition, disposition)
+	c.Set(fiber.HeaderCacheControl, "private, max-age="+strconv.Itoa(int(attachmentURLTTL.Seconds())))
+	return c.SendStream(body, int(attachment.Size))
+}
+
+// attachmentPath returns the path of an attachment's download link
+func attachmentPath(groupId, expenseId, attachmentId string) (string, error) {
+	key, err := store.AttachmentKey(groupId, expenseId, attachmentId)
+	if err != nil {
+		return "", err
+	}
+	return "/api/attachments/" + key, nil
+}
+
+// attachmentURL returns a download link for an attachment that works
+// without authentication until it expires, or "" if links can't be signed
+func attachmentURL(c *fiber.Ctx, groupId, expenseId, attachmentId string) string {
+	path, err := attachmentPath(groupId, expenseId, attachmentId)
+	if err != nil || len(attachmentURLKey) == 0 {
+		return ""
+	}
+
+	expires := time.Now().Add(attachmentURLTTL).Unix()
+	signature := signAttachmentURL(path, expires)
+	return c.BaseURL() + path +
+		"?expires=" + strconv.FormatInt(expires, 10) + "&signature=" + hex.EncodeToString(signature)
+}
+
+// addAttachmentURLs fills in the download links of an expense's attachments
+func addAttachmentURLs(c *fiber.Ctx, groupId, expenseId string, attachments []models.Attachment) {
+	for i := range attachments {
+		attachments[i].URL = attachmentURL(c, groupId, expenseId, attachments[i].ID)
+	}
+}
+
+// signAttachmentURL signs a download link's path and expiry time
+func signAttachmentURL(path string, expires int64) []byte {
+	mac := hmac.New(sha256.New, attachmentURLKey)
+	mac.Write([]byte(path + "\n" + strconv.FormatInt(expires, 10)))
+	return mac.Sum(nil)
+}
+
+// attachmentFilename cleans up the name of an uploaded file, keeping just
+// its base name without control characters, shortened to at most
+// maxFilenameLength characters
+func attachmentFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+
+	if runes := []rune(name); len(runes) > maxFilenameLength {
+		name = string(runes[:maxFilenameLength])
+	}
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
+
+// deleteBlob removes a blob that is no longer referenced. A blob that can't
+// be removed only takes up space, so failures are logged rather than
+// reported to the client.
+func deleteBlob(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := blobStore.Delete(ctx, key); err != nil {
+		log.Printf("⚠️  Deleting attachment %s: %v", key, err)
+	}
+}
@@ -1,34 +1,106 @@
 package routes
 
 import (
+	"bytes"
 	"context"
-	"split-it/backend/config"
+	"encoding/json"
+	"errors"
+	"log"
+	"slices"
+	"split-it/backend/fx"
 	"split-it/backend/middleware"
 	"split-it/backend/models"
+	"split-it/backend/money"
+	"split-it/backend/recurring"
+	"split-it/backend/settlement"
+	"split-it/backend/store"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// SetupGroupRoutes configures group-related routes
-func SetupGroupRoutes(app *fiber.App) {
-	groups := app.Group("/api/groups", middleware.AuthenticateUser)
+var (
+	groupStore     store.GroupStore
+	inviteStore    store.InviteStore
+	recurringStore store.RecurringStore
+	// rateProvider fills in exchange rates clients leave out; nil if none
+	// is configured
+	rateProvider fx.Provider
+)
+
+// SetupGroupRoutes configures group-related routes. Deleted groups and
+// expenses are kept in the trash for retention before they are purged.
+func SetupGroupRoutes(app *fiber.App, groups store.GroupStore, invites store.InviteStore, recurring store.RecurringStore, activity store.ActivityStore, trash store.TrashStore, blobs store.BlobStore, rates fx.Provider, retention time.Duration) {
+	groupStore = groups
+	inviteStore = invites
+	recurringStore = recurring
+	activityStore = activity
+	trashStore = trash
+	trashRetention = retention
+	blobStore = blobs
+	rateProvider = rates
+
+	router := app.Group("/api/groups", middleware.AuthenticateUser)
+
+	// Trashed groups; registered first so "trash" isn't taken for a group ID
+	router.Get("/trash", getTrashedGroups)
 
 	// Group CRUD operations
-	groups.Get("/", getAllGroups)
-	groups.Get("/:groupId", getGroup)
-	groups.Post("/", createGroup)
-	groups.Put("/:groupId", updateGroup)
-	groups.Delete("/:groupId", deleteGroup)
+	router.Get("/", getAllGroups)
+	router.Get("/:groupId", getGroup)
+	router.Post("/", createGroup)
+	router.Put("/:groupId", updateGroup)
+	router.Delete("/:groupId", deleteGroup)
+	router.Post("/:groupId/restore", restoreGroup)
 
 	// Expense operations
-	groups.Post("/:groupId/expenses", addExpense)
-	groups.Delete("/:groupId/expenses/:expenseId", deleteExpense)
+	router.Get("/:groupId/expenses", getExpenses)
+	router.Post("/:groupId/expenses", addExpense)
+	router.Put("/:groupId/expenses/:expenseId", updateExpense)
+	router.Delete("/:groupId/expenses/:expenseId", deleteExpense)
+
+	// Trashed expense operations
+	router.Get("/:groupId/trash", getTrash)
+	router.Post("/:groupId/expenses/:expenseId/restore", restoreExpense)
+
+	// Attachment operations
+	router.Get("/:groupId/expenses/:expenseId/attachments", getAttachments)
+	router.Post("/:groupId/expenses/:expenseId/attachments", middleware.LimitBody(maxUploadSize, nil), addAttachment)
+	router.Get("/:groupId/expenses/:expenseId/attachments/:attachmentId", downloadAttachment)
+	router.Delete("/:groupId/expenses/:expenseId/attachments/:attachmentId", deleteAttachment)
+
+	// Member operations
+	router.Put("/:groupId/members/:memberId/role", updateMemberRole)
+	router.Delete("/:groupId/members/:memberId", removeMember)
+
+	// Invite operations
+	router.Post("/:groupId/invites", createInvite)
+
+	// Payment operations
+	router.Get("/:groupId/payments", getPayments)
+	router.Post("/:groupId/payments", addPayment)
+	router.Delete("/:groupId/payments/:paymentId", deletePayment)
+
+	// Balance and settlement operations
+	router.Get("/:groupId/balances", getBalances)
+	router.Get("/:groupId/settlements", getSettlements)
+
+	// Spending statistics
+	router.Get("/:groupId/stats", getStats)
+
+	// Recurring expense operations
+	router.Get("/:groupId/recurring", getRecurring)
+	router.Post("/:groupId/recurring", addRecurring)
+	router.Put("/:groupId/recurring/:recurringId", updateRecurring)
+	router.Delete("/:groupId/recurring/:recurringId", deleteRecurring)
+
+	// Activity log
+	router.Get("/:groupId/activity", getActivity)
 }
 
 func getAllGroups(c *fiber.Ctx) error {
@@ -40,46 +112,54 @@ func getAllGroups(c *fiber.Ctx) error {
 		})
 	}
 
-	db := config.GetDB()
-	collection := db.Collection("groups")
+	query := store.GroupQuery{Cursor: c.Query("cursor"), Limit: store.DefaultPageSize}
+	if c.Query("limit") != "" {
+		query.Limit = c.QueryInt("limit")
+		if query.Limit < 1 || query.Limit > store.MaxPageSize {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Limit must be between 1 and " + strconv.Itoa(store.MaxPageSize),
+			})
+		}
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}})
-	cursor, err := collection.Find(ctx, bson.M{"userId": user.UID}, opts)
-	if err != nil {
+	page, err := groupStore.ListGroups(ctx, user.UID, query)
+	if err == store.ErrInvalidCursor {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid cursor",
+		})
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"message": "Error fetching groups",
 		})
 	}
-	defer cursor.Close(ctx)
 
-	var groups []models.Group
-	if err = cursor.All(ctx, &groups); err != nil {
+	var data interface{}
+	if c.Query("include") == "expenses" {
+		data, err = fullGroups(ctx, page.Groups)
+	} else {
+		data, err = groupSummaries(ctx, page.Groups, user.UID)
+	}
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
-			"message": "Error decoding groups",
+			"message": "Error fetching groups",
 		})
 	}
 
-	// Transform to response format
-	response := make([]models.GroupResponse, len(groups))
-	for i, g := range groups {
-		response[i] = models.GroupResponse{
-			ID:        g.GroupID,
-			Name:      g.Name,
-			Members:   g.Members,
-			Expenses:  g.Expenses,
-			CreatedAt: g.CreatedAt,
-		}
-	}
-
-	return c.JSON(fiber.Map{
+	response := fiber.Map{
 		"success": true,
-		"data":    response,
-	})
+		"data":    data,
+	}
+	if page.NextCursor != "" {
+		response["nextCursor"] = page.NextCursor
+	}
+	return c.JSON(response)
 }
 
 func getGroup(c *fiber.Ctx) error {
@@ -93,39 +173,39 @@ func getGroup(c *fiber.Ctx) error {
 
 	groupId := c.Params("groupId")
 
-	db := config.GetDB()
-	collection := db.Collection("groups")
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	var group models.Group
-	err := collection.FindOne(ctx, bson.M{
-		"id":     groupId,
-		"userId": user.UID,
-	}).Decode(&group)
-
-	if err == mongo.ErrNoDocuments {
-		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+	group, status, message := authorizeGroup(ctx, groupId, user, middleware.PermViewGroup)
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
 			"success": false,
-			"message": "Group not found",
-		})
-	} else if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"success": false,
-			"message": "Error fetching group",
+			"message": message,
 		})
 	}
 
+	// Expenses can be paged through separately, so the full list is only
+	// sent on request
+	withExpenses := c.Query("include") == "expenses"
+
+	etag := groupETag(group.Version, withExpenses)
+	c.Set(fiber.HeaderETag, etag)
+	if c.Get(fiber.HeaderIfNoneMatch) == etag {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	if withExpenses {
+		if err := loadGroupExpenses(ctx, &group); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Error fetching group",
+			})
+		}
+	}
+
 	return c.JSON(fiber.Map{
 		"success": true,
-		"data": models.GroupResponse{
-			ID:        group.GroupID,
-			Name:      group.Name,
-			Members:   group.Members,
-			Expenses:  group.Expenses,
-			CreatedAt: group.CreatedAt,
-		},
+		"data":    toGroupResponse(group),
 	})
 }
 
@@ -139,9 +219,10 @@ func createGroup(c *fiber.Ctx) error {
 	}
 
 	var body struct {
-		ID      string          `json:"id"`
-		Name    string          `json:"name"`
-		Members []models.Member `json:"members"`
+		Name       string          `json:"name"`
+		Currency   string          `json:"currency"`
+		Categories []string        `json:"categories"`
+		Members    []models.Member `json:"members"`
 	}
 
 	if err := c.BodyParser(&body); err != nil {
@@ -158,46 +239,86 @@ func createGroup(c *fiber.Ctx) error {
 		})
 	}
 
-	// Generate ID if not provided
-	groupID := body.ID
-	if groupID == "" {
-		groupID = strconv.FormatInt(time.Now().UnixNano(), 10)
+	currency := money.DefaultCurrency
+	if body.Currency != "" {
+		var ok bool
+		if currency, ok = money.NormalizeCurrency(body.Currency); !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Unknown currency code",
+			})
+		}
 	}
 
-	newGroup := models.Group{
-		ID:        primitive.NewObjectID(),
-		GroupID:   groupID,
-		Name:      body.Name,
-		Members:   body.Members,
-		Expenses:  []models.Expense{},
-		UserID:    user.UID,
-		CreatedAt: time.Now(),
-		UpdatedAt: time.Now(),
+	categories, message := parseCategories(body.Categories)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
 	}
 
-	db := config.GetDB()
-	collection := db.Collection("groups")
+	// The creator is the owner; other members can start as admin, member or viewer
+	for _, m := range body.Members {
+		if m.Role != "" && (m.Role == models.RoleOwner || !middleware.ValidRole(m.Role)) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Member role must be admin, member or viewer",
+			})
+		}
+	}
+
+	// Everyone else joins through an invite, so the only account a new
+	// group's members can be linked to is the creator's own
+	linked := false
+	for i := range body.Members {
+		if body.Members[i].UserID != user.UID || linked {
+			body.Members[i].UserID = ""
+		}
+		linked = linked || body.Members[i].UserID != ""
+	}
+
+	// Group IDs are always made here: everything in a group is stored under
+	// its ID, so a client must never be able to pick one that is taken
+	groupID := strconv.FormatInt(time.Now().UnixNano(), 10)
+
+	newGroup := models.Group{
+		ID:         primitive.NewObjectID(),
+		GroupID:    groupID,
+		Name:       body.Name,
+		Currency:   currency,
+		Categories: categories,
+		Members:    body.Members,
+		Expenses:   []models.Expense{},
+		Payments:   []models.Payment{},
+		UserID:     user.UID,
+		Version:    1,
+		CreatedAt:  time.Now(),
+		UpdatedAt:  time.Now(),
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	_, err := collection.InsertOne(ctx, newGroup)
-	if err != nil {
+	err := groupStore.CreateGroup(ctx, newGroup)
+	if err == store.ErrDuplicate {
+		// Another group was created in the same instant
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "A group with that ID already exists, please try again",
+		})
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
 			"message": "Error creating group",
 		})
 	}
 
+	recordActivity(ctx, groupID, user, models.ActivityGroupCreated, "", nil, groupSnapshot(newGroup))
+
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
-		"data": models.GroupResponse{
-			ID:        newGroup.GroupID,
-			Name:      newGroup.Name,
-			Members:   newGroup.Members,
-			Expenses:  newGroup.Expenses,
-			CreatedAt: newGroup.CreatedAt,
-		},
+		"data":    toGroupResponse(newGroup),
 	})
 }
 
@@ -213,9 +334,12 @@ func updateGroup(c *fiber.Ctx) error {
 	groupId := c.Params("groupId")
 
 	var body struct {
-		Name     string           `json:"name"`
-		Members  []models.Member  `json:"members"`
-		Expenses []models.Expense `json:"expenses"`
+		Name       *string          `json:"name"`
+		Currency   string           `json:"currency"`
+		Categories []string         `json:"categories"`
+		Members    []models.Member  `json:"members"`
+		Expenses   []models.Expense `json:"expenses"`
+		Version    *int64           `json:"version"`
 	}
 
 	if err := c.BodyParser(&body); err != nil {
@@ -225,30 +349,221 @@ func updateGroup(c *fiber.Ctx) error {
 		})
 	}
 
-	db := config.GetDB()
-	collection := db.Collection("groups")
+	// The name and members are kept when the client doesn't send them, but
+	// can't be emptied
+	if (body.Name != nil && *body.Name == "") || (body.Members != nil && len(body.Members) < 2) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Group name and at least 2 members are required",
+		})
+	}
+
+	if body.Currency != "" {
+		code, ok := money.NormalizeCurrency(body.Currency)
+		if !ok {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Unknown currency code",
+			})
+		}
+		body.Currency = code
+	}
+
+	// Categories are kept when the client doesn't send them
+	categories, message := parseCategories(body.Categories)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	expenseIDs := make(map[string]bool, len(body.Expenses))
+	for i := range body.Expenses {
+		if body.Expenses[i].ID == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Every expense needs an ID",
+			})
+		}
+		if err := checkExpense(&body.Expenses[i]); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": err.Error(),
+			})
+		}
+		if expenseIDs[body.Expenses[i].ID] {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Expense IDs must be unique",
+			})
+		}
+		expenseIDs[body.Expenses[i].ID] = true
+	}
+
+	// The version the client last saw comes from If-Match, or failing that
+	// from the body
+	expectedVersion, checkVersion, err := parseIfMatch(c.Get(fiber.HeaderIfMatch))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid If-Match header",
+		})
+	}
+	conflictStatus := fiber.StatusPreconditionFailed
+	if !checkVersion && body.Version != nil {
+		expectedVersion, checkVersion = *body.Version, true
+		conflictStatus = fiber.StatusConflict
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	update := bson.M{
-		"$set": bson.M{
-			"name":      body.Name,
-			"members":   body.Members,
-			"expenses":  body.Expenses,
-			"updatedAt": time.Now(),
-		},
+	current, status, message := authorizeGroup(ctx, groupId, user, middleware.PermEditGroup)
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	name := current.Name
+	if body.Name != nil {
+		name = *body.Name
+	}
+	if body.Members == nil {
+		body.Members = slices.Clone(current.Members)
+	}
+
+	// Removing members is reserved for owners and admins
+	removed := removedMembers(body.Members, current.Members)
+	if len(removed) > 0 && !middleware.CanAccessGroup(user, current, middleware.PermManageMembers) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"success": false,
+			"message": "Only owners and admins can remove members",
+		})
+	}
+	for _, m := range removed {
+		if status, message := checkMemberManagement(current, user, m); status != fiber.StatusOK {
+			return c.Status(status).JSON(fiber.Map{
+				"success": false,
+				"message": message,
+			})
+		}
 	}
 
-	var updatedGroup models.Group
-	err := collection.FindOneAndUpdate(
-		ctx,
-		bson.M{"id": groupId, "userId": user.UID},
-		update,
-		options.FindOneAndUpdate().SetReturnDocument(options.After),
-	).Decode(&updatedGroup)
+	// Exchange rates are relative to the base currency, so it can only
+	// change while the group has no expenses
+	if body.Currency == "" {
+		body.Currency = current.Currency
+	} else if body.Currency != current.BaseCurrency() {
+		totals, err := groupStore.ExpenseTotals(ctx, []string{groupId})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Error updating group",
+			})
+		}
+		if totals[groupId].Count > 0 || len(body.Expenses) > 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "The currency can't be changed once the group has expenses",
+			})
+		}
+	}
+
+	var stored []models.Expense
+	if body.Expenses != nil {
+		stored, err = groupStore.GroupExpenses(ctx, groupId)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Error updating group",
+			})
+		}
+	}
+
+	target := current
+	target.Currency = body.Currency
+	if body.Categories != nil {
+		target.Categories = categories
+	}
+	for i := range body.Expenses {
+		if !target.HasCategory(body.Expenses[i].Category) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Unknown category",
+			})
+		}
+		previous := findExpense(stored, body.Expenses[i].ID)
+		if previous == nil && recurring.ReservedExpenseID(body.Expenses[i].ID) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Expense IDs starting with rec- are reserved for recurring expenses",
+			})
+		}
+		if message := checkExpenseMembers(body.Members, body.Expenses[i], previous); message != "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": message,
+			})
+		}
+		if status, message := applyCurrency(ctx, target, &body.Expenses[i]); status != fiber.StatusOK {
+			return c.Status(status).JSON(fiber.Map{
+				"success": false,
+				"message": message,
+			})
+		}
+	}
+
+	// Attachments can only be changed through their own routes, so those of
+	// expenses that are kept are carried over. Expenses left out go to the
+	// trash like any other deleted expense: they stay in the group through
+	// the update, so its version check covers them, and are trashed after.
+	expenses := body.Expenses
+	var dropped []models.Expense
+	if body.Expenses != nil {
+		dropped = preserveAttachments(body.Expenses, stored)
+		expenses = append(slices.Clip(body.Expenses), dropped...)
+	}
+
+	// Member account links and roles are carried over from the stored group.
+	// When the client sent no version, the update is made conditional on the
+	// version read here so the merge can't overwrite a concurrent change.
+	preserveMemberAccess(body.Members, current.Members)
+	if !checkVersion {
+		expectedVersion = current.Version
+		conflictStatus = fiber.StatusConflict
+	}
+
+	updatedGroup, err := groupStore.UpdateGroup(ctx, models.Group{
+		GroupID:    groupId,
+		Name:       name,
+		Currency:   body.Currency,
+		Categories: target.Categories,
+		Members:    body.Members,
+		Expenses:   expenses,
+		Version:    expectedVersion,
+	})
+
+	if err == store.ErrConflict {
+		// Hand back the current state so the client can merge and retry
+		latest, findErr := groupStore.GetGroup(ctx, groupId)
+		if findErr == nil {
+			findErr = loadGroupExpenses(ctx, &latest)
+		}
+		if findErr == nil {
+			c.Set(fiber.HeaderETag, groupETag(latest.Version, true))
+			return c.Status(conflictStatus).JSON(fiber.Map{
+				"success": false,
+				"message": "Group was modified by someone else",
+				"data":    toGroupResponse(latest),
+			})
+		}
+		err = findErr
+	}
 
-	if err == mongo.ErrNoDocuments {
+	if err == store.ErrNotFound {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"success": false,
 			"message": "Group not found",
@@ -260,15 +575,49 @@ func updateGroup(c *fiber.Ctx) error {
 		})
 	}
 
+	// Only the IDs of replaced expenses are recorded; those that were left
+	// out are recorded as they are trashed below
+	before, after := groupSnapshot(current), groupSnapshot(updatedGroup)
+	if body.Expenses != nil {
+		before.ExpenseIDs, after.ExpenseIDs = changedExpenses(stored, body.Expenses)
+	}
+	recordActivity(ctx, groupId, user, models.ActivityGroupUpdated, "", before, after)
+
+	if len(dropped) > 0 {
+		for _, e := range dropped {
+			trashed, err := trashStore.TrashExpense(ctx, groupId, e.ID, user.UID, time.Now())
+			if err == store.ErrNotFound {
+				// Deleted by someone else in the meantime
+				continue
+			} else if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+					"success": false,
+					"message": "Error updating group",
+				})
+			}
+			recordActivity(ctx, groupId, user, models.ActivityExpenseDeleted, e.ID, expenseSnapshot(trashed.Expense), nil)
+		}
+
+		// Trashing moved the version on
+		if updatedGroup, err = groupStore.GetGroup(ctx, groupId); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"success": false,
+				"message": "Error fetching group",
+			})
+		}
+	}
+
+	c.Set(fiber.HeaderETag, groupETag(updatedGroup.Version, true))
+	if err := loadGroupExpenses(ctx, &updatedGroup); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error fetching group",
+		})
+	}
+
 	return c.JSON(fiber.Map{
 		"success": true,
-		"data": models.GroupResponse{
-			ID:        updatedGroup.GroupID,
-			Name:      updatedGroup.Name,
-			Members:   updatedGroup.Members,
-			Expenses:  updatedGroup.Expenses,
-			CreatedAt: updatedGroup.CreatedAt,
-		},
+		"data":    toGroupResponse(updatedGroup),
 	})
 }
 
@@ -283,38 +632,40 @@ func deleteGroup(c *fiber.Ctx) error {
 
 	groupId := c.Params("groupId")
 
-	db := config.GetDB()
-	collection := db.Collection("groups")
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	result, err := collection.DeleteOne(ctx, bson.M{
-		"id":     groupId,
-		"userId": user.UID,
-	})
-
-	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+	if _, status, message := authorizeGroup(ctx, groupId, user, middleware.PermDeleteGroup); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
 			"success": false,
-			"message": "Error deleting group",
+			"message": message,
 		})
 	}
 
-	if result.DeletedCount == 0 {
+	// The group keeps everything in it, attachments included, until it is
+	// purged from the trash
+	err := trashStore.TrashGroup(ctx, groupId, user.UID, time.Now())
+	if err == store.ErrNotFound {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"success": false,
 			"message": "Group not found",
 		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error deleting group",
+		})
 	}
 
+	recordActivity(ctx, groupId, user, models.ActivityGroupDeleted, "", nil, nil)
+
 	return c.JSON(fiber.Map{
 		"success": true,
-		"message": "Group deleted successfully",
+		"message": "Group moved to trash",
 	})
 }
 
-func addExpense(c *fiber.Ctx) error {
+func getExpenses(c *fiber.Ctx) error {
 	user := middleware.GetUserFromContext(c)
 	if user == nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -325,67 +676,125 @@ func addExpense(c *fiber.Ctx) error {
 
 	groupId := c.Params("groupId")
 
-	var body struct {
-		ID           string   `json:"id"`
-		Description  string   `json:"description"`
-		Amount       float64  `json:"amount"`
-		PaidBy       string   `json:"paidBy"`
-		Participants []string `json:"participants"`
+	query, message := parseExpenseQuery(c)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
 	}
 
-	if err := c.BodyParser(&body); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, status, message := authorizeGroup(ctx, groupId, user, middleware.PermViewGroup); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
 			"success": false,
-			"message": "Invalid request body",
+			"message": message,
 		})
 	}
 
-	if body.Description == "" || body.Amount == 0 || body.PaidBy == "" || len(body.Participants) == 0 {
+	page, err := groupStore.ListExpenses(ctx, groupId, query)
+	if err == store.ErrInvalidCursor {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"success": false,
-			"message": "All expense fields are required",
+			"message": "Invalid cursor",
+		})
+	} else if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Group not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error fetching expenses",
 		})
 	}
 
-	// Generate ID if not provided
-	expenseID := body.ID
-	if expenseID == "" {
-		expenseID = strconv.FormatInt(time.Now().UnixNano(), 10)
+	for _, e := range page.Expenses {
+		addAttachmentURLs(c, groupId, e.ID, e.Attachments)
 	}
 
-	newExpense := models.Expense{
-		ID:           expenseID,
-		Description:  body.Description,
-		Amount:       body.Amount,
-		PaidBy:       body.PaidBy,
-		Participants: body.Participants,
-		Date:         time.Now(),
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    page,
+	})
+}
+
+func addExpense(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
 	}
 
-	db := config.GetDB()
-	collection := db.Collection("groups")
+	groupId := c.Params("groupId")
+
+	newExpense, err := parseExpenseBody(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": err.Error(),
+		})
+	}
+
+	// Generate ID if not provided
+	if newExpense.ID == "" {
+		newExpense.ID = strconv.FormatInt(time.Now().UnixNano(), 10)
+	} else if recurring.ReservedExpenseID(newExpense.ID) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Expense IDs starting with rec- are reserved for recurring expenses",
+		})
+	}
+	newExpense.Date = time.Now()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	update := bson.M{
-		"$push": bson.M{"expenses": newExpense},
-		"$set":  bson.M{"updatedAt": time.Now()},
+	group, status, message := authorizeGroup(ctx, groupId, user, middleware.PermEditExpenses)
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	if !group.HasCategory(newExpense.Category) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Unknown category",
+		})
+	}
+
+	if message := checkExpenseMembers(group.Members, newExpense, nil); message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
 	}
 
-	var updatedGroup models.Group
-	err := collection.FindOneAndUpdate(
-		ctx,
-		bson.M{"id": groupId, "userId": user.UID},
-		update,
-		options.FindOneAndUpdate().SetReturnDocument(options.After),
-	).Decode(&updatedGroup)
+	if status, message := applyCurrency(ctx, group, &newExpense); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
 
-	if err == mongo.ErrNoDocuments {
+	err = groupStore.AddExpense(ctx, groupId, newExpense)
+	if err == store.ErrNotFound {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"success": false,
 			"message": "Group not found",
 		})
+	} else if err == store.ErrDuplicate {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "An expense with that ID already exists",
+		})
 	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
@@ -393,6 +802,8 @@ func addExpense(c *fiber.Ctx) error {
 		})
 	}
 
+	recordActivity(ctx, groupId, user, models.ActivityExpenseAdded, newExpense.ID, nil, expenseSnapshot(newExpense))
+
 	// Return the newly added expense
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"success": true,
@@ -400,7 +811,7 @@ func addExpense(c *fiber.Ctx) error {
 	})
 }
 
-func deleteExpense(c *fiber.Ctx) error {
+func updateExpense(c *fiber.Ctx) error {
 	user := middleware.GetUserFromContext(c)
 	if user == nil {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
@@ -412,39 +823,751 @@ func deleteExpense(c *fiber.Ctx) error {
 	groupId := c.Params("groupId")
 	expenseId := c.Params("expenseId")
 
-	db := config.GetDB()
-	collection := db.Collection("groups")
+	expense, err := parseExpenseBody(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": err.Error(),
+		})
+	}
+	expense.ID = expenseId
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	update := bson.M{
-		"$pull": bson.M{"expenses": bson.M{"id": expenseId}},
-		"$set":  bson.M{"updatedAt": time.Now()},
+	group, status, message := authorizeGroup(ctx, groupId, user, middleware.PermEditExpenses)
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
 	}
 
-	result, err := collection.UpdateOne(
-		ctx,
-		bson.M{"id": groupId, "userId": user.UID},
-		update,
-	)
-
-	if err != nil {
+	current, err := groupStore.GetExpense(ctx, groupId, expenseId)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Expense not found",
+		})
+	} else if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"success": false,
-			"message": "Error deleting expense",
+			"message": "Error updating expense",
+		})
+	}
+
+	// A category the group has since removed can stay on the expense
+	if expense.Category != current.Category && !group.HasCategory(expense.Category) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Unknown category",
+		})
+	}
+
+	// Members who have since been removed can stay on the expense
+	if message := checkExpenseMembers(group.Members, expense, &current); message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	// An edit that leaves the currency alone keeps the rate of the
+	// expense's own date unless a new one is given
+	expense.Date = current.Date
+	if expense.ExchangeRate == 0 && expense.Currency == current.Currency {
+		expense.ExchangeRate = current.ExchangeRate
+	}
+	if status, message := applyCurrency(ctx, group, &expense); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
 		})
 	}
 
-	if result.MatchedCount == 0 {
+	updatedExpense, err := groupStore.UpdateExpense(ctx, groupId, expense)
+	if err == store.ErrNotFound {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"success": false,
-			"message": "Group not found",
+			"message": "Expense not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error updating expense",
 		})
 	}
 
+	recordActivity(ctx, groupId, user, models.ActivityExpenseUpdated, expenseId, expenseSnapshot(current), expenseSnapshot(updatedExpense))
+
 	return c.JSON(fiber.Map{
 		"success": true,
-		"message": "Expense deleted successfully",
+		"data":    updatedExpense,
 	})
 }
+
+func deleteExpense(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+	expenseId := c.Params("expenseId")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, status, message := authorizeGroup(ctx, groupId, user, middleware.PermEditExpenses); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	// The expense keeps its attachments until it is purged from the trash.
+	// The group was just found, so a missing expense was already gone;
+	// deleting it again changes nothing and isn't an error.
+	trashed, err := trashStore.TrashExpense(ctx, groupId, expenseId, user.UID, time.Now())
+	if err == nil {
+		recordActivity(ctx, groupId, user, models.ActivityExpenseDeleted, expenseId, expenseSnapshot(trashed.Expense), nil)
+	} else if err != store.ErrNotFound {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error deleting expense",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Expense moved to trash",
+	})
+}
+
+// expenseBody is the request body for creating or editing an expense
+type expenseBody struct {
+	ID           string         `json:"id"`
+	Description  string         `json:"description"`
+	Amount       money.Amount   `json:"amount"`
+	Currency     string         `json:"currency"`
+	ExchangeRate float64        `json:"exchangeRate"`
+	Category     string         `json:"category"`
+	Tags         []string       `json:"tags"`
+	PaidBy       string         `json:"paidBy"`
+	Payers       []models.Payer `json:"payers"`
+	Participants []string       `json:"participants"`
+	Split        *models.Split  `json:"split"`
+}
+
+// parseExpenseBody reads an expense from the request body and applies the
+// same validation rules to new and edited expenses
+func parseExpenseBody(c *fiber.Ctx) (models.Expense, error) {
+	var body expenseBody
+	if err := c.BodyParser(&body); err != nil {
+		return models.Expense{}, errors.New("Invalid request body")
+	}
+	return body.expense()
+}
+
+// expense converts the body to an expense, checking that it has every
+// required field and is valid
+func (body expenseBody) expense() (models.Expense, error) {
+	expense := models.Expense{
+		ID:           body.ID,
+		Description:  body.Description,
+		Amount:       body.Amount,
+		Currency:     body.Currency,
+		ExchangeRate: body.ExchangeRate,
+		Category:     body.Category,
+		Tags:         body.Tags,
+		PaidBy:       body.PaidBy,
+		Payers:       body.Payers,
+		Participants: body.Participants,
+		Split:        body.Split,
+	}
+
+	if err := checkExpense(&expense); err != nil {
+		return models.Expense{}, err
+	}
+	return expense, nil
+}
+
+// checkExpense checks that an expense has every required field and then
+// validates it. Expenses sent in a group update go through it too.
+func checkExpense(expense *models.Expense) error {
+	if expense.Description == "" || expense.Amount == 0 || (expense.PaidBy == "" && len(expense.Payers) == 0) || (len(expense.Participants) == 0 && expense.Split == nil) {
+		return errors.New("All expense fields are required")
+	}
+	return validateExpense(expense)
+}
+
+// validateExpense checks that an expense's payers and split add up to its
+// amount and that its currency is known, normalizes its category and tags,
+// and keeps paidBy, participants and the parts of itemized splits in sync. Whether the
+// category exists in the group is left to the caller.
+func validateExpense(expense *models.Expense) error {
+	if expense.Currency != "" {
+		code, ok := money.NormalizeCurrency(expense.Currency)
+		if !ok {
+			return errors.New("Unknown currency code")
+		}
+		expense.Currency = code
+	}
+	if expense.ExchangeRate < 0 {
+		return errors.New("Exchange rate cannot be negative")
+	}
+
+	expense.Category = normalizeLabel(expense.Category)
+	tags, ok := normalizeLabels(expense.Tags)
+	if !ok || utf8.RuneCountInString(expense.Category) > maxLabelLength {
+		return errors.New("Categories and tags can be at most " + strconv.Itoa(maxLabelLength) + " characters")
+	}
+	if len(tags) > maxTags {
+		return errors.New("An expense can have at most " + strconv.Itoa(maxTags) + " tags")
+	}
+	expense.Tags = tags
+
+	if len(expense.Payers) > 0 {
+		expense.PaidBy = expense.Payers[0].MemberID
+	}
+	if expense.Split != nil {
+		if err := applyItems(expense.Split, expense.Amount); err != nil {
+			return err
+		}
+		expense.Participants = settlement.SplitMembers(*expense)
+	}
+
+	if _, err := settlement.ExpensePayers(*expense); err != nil {
+		return err
+	}
+	_, err := settlement.ExpenseShares(*expense)
+	return err
+}
+
+// applyItems fills in the parts of an itemized split with each member's
+// share of its items, tax and tip, so the breakdown is stored along with
+// the items it came from. Other splits have any items, tax and tip dropped.
+func applyItems(split *models.Split, amount money.Amount) error {
+	if split.Type != models.SplitItemized {
+		split.Items, split.Tax, split.Tip = nil, 0, 0
+		return nil
+	}
+	if len(split.Items) > maxItems {
+		return errors.New("An itemized split can have at most " + strconv.Itoa(maxItems) + " items")
+	}
+
+	shares, err := settlement.ExpenseShares(models.Expense{Amount: amount, Split: split})
+	if err != nil {
+		return err
+	}
+	split.Parts = make([]models.SplitPart, len(shares))
+	for i, share := range shares {
+		split.Parts[i] = models.SplitPart{MemberID: share.MemberID, Amount: share.Amount}
+	}
+	return nil
+}
+
+// expenseMembers returns the IDs of every member an expense is paid by or
+// split between
+func expenseMembers(e models.Expense) []string {
+	ids := append([]string{e.PaidBy}, e.Participants...)
+	for _, p := range e.Payers {
+		ids = append(ids, p.MemberID)
+	}
+	if e.Split != nil {
+		for _, p := range e.Split.Parts {
+			ids = append(ids, p.MemberID)
+		}
+		for _, item := range e.Split.Items {
+			ids = append(ids, item.Participants...)
+		}
+	}
+	return ids
+}
+
+// checkExpenseMembers checks that an expense is only paid by and split
+// between the given members. When an expense is edited, previous is its
+// stored version, and members who have since left the group may stay on it.
+// It returns a message if the expense names anyone else.
+func checkExpenseMembers(members []models.Member, expense models.Expense, previous *models.Expense) string {
+	known := make(map[string]bool, len(members))
+	for _, m := range members {
+		known[m.ID] = true
+	}
+	if previous != nil {
+		for _, id := range expenseMembers(*previous) {
+			known[id] = true
+		}
+	}
+
+	for _, id := range expenseMembers(expense) {
+		if !known[id] {
+			return "Expenses can only be paid by and split between members of the group"
+		}
+	}
+	return ""
+}
+
+// findExpense returns the expense with the given ID, or nil if there is none
+func findExpense(expenses []models.Expense, id string) *models.Expense {
+	for i := range expenses {
+		if expenses[i].ID == id {
+			return &expenses[i]
+		}
+	}
+	return nil
+}
+
+const (
+	// maxItems is the number of line items an itemized split can have
+	maxItems = 200
+	// maxCategories is the number of categories a group can add
+	maxCategories = 50
+	// maxTags is the number of tags an expense can carry
+	maxTags = 20
+	// maxLabelLength is the longest category or tag, in characters
+	maxLabelLength = 40
+)
+
+// normalizeLabel trims and lower-cases a category or tag
+func normalizeLabel(label string) string {
+	return strings.ToLower(strings.TrimSpace(label))
+}
+
+// normalizeLabels normalizes a list of categories or tags, dropping blanks
+// and duplicates. It reports false if one is longer than maxLabelLength.
+func normalizeLabels(labels []string) ([]string, bool) {
+	var normalized []string
+	for _, label := range labels {
+		label = normalizeLabel(label)
+		if label == "" || slices.Contains(normalized, label) {
+			continue
+		}
+		if utf8.RuneCountInString(label) > maxLabelLength {
+			return nil, false
+		}
+		normalized = append(normalized, label)
+	}
+	return normalized, true
+}
+
+// parseCategories normalizes a group's own categories, leaving out any
+// that are built in. It returns a message if they are invalid.
+func parseCategories(categories []string) ([]string, string) {
+	normalized, ok := normalizeLabels(categories)
+	if !ok {
+		return nil, "Categories can be at most " + strconv.Itoa(maxLabelLength) + " characters"
+	}
+
+	custom := []string{}
+	for _, category := range normalized {
+		if !slices.Contains(models.DefaultCategories, category) {
+			custom = append(custom, category)
+		}
+	}
+	if len(custom) > maxCategories {
+		return nil, "A group can have at most " + strconv.Itoa(maxCategories) + " categories of its own"
+	}
+	return custom, ""
+}
+
+// applyCurrency converts an expense to the group's base currency. Expenses
+// without a currency are taken to be in the base currency; any other
+// currency needs the exchange rate on the day of the expense, which is
+// stored with it. A rate the client leaves out is looked up from the rate
+// provider, if there is one.
+func applyCurrency(ctx context.Context, group models.Group, expense *models.Expense) (int, string) {
+	err := fx.ToBase(ctx, rateProvider, expense, group.BaseCurrency())
+	if err == fx.ErrNoRate {
+		return fiber.StatusBadRequest, "An exchange rate to " + group.BaseCurrency() + " is required for expenses in " + expense.Currency
+	} else if err != nil {
+		return fiber.StatusBadGateway, "Error looking up the exchange rate"
+	}
+	return fiber.StatusOK, ""
+}
+
+// parseExpenseQuery reads the paging, filter and sort parameters of an
+// expense listing. It returns a message describing the first invalid
+// parameter, or an empty message if they are all valid.
+func parseExpenseQuery(c *fiber.Ctx) (store.ExpenseQuery, string) {
+	query := store.ExpenseQuery{
+		Cursor:      c.Query("cursor"),
+		Limit:       c.QueryInt("limit", store.DefaultPageSize),
+		Sort:        store.ExpenseSort(c.Query("sort", string(store.SortNewest))),
+		PaidBy:      c.Query("paidBy"),
+		Participant: c.Query("participant"),
+		Search:      strings.TrimSpace(c.Query("q")),
+		Category:    normalizeLabel(c.Query("category")),
+		Tag:         normalizeLabel(c.Query("tag")),
+	}
+
+	if query.Limit < 1 || query.Limit > store.MaxPageSize {
+		return query, "Limit must be between 1 and " + strconv.Itoa(store.MaxPageSize)
+	}
+	if !query.Sort.Valid() {
+		return query, "Sort must be one of date, -date, amount or -amount"
+	}
+
+	var err error
+	if query.From, err = parseQueryDate(c.Query("from"), false); err != nil {
+		return query, "Invalid from date"
+	}
+	if query.To, err = parseQueryDate(c.Query("to"), true); err != nil {
+		return query, "Invalid to date"
+	}
+	if query.MinAmount, err = parseQueryAmount(c.Query("minAmount")); err != nil {
+		return query, "Invalid minAmount"
+	}
+	if query.MaxAmount, err = parseQueryAmount(c.Query("maxAmount")); err != nil {
+		return query, "Invalid maxAmount"
+	}
+	return query, ""
+}
+
+// parseQueryDate parses an RFC 3339 timestamp or a plain YYYY-MM-DD date,
+// returning the zero time for an empty string. A plain date used as an
+// exclusive upper bound is moved to the end of that day, so the day itself
+// is included.
+func parseQueryDate(s string, upper bool) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.DateOnly, s); err == nil {
+		if upper {
+			t = t.AddDate(0, 0, 1)
+		}
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// parseQueryAmount parses a decimal amount, returning nil for an empty string
+func parseQueryAmount(s string) (*money.Amount, error) {
+	if s == "" {
+		return nil, nil
+	}
+	a, err := money.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// toGroupResponse converts a stored group to its API representation
+func toGroupResponse(g models.Group) models.GroupResponse {
+	categories := g.Categories
+	if categories == nil {
+		categories = []string{}
+	}
+
+	return models.GroupResponse{
+		ID:         g.GroupID,
+		Name:       g.Name,
+		Currency:   g.BaseCurrency(),
+		Categories: categories,
+		Members:    g.Members,
+		Expenses:   g.Expenses,
+		Payments:   g.Payments,
+		Version:    g.Version,
+		CreatedAt:  g.CreatedAt,
+	}
+}
+
+// toGroupSummary converts a stored group, its expense totals and the
+// requesting user's balance to the compact form used in group lists
+func toGroupSummary(g models.Group, totals store.ExpenseTotal, myBalance *money.Amount) models.GroupSummary {
+	lastActivity := g.UpdatedAt
+	if lastActivity.IsZero() {
+		lastActivity = g.CreatedAt
+	}
+
+	return models.GroupSummary{
+		ID:           g.GroupID,
+		Name:         g.Name,
+		Currency:     g.BaseCurrency(),
+		Members:      g.Members,
+		MemberCount:  len(g.Members),
+		ExpenseCount: totals.Count,
+		TotalAmount:  totals.Total,
+		MyBalance:    myBalance,
+		Version:      g.Version,
+		CreatedAt:    g.CreatedAt,
+		LastActivity: lastActivity,
+	}
+}
+
+// groupSummaries builds the summaries of a page of groups for a user
+func groupSummaries(ctx context.Context, groups []models.Group, uid string) ([]models.GroupSummary, error) {
+	ids := make([]string, len(groups))
+	for i, g := range groups {
+		ids[i] = g.GroupID
+	}
+
+	totals, err := groupStore.ExpenseTotals(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// A balance that can't be worked out is left out rather than failing
+	// the whole list
+	summaries := make([]models.GroupSummary, len(groups))
+	for i, g := range groups {
+		balance, err := userBalance(ctx, g, uid)
+		if err != nil {
+			log.Printf("⚠️  Working out balances of group %s: %v", g.GroupID, err)
+		}
+		summaries[i] = toGroupSummary(g, totals[g.GroupID], balance)
+	}
+	return summaries, nil
+}
+
+// fullGroups converts a page of groups to their full API representation,
+// expenses included
+func fullGroups(ctx context.Context, groups []models.Group) ([]models.GroupResponse, error) {
+	response := make([]models.GroupResponse, len(groups))
+	for i := range groups {
+		if err := loadGroupExpenses(ctx, &groups[i]); err != nil {
+			return nil, err
+		}
+		response[i] = toGroupResponse(groups[i])
+	}
+	return response, nil
+}
+
+// userBalance returns the net balance of the member a user is linked to, or
+// nil if they aren't linked to any member of the group
+func userBalance(ctx context.Context, group models.Group, uid string) (*money.Amount, error) {
+	memberID := ""
+	for _, m := range group.Members {
+		if m.UserID == uid {
+			memberID = m.ID
+			break
+		}
+	}
+	if memberID == "" {
+		return nil, nil
+	}
+
+	balances, err := groupBalances(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	if balance, ok := balances[memberID]; ok {
+		return &balance, nil
+	}
+	return nil, nil
+}
+
+const (
+	// balanceCacheTTL bounds how long a cached balance is used. Every
+	// change to a group's expenses or payments bumps its version, which
+	// already makes a cached balance miss; the TTL covers MongoDB, where an
+	// expense is written apart from the version bump, so a balance worked
+	// out in between can't linger.
+	balanceCacheTTL = time.Minute
+
+	// maxBalanceCacheEntries bounds the memory the cache can use. A full
+	// cache is emptied rather than evicting entries one by one.
+	maxBalanceCacheEntries = 10000
+)
+
+// balanceCache holds the member balances of recently listed groups, so a
+// group list doesn't load the expenses of every group each time
+var balanceCache = struct {
+	sync.Mutex
+	entries map[string]cachedBalances
+}{entries: make(map[string]cachedBalances)}
+
+type cachedBalances struct {
+	version  int64
+	computed time.Time
+	balances map[string]money.Amount
+}
+
+// groupBalances returns the net balance of each member of a group, keyed by
+// member ID. Balances depend on how every expense is split, so a group that
+// isn't cached at its current version has its expenses loaded to compute
+// them.
+func groupBalances(ctx context.Context, group models.Group) (map[string]money.Amount, error) {
+	balanceCache.Lock()
+	entry, ok := balanceCache.entries[group.GroupID]
+	balanceCache.Unlock()
+	if ok && entry.version == group.Version && time.Since(entry.computed) < balanceCacheTTL {
+		return entry.balances, nil
+	}
+
+	computed := time.Now()
+	if err := loadGroupExpenses(ctx, &group); err != nil {
+		return nil, err
+	}
+	list, _ := settlement.ComputeBalances(group)
+	balances := make(map[string]money.Amount, len(list))
+	for _, b := range list {
+		balances[b.MemberID] = b.Balance
+	}
+
+	balanceCache.Lock()
+	if len(balanceCache.entries) >= maxBalanceCacheEntries {
+		balanceCache.entries = make(map[string]cachedBalances)
+	}
+	balanceCache.entries[group.GroupID] = cachedBalances{version: group.Version, computed: computed, balances: balances}
+	balanceCache.Unlock()
+	return balances, nil
+}
+
+// loadGroupExpenses fills in a group's expenses, which are stored apart
+// from the group
+func loadGroupExpenses(ctx context.Context, group *models.Group) error {
+	expenses, err := groupStore.GroupExpenses(ctx, group.GroupID)
+	if err != nil {
+		return err
+	}
+	group.Expenses = expenses
+	return nil
+}
+
+// expensesETagSuffix marks the entity tags of responses that include the
+// group's expenses
+const expensesETagSuffix = "-expenses"
+
+// groupETag formats a group version as an entity tag. A response with the
+// expenses gets a tag of its own, so a cached copy without them is never
+// taken for one with them.
+func groupETag(version int64, withExpenses bool) string {
+	tag := strconv.FormatInt(version, 10)
+	if withExpenses {
+		tag += expensesETagSuffix
+	}
+	return `"` + tag + `"`
+}
+
+// parseIfMatch extracts the expected group version from an If-Match header,
+// which may carry either form of the group's entity tag. It reports false
+// when the header is absent or is the "*" wildcard.
+func parseIfMatch(header string) (int64, bool, error) {
+	header = strings.TrimSpace(header)
+	if header == "" || header == "*" {
+		return 0, false, nil
+	}
+
+	tag := strings.Trim(strings.TrimPrefix(header, "W/"), `"`)
+	tag = strings.TrimSuffix(tag, expensesETagSuffix)
+	version, err := strconv.ParseInt(tag, 10, 64)
+	if err != nil {
+		return 0, false, err
+	}
+	return version, true, nil
+}
+
+// preserveMemberAccess copies account links and roles from the stored
+// members onto the submitted ones, replacing any the client sent, so an
+// update can't change anyone's access. New members are left unlinked with
+// the default member role: accounts are only linked by accepting an invite,
+// and roles are changed through the member role endpoint.
+func preserveMemberAccess(members, existing []models.Member) {
+	stored := make(map[string]models.Member, len(existing))
+	for _, m := range existing {
+		stored[m.ID] = m
+	}
+
+	for i := range members {
+		m := stored[members[i].ID]
+		members[i].UserID = m.UserID
+		members[i].Role = m.Role
+	}
+}
+
+// removedMembers returns the stored members that are missing from members
+func removedMembers(members, existing []models.Member) []models.Member {
+	kept := make(map[string]bool, len(members))
+	for _, m := range members {
+		kept[m.ID] = true
+	}
+
+	var removed []models.Member
+	for _, m := range existing {
+		if !kept[m.ID] {
+			removed = append(removed, m)
+		}
+	}
+	return removed
+}
+
+// preserveAttachments copies the attachments of the stored expenses onto
+// the submitted ones with the same IDs, replacing any the client sent, and
+// returns the stored expenses that are missing from the submitted ones
+func preserveAttachments(expenses, existing []models.Expense) []models.Expense {
+	stored := make(map[string]models.Expense, len(existing))
+	for _, e := range existing {
+		stored[e.ID] = e
+	}
+
+	kept := make(map[string]bool, len(expenses))
+	for i := range expenses {
+		expenses[i].Attachments = stored[expenses[i].ID].Attachments
+		kept[expenses[i].ID] = true
+	}
+
+	var dropped []models.Expense
+	for _, e := range existing {
+		if !kept[e.ID] {
+			dropped = append(dropped, e)
+		}
+	}
+	return dropped
+}
+
+// changedExpenses compares a group's expenses before and after they were
+// replaced. It returns the IDs of those that were changed or removed, and
+// of those that were added or changed.
+func changedExpenses(before, after []models.Expense) ([]string, []string) {
+	previous := make(map[string]models.Expense, len(before))
+	for _, e := range before {
+		previous[e.ID] = e
+	}
+
+	var changed, removed, added []string
+	for _, e := range after {
+		if p, ok := previous[e.ID]; !ok {
+			added = append(added, e.ID)
+		} else if expenseChanged(p, e) {
+			changed = append(changed, e.ID)
+		}
+		delete(previous, e.ID)
+	}
+	for _, e := range before {
+		if _, ok := previous[e.ID]; ok {
+			removed = append(removed, e.ID)
+		}
+	}
+	return append(slices.Clip(changed), removed...), append(changed, added...)
+}
+
+// expenseChanged reports whether two versions of an expense differ in
+// anything but the time zone of their dates
+func expenseChanged(a, b models.Expense) bool {
+	a.Date, b.Date = a.Date.UTC(), b.Date.UTC()
+	before, errBefore := json.Marshal(a)
+	after, errAfter := json.Marshal(b)
+	return errBefore != nil || errAfter != nil || !bytes.Equal(before, after)
+}
+
+// authorizeGroup loads a group and checks that the user's role grants perm.
+// Groups the user has no role in are reported as not found. On failure it
+// returns the status and message to respond with.
+func authorizeGroup(ctx context.Context, groupId string, user *middleware.UserContext, perm middleware.Permission) (models.Group, int, string) {
+	group, err := groupStore.GetGroup(ctx, groupId)
+	if err == store.ErrNotFound || (err == nil && group.RoleOf(user.UID) == "") {
+		return models.Group{}, fiber.StatusNotFound, "Group not found"
+	} else if err != nil {
+		return models.Group{}, fiber.StatusInternalServerError, "Error fetching group"
+	}
+
+	if !middleware.CanAccessGroup(user, group, perm) {
+		return group, fiber.StatusForbidden, "You don't have permission to do that"
+	}
+	return group, fiber.StatusOK, ""
+}
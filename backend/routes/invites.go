@@ -0,0 +1,365 @@
+package routes
+
+import (
+	"context"
+	"crypto/rand"
+	"split-it/backend/middleware"
+	"split-it/backend/models"
+	"split-it/backend/store"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// inviteTokenAlphabet avoids characters that are easy to confuse when an
+	// invite code is read out or typed in
+	inviteTokenAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	inviteTokenLength   = 10
+
+	defaultInviteTTL     = 7 * 24 * time.Hour
+	defaultInviteMaxUses = 10
+)
+
+// SetupInviteRoutes configures invite redemption routes
+func SetupInviteRoutes(app *fiber.App, groups store.GroupStore, invites store.InviteStore) {
+	groupStore = groups
+	inviteStore = invites
+
+	router := app.Group("/api/invites", middleware.AuthenticateUser)
+
+	router.Get("/:token", getInvite)
+	router.Post("/:token/accept", acceptInvite)
+}
+
+func createInvite(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+
+	var body struct {
+		MemberID       string      `json:"memberId"`
+		Role           models.Role `json:"role"`
+		MaxUses        int         `json:"maxUses"`
+		ExpiresInHours int         `json:"expiresInHours"`
+	}
+
+	if err := c.BodyParser(&body); err != nil && len(c.Body()) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid request body",
+		})
+	}
+
+	if body.MaxUses < 0 || body.ExpiresInHours < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Max uses and expiry must be positive",
+		})
+	}
+
+	if body.Role == "" {
+		body.Role = models.RoleMember
+	}
+	if body.Role == models.RoleOwner || !middleware.ValidRole(body.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid role",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Only owners and admins can invite people
+	group, status, message := authorizeGroup(ctx, groupId, user, middleware.PermManageMembers)
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	if status, message := checkRoleGrant(group, user, body.Role); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	maxUses := body.MaxUses
+	if maxUses == 0 {
+		maxUses = defaultInviteMaxUses
+	}
+
+	// An invite for a specific placeholder can only be claimed once
+	if body.MemberID != "" {
+		member := findMember(group.Members, body.MemberID)
+		if member == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Member not found in group",
+			})
+		}
+		if member.UserID != "" {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"message": "Member is already linked to an account",
+			})
+		}
+		maxUses = 1
+	}
+
+	ttl := defaultInviteTTL
+	if body.ExpiresInHours > 0 {
+		ttl = time.Duration(body.ExpiresInHours) * time.Hour
+	}
+
+	token, err := newInviteToken()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error creating invite",
+		})
+	}
+
+	invite := models.Invite{
+		ID:        primitive.NewObjectID(),
+		Token:     token,
+		GroupID:   group.GroupID,
+		MemberID:  body.MemberID,
+		Role:      body.Role,
+		CreatedBy: user.UID,
+		MaxUses:   maxUses,
+		ExpiresAt: time.Now().Add(ttl),
+		CreatedAt: time.Now(),
+	}
+
+	if err := inviteStore.CreateInvite(ctx, invite); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error creating invite",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    invite,
+	})
+}
+
+func getInvite(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	invite, group, status, message := loadInvite(ctx, c.Params("token"))
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	placeholders := []models.Member{}
+	for _, m := range group.Members {
+		if m.UserID == "" && (invite.MemberID == "" || invite.MemberID == m.ID) {
+			placeholders = append(placeholders, m)
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data": models.InvitePreview{
+			GroupID:      group.GroupID,
+			GroupName:    group.Name,
+			MemberID:     invite.MemberID,
+			Placeholders: placeholders,
+			ExpiresAt:    invite.ExpiresAt,
+		},
+	})
+}
+
+func acceptInvite(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	var body struct {
+		MemberID string `json:"memberId"`
+	}
+	c.BodyParser(&body) // Ignore error, member is optional
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	invite, group, status, message := loadInvite(ctx, c.Params("token"))
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	// Accepting an invite to a group you're already in is a no-op
+	if group.UserID == user.UID || findLinkedMember(group.Members, user.UID) != nil {
+		return c.JSON(fiber.Map{
+			"success": true,
+			"data":    toGroupResponse(group),
+		})
+	}
+
+	memberID := invite.MemberID
+	if memberID == "" {
+		memberID = body.MemberID
+	}
+	// Claiming a placeholder links it; otherwise a new member is added
+	var before *models.ActivitySnapshot
+	if memberID != "" {
+		member := findMember(group.Members, memberID)
+		if member == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"success": false,
+				"message": "Member not found in group",
+			})
+		}
+		if member.UserID != "" {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"message": "Member is already linked to an account",
+			})
+		}
+		before = memberSnapshot(*member)
+	}
+
+	// Use up one redemption first so concurrent accepts can't exceed the
+	// limit or race the expiry
+	err := inviteStore.RedeemInvite(ctx, invite.Token)
+	if err == store.ErrInviteUnavailable {
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{
+			"success": false,
+			"message": "Invite has expired or has been used up",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error accepting invite",
+		})
+	}
+
+	var updatedGroup models.Group
+	if memberID != "" {
+		// Claim the placeholder, unless someone else linked it first
+		updatedGroup, err = groupStore.LinkMember(ctx, group.GroupID, memberID, user.UID, invite.Role)
+	} else {
+		updatedGroup, err = groupStore.AddMember(ctx, group.GroupID, models.Member{
+			ID:     strconv.FormatInt(time.Now().UnixNano(), 10),
+			Name:   user.Name,
+			UserID: user.UID,
+			Role:   invite.Role,
+		})
+	}
+
+	if err != nil {
+		// Give the redemption back since nobody joined
+		inviteStore.ReleaseInvite(ctx, invite.Token)
+
+		// A concurrent accept by the same user got there first, which
+		// makes this one the no-op it would have been a moment later
+		if err == store.ErrDuplicate {
+			if current, err := groupStore.GetGroup(ctx, group.GroupID); err == nil {
+				return c.JSON(fiber.Map{
+					"success": true,
+					"data":    toGroupResponse(current),
+				})
+			}
+		}
+		if err == store.ErrConflict {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"success": false,
+				"message": "Member is already linked to an account",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error accepting invite",
+		})
+	}
+
+	if member := findLinkedMember(updatedGroup.Members, user.UID); member != nil {
+		recordActivity(ctx, group.GroupID, user, models.ActivityMemberJoined, member.ID, before, memberSnapshot(*member))
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    toGroupResponse(updatedGroup),
+	})
+}
+
+// loadInvite fetches a usable invite and its group. On failure it returns
+// the HTTP status and message to respond with.
+func loadInvite(ctx context.Context, token string) (models.Invite, models.Group, int, string) {
+	invite, err := inviteStore.GetInvite(ctx, token)
+	if err == store.ErrNotFound {
+		return invite, models.Group{}, fiber.StatusNotFound, "Invite not found"
+	} else if err != nil {
+		return invite, models.Group{}, fiber.StatusInternalServerError, "Error fetching invite"
+	}
+
+	if time.Now().After(invite.ExpiresAt) || invite.Uses >= invite.MaxUses {
+		return invite, models.Group{}, fiber.StatusGone, "Invite has expired or has been used up"
+	}
+
+	group, err := groupStore.GetGroup(ctx, invite.GroupID)
+	if err == store.ErrNotFound {
+		return invite, group, fiber.StatusNotFound, "Group not found"
+	} else if err != nil {
+		return invite, group, fiber.StatusInternalServerError, "Error fetching group"
+	}
+
+	return invite, group, fiber.StatusOK, ""
+}
+
+// newInviteToken generates a random invite code
+func newInviteToken() (string, error) {
+	buf := make([]byte, inviteTokenLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	for i, b := range buf {
+		buf[i] = inviteTokenAlphabet[int(b)%len(inviteTokenAlphabet)]
+	}
+	return string(buf), nil
+}
+
+// findMember returns the member with the given ID, or nil
+func findMember(members []models.Member, id string) *models.Member {
+	for i := range members {
+		if members[i].ID == id {
+			return &members[i]
+		}
+	}
+	return nil
+}
+
+// findLinkedMember returns the member linked to the given user, or nil
+func findLinkedMember(members []models.Member, uid string) *models.Member {
+	for i := range members {
+		if members[i].UserID == uid {
+			return &members[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package routes
+
+import (
+	"context"
+	"split-it/backend/middleware"
+	"split-it/backend/models"
+	"split-it/backend/store"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func updateMemberRole(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+	memberId := c.Params("memberId")
+
+	var body struct {
+		Role models.Role `json:"role"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid request body",
+		})
+	}
+
+	if body.Role == models.RoleOwner || !middleware.ValidRole(body.Role) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Role must be admin, member or viewer",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	group, status, message := authorizeGroup(ctx, groupId, user, middleware.PermManageMembers)
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	member := findMember(group.Members, memberId)
+	if member == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Member not found",
+		})
+	}
+
+	if status, message := checkMemberManagement(group, user, *member); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	if status, message := checkRoleGrant(group, user, body.Role); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	updatedGroup, err := groupStore.SetMemberRole(ctx, groupId, memberId, body.Role)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Member not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error updating member role",
+		})
+	}
+
+	if updated := findMember(updatedGroup.Members, memberId); updated != nil {
+		recordActivity(ctx, groupId, user, models.ActivityMemberRoleChanged, memberId, memberSnapshot(*member), memberSnapshot(*updated))
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    toGroupResponse(updatedGroup),
+	})
+}
+
+func removeMember(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+	memberId := c.Params("memberId")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	group, status, message := authorizeGroup(ctx, groupId, user, middleware.PermManageMembers)
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	member := findMember(group.Members, memberId)
+	if member == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Member not found",
+		})
+	}
+
+	if status, message := checkMemberManagement(group, user, *member); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	err := groupStore.RemoveMember(ctx, groupId, memberId)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Group not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error removing member",
+		})
+	}
+
+	recordActivity(ctx, groupId, user, models.ActivityMemberRemoved, memberId, memberSnapshot(*member), nil)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Member removed successfully",
+	})
+}
+
+// checkMemberManagement enforces who may change or remove a member: the
+// owner can never be changed, and only the owner can change an admin.
+// On failure it returns the status and message to respond with.
+func checkMemberManagement(group models.Group, user *middleware.UserContext, member models.Member) (int, string) {
+	if member.UserID != "" && member.UserID == group.UserID {
+		return fiber.StatusBadRequest, "The group owner cannot be changed or removed"
+	}
+
+	if member.Role == models.RoleAdmin && group.RoleOf(user.UID) != models.RoleOwner {
+		return fiber.StatusForbidden, "Only the owner can change or remove an admin"
+	}
+
+	return fiber.StatusOK, ""
+}
+
+// checkRoleGrant enforces who may hand out a role, whether directly or
+// through an invite: only the owner can make someone an admin.
+// On failure it returns the status and message to respond with.
+func checkRoleGrant(group models.Group, user *middleware.UserContext, role models.Role) (int, string) {
+	if role == models.RoleAdmin && group.RoleOf(user.UID) != models.RoleOwner {
+		return fiber.StatusForbidden, "Only the owner can make someone an admin"
+	}
+	return fiber.StatusOK, ""
+}
@@ -0,0 +1,202 @@
+package routes
+
+import (
+	"context"
+	"split-it/backend/middleware"
+	"split-it/backend/models"
+	"split-it/backend/money"
+	"split-it/backend/store"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func getPayments(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	group, status, message := authorizeGroup(ctx, c.Params("groupId"), user, middleware.PermViewGroup)
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	payments := group.Payments
+	if payments == nil {
+		payments = []models.Payment{}
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    payments,
+	})
+}
+
+func addPayment(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+
+	var body struct {
+		ID     string       `json:"id"`
+		From   string       `json:"from"`
+		To     string       `json:"to"`
+		Amount money.Amount `json:"amount"`
+		Note   string       `json:"note"`
+	}
+
+	if err := c.BodyParser(&body); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid request body",
+		})
+	}
+
+	if body.From == "" || body.To == "" || body.Amount <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Payer, recipient and a positive amount are required",
+		})
+	}
+
+	if body.From == body.To {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "A member cannot pay themselves",
+		})
+	}
+
+	// Generate ID if not provided
+	paymentID := body.ID
+	if paymentID == "" {
+		paymentID = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+
+	newPayment := models.Payment{
+		ID:     paymentID,
+		From:   body.From,
+		To:     body.To,
+		Amount: body.Amount,
+		Note:   body.Note,
+		Date:   time.Now(),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	group, status, message := authorizeGroup(ctx, groupId, user, middleware.PermEditExpenses)
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	if findMember(group.Members, body.From) == nil || findMember(group.Members, body.To) == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Payer and recipient must be members of the group",
+		})
+	}
+
+	err := groupStore.AddPayment(ctx, groupId, newPayment)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Group not found",
+		})
+	} else if err == store.ErrDuplicate {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "A payment with that ID already exists",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error recording payment",
+		})
+	}
+
+	recordActivity(ctx, groupId, user, models.ActivityPaymentAdded, newPayment.ID, nil, paymentSnapshot(newPayment))
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    newPayment,
+	})
+}
+
+func deletePayment(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+	paymentId := c.Params("paymentId")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	group, status, message := authorizeGroup(ctx, groupId, user, middleware.PermEditExpenses)
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	// The group was just found, so it's the payment that is missing
+	err := groupStore.DeletePayment(ctx, groupId, paymentId)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Payment not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error deleting payment",
+		})
+	}
+
+	var before *models.ActivitySnapshot
+	if payment := findPayment(group.Payments, paymentId); payment != nil {
+		before = paymentSnapshot(*payment)
+	}
+	recordActivity(ctx, groupId, user, models.ActivityPaymentDeleted, paymentId, before, nil)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Payment deleted successfully",
+	})
+}
+
+// findPayment returns the payment with the given ID, or nil
+func findPayment(payments []models.Payment, id string) *models.Payment {
+	for i := range payments {
+		if payments[i].ID == id {
+			return &payments[i]
+		}
+	}
+	return nil
+}
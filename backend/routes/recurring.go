@@ -0,0 +1,378 @@
+package routes
+
+import (
+	"context"
+	"split-it/backend/middleware"
+	"split-it/backend/models"
+	"split-it/backend/recurring"
+	"split-it/backend/store"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxInterval is the most units a recurring expense can skip between runs
+const maxInterval = 365
+
+// recurringBody is the request body for creating or editing a recurring
+// expense: the expense to repeat plus its schedule. Its id, if given, is the
+// recurring expense's own ID. Backfill allows a new schedule to start more
+// than one interval in the past.
+type recurringBody struct {
+	expenseBody
+	Frequency models.Frequency `json:"frequency"`
+	Interval  int              `json:"interval"`
+	StartDate string           `json:"startDate"`
+	EndDate   string           `json:"endDate"`
+	Backfill  bool             `json:"backfill"`
+}
+
+func getRecurring(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, status, message := authorizeGroup(ctx, groupId, user, middleware.PermViewGroup); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	list, err := recurringStore.ListRecurring(ctx, groupId)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Group not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error fetching recurring expenses",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    list,
+	})
+}
+
+func addRecurring(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+
+	newRecurring, backfill, message := parseRecurringBody(c)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	// Every past run is added on the scheduler's next pass, so a start date
+	// long ago has to be asked for
+	if !backfill && recurring.Backdated(newRecurring, time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Start date is more than one interval in the past; set backfill to add the past runs",
+		})
+	}
+
+	// Generate ID if not provided
+	if newRecurring.ID == "" {
+		newRecurring.ID = strconv.FormatInt(time.Now().UnixNano(), 10)
+	}
+	newRecurring.GroupID = groupId
+	newRecurring.CreatedBy = user.UID
+	newRecurring.CreatedAt = time.Now()
+	// Runs since a start date in the past are made on the scheduler's next
+	// pass
+	newRecurring.NextRun = recurring.NextRun(newRecurring, newRecurring.StartDate)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	group, status, message := authorizeGroup(ctx, groupId, user, middleware.PermEditExpenses)
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	if !group.HasCategory(newRecurring.Template.Category) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Unknown category",
+		})
+	}
+
+	if message := checkExpenseMembers(group.Members, newRecurring.Template.Expense("", time.Time{}), nil); message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	if message := checkTemplateRate(group, newRecurring.Template); message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	err := recurringStore.CreateRecurring(ctx, newRecurring)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Group not found",
+		})
+	} else if err == store.ErrDuplicate {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "A recurring expense with that ID already exists",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error adding recurring expense",
+		})
+	}
+
+	recordActivity(ctx, groupId, user, models.ActivityRecurringAdded, newRecurring.ID, nil, recurringSnapshot(newRecurring))
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"success": true,
+		"data":    newRecurring,
+	})
+}
+
+func updateRecurring(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+	recurringId := c.Params("recurringId")
+
+	// Past runs aren't made again, so there's nothing to backfill
+	edited, _, message := parseRecurringBody(c)
+	if message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+	edited.ID = recurringId
+	edited.GroupID = groupId
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	group, status, message := authorizeGroup(ctx, groupId, user, middleware.PermEditExpenses)
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	current, err := recurringStore.GetRecurring(ctx, groupId, recurringId)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Recurring expense not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error updating recurring expense",
+		})
+	}
+
+	// A category the group has since removed can stay on the template
+	if edited.Template.Category != current.Template.Category && !group.HasCategory(edited.Template.Category) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Unknown category",
+		})
+	}
+
+	previous := current.Template.Expense("", time.Time{})
+	if message := checkExpenseMembers(group.Members, edited.Template.Expense("", time.Time{}), &previous); message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	if message := checkTemplateRate(group, edited.Template); message != "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	// The new schedule takes over from now, except that runs the scheduler
+	// hasn't made yet are still made; past runs aren't made again
+	from := time.Now()
+	if current.NextRun != nil && current.NextRun.Before(from) {
+		from = *current.NextRun
+	}
+	edited.NextRun = recurring.NextRun(edited, from)
+
+	updated, err := recurringStore.UpdateRecurring(ctx, edited)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Recurring expense not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error updating recurring expense",
+		})
+	}
+
+	recordActivity(ctx, groupId, user, models.ActivityRecurringUpdated, recurringId, recurringSnapshot(current), recurringSnapshot(updated))
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    updated,
+	})
+}
+
+func deleteRecurring(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+	recurringId := c.Params("recurringId")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, status, message := authorizeGroup(ctx, groupId, user, middleware.PermEditExpenses); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	// The recurring expense as it was, for the activity log
+	var before *models.ActivitySnapshot
+	if current, err := recurringStore.GetRecurring(ctx, groupId, recurringId); err == nil {
+		before = recurringSnapshot(current)
+	}
+
+	// Expenses it already added stay in the group
+	err := recurringStore.DeleteRecurring(ctx, groupId, recurringId)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Recurring expense not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error deleting recurring expense",
+		})
+	}
+
+	recordActivity(ctx, groupId, user, models.ActivityRecurringDeleted, recurringId, before, nil)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": "Recurring expense deleted successfully",
+	})
+}
+
+// parseRecurringBody reads a recurring expense from the request body,
+// validating its template like any other expense, and reports whether the
+// body asks for past runs to be backfilled. It returns a message if the
+// body is invalid. The next run is left for the caller to work out.
+func parseRecurringBody(c *fiber.Ctx) (models.RecurringExpense, bool, string) {
+	var body recurringBody
+	if err := c.BodyParser(&body); err != nil {
+		return models.RecurringExpense{}, false, "Invalid request body"
+	}
+
+	expense, err := body.expense()
+	if err != nil {
+		return models.RecurringExpense{}, false, err.Error()
+	}
+
+	r := models.RecurringExpense{
+		ID:        body.ID,
+		Template:  models.NewExpenseTemplate(expense),
+		Frequency: body.Frequency,
+		Interval:  body.Interval,
+	}
+
+	if !recurring.ValidFrequency(r.Frequency) {
+		return r, false, "Frequency must be one of daily, weekly, monthly or yearly"
+	}
+	if r.Interval == 0 {
+		r.Interval = 1
+	}
+	if r.Interval < 1 || r.Interval > maxInterval {
+		return r, false, "Interval must be between 1 and " + strconv.Itoa(maxInterval)
+	}
+
+	if r.StartDate, err = parseQueryDate(body.StartDate, false); err != nil {
+		return r, false, "Invalid start date"
+	}
+	if r.StartDate.IsZero() {
+		r.StartDate = time.Now().Truncate(time.Second)
+	}
+
+	end, err := parseQueryDate(body.EndDate, true)
+	if err != nil {
+		return r, false, "Invalid end date"
+	}
+	if !end.IsZero() {
+		if !end.After(r.StartDate) {
+			return r, false, "End date must be after the start date"
+		}
+		r.EndDate = &end
+	}
+	return r, body.Backfill, ""
+}
+
+// checkTemplateRate checks that a template in a foreign currency either
+// has an exchange rate or can have one looked up on the day of each run.
+// It returns a message if not.
+func checkTemplateRate(group models.Group, template models.ExpenseTemplate) string {
+	base := group.BaseCurrency()
+	if template.Currency != "" && template.Currency != base && template.ExchangeRate == 0 && rateProvider == nil {
+		return "An exchange rate to " + base + " is required for expenses in " + template.Currency
+	}
+	return ""
+}
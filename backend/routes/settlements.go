@@ -0,0 +1,87 @@
+package routes
+
+import (
+	"context"
+	"split-it/backend/middleware"
+	"split-it/backend/settlement"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func getBalances(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	group, status, message := authorizeGroup(ctx, c.Params("groupId"), user, middleware.PermViewGroup)
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	if err := loadGroupExpenses(ctx, &group); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error fetching group",
+		})
+	}
+
+	balances, skipped := settlement.ComputeBalances(group)
+	return c.JSON(withSkipped(fiber.Map{
+		"success": true,
+		"data":    balances,
+	}, skipped))
+}
+
+func getSettlements(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	group, status, message := authorizeGroup(ctx, c.Params("groupId"), user, middleware.PermViewGroup)
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	if err := loadGroupExpenses(ctx, &group); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error fetching group",
+		})
+	}
+
+	balances, skipped := settlement.ComputeBalances(group)
+	return c.JSON(withSkipped(fiber.Map{
+		"success": true,
+		"data":    settlement.Simplify(balances),
+	}, skipped))
+}
+
+// withSkipped adds the expenses a computation left out to its response, if
+// there are any, so clients can point them out
+func withSkipped(response fiber.Map, skipped []settlement.SkippedExpense) fiber.Map {
+	if len(skipped) > 0 {
+		response["skipped"] = skipped
+	}
+	return response
+}
@@ -0,0 +1,69 @@
+package routes
+
+import (
+	"context"
+	"split-it/backend/middleware"
+	"split-it/backend/settlement"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// getStats summarizes a group's spending, optionally limited to expenses
+// dated within from (inclusive) and to (exclusive)
+func getStats(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	from, err := parseQueryDate(c.Query("from"), false)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid from date",
+		})
+	}
+	to, err := parseQueryDate(c.Query("to"), true)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"success": false,
+			"message": "Invalid to date",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	group, status, message := authorizeGroup(ctx, c.Params("groupId"), user, middleware.PermViewGroup)
+	if status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	if err := loadGroupExpenses(ctx, &group); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error fetching group",
+		})
+	}
+
+	// Filtering in place is safe; the expenses were loaded for this request
+	expenses := group.Expenses[:0]
+	for _, e := range group.Expenses {
+		if (from.IsZero() || !e.Date.Before(from)) && (to.IsZero() || e.Date.Before(to)) {
+			expenses = append(expenses, e)
+		}
+	}
+	group.Expenses = expenses
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    settlement.ComputeStats(group),
+	})
+}
@@ -0,0 +1,206 @@
+package routes
+
+import (
+	"context"
+	"split-it/backend/middleware"
+	"split-it/backend/models"
+	"split-it/backend/store"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	trashStore store.TrashStore
+	// trashRetention is how long deleted items stay in the trash
+	trashRetention time.Duration
+)
+
+func getTrashedGroups(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	groups, err := trashStore.ListTrashedGroups(ctx, user.UID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error fetching trash",
+		})
+	}
+
+	summaries, err := groupSummaries(ctx, groups, user.UID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error fetching trash",
+		})
+	}
+	for i, g := range groups {
+		expiresAt := g.DeletedAt.Add(trashRetention)
+		summaries[i].DeletedAt = g.DeletedAt
+		summaries[i].ExpiresAt = &expiresAt
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    summaries,
+	})
+}
+
+func restoreGroup(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Only those who could delete the group can bring it back
+	group, err := trashStore.GetTrashedGroup(ctx, groupId)
+	if err == store.ErrNotFound || (err == nil && group.RoleOf(user.UID) == "") {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Group not found in trash",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error restoring group",
+		})
+	}
+	if !middleware.CanAccessGroup(user, group, middleware.PermDeleteGroup) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"success": false,
+			"message": "You don't have permission to do that",
+		})
+	}
+
+	restored, err := trashStore.RestoreGroup(ctx, groupId)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Group not found in trash",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error restoring group",
+		})
+	}
+
+	recordActivity(ctx, groupId, user, models.ActivityGroupRestored, "", nil, nil)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    toGroupResponse(restored),
+	})
+}
+
+func getTrash(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, status, message := authorizeGroup(ctx, groupId, user, middleware.PermViewGroup); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	trashed, err := trashStore.ListTrashedExpenses(ctx, groupId)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Group not found",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error fetching trash",
+		})
+	}
+
+	// Attachments of trashed expenses can't be downloaded, so they get no
+	// links until they are restored
+	for i := range trashed {
+		trashed[i].ExpiresAt = trashed[i].DeletedAt.Add(trashRetention)
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    trashed,
+	})
+}
+
+func restoreExpense(c *fiber.Ctx) error {
+	user := middleware.GetUserFromContext(c)
+	if user == nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"success": false,
+			"message": "Unauthorized",
+		})
+	}
+
+	groupId := c.Params("groupId")
+	expenseId := c.Params("expenseId")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, status, message := authorizeGroup(ctx, groupId, user, middleware.PermEditExpenses); status != fiber.StatusOK {
+		return c.Status(status).JSON(fiber.Map{
+			"success": false,
+			"message": message,
+		})
+	}
+
+	expense, err := trashStore.RestoreExpense(ctx, groupId, expenseId)
+	if err == store.ErrNotFound {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"success": false,
+			"message": "Expense not found in trash",
+		})
+	} else if err == store.ErrDuplicate {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"success": false,
+			"message": "An expense with that ID already exists",
+		})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"success": false,
+			"message": "Error restoring expense",
+		})
+	}
+
+	recordActivity(ctx, groupId, user, models.ActivityExpenseRestored, expenseId, nil, expenseSnapshot(expense))
+	addAttachmentURLs(c, groupId, expense.ID, expense.Attachments)
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"data":    expense,
+	})
+}
@@ -2,26 +2,28 @@ package routes
 
 import (
 	"context"
-	"split-it/backend/config"
 	"split-it/backend/middleware"
 	"split-it/backend/models"
+	"split-it/backend/store"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
+var userStore store.UserStore
+
 // SetupUserRoutes configures user-related routes
-func SetupUserRoutes(app *fiber.App) {
-	users := app.Group("/api/users")
+func SetupUserRoutes(app *fiber.App, users store.UserStore) {
+	userStore = users
+
+	router := app.Group("/api/users")
 
 	// Get or create user profile
-	users.Post("/profile", middleware.AuthenticateUser, getOrCreateProfile)
+	router.Post("/profile", middleware.AuthenticateUser, getOrCreateProfile)
 
 	// Update user profile
-	users.Put("/profile", middleware.AuthenticateUser, updateProfile)
+	router.Put("/profile", middleware.AuthenticateUser, updateProfile)
 }
 
 func getOrCreateProfile(c *fiber.Ctx) error {
@@ -39,17 +41,13 @@ func getOrCreateProfile(c *fiber.Ctx) error {
 	}
 	c.BodyParser(&body) // Ignore error, phone is optional
 
-	db := config.GetDB()
-	collection := db.Collection("users")
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// Try to find existing user
-	var existingUser models.User
-	err := collection.FindOne(ctx, bson.M{"firebaseUid": user.UID}).Decode(&existingUser)
+	existingUser, err := userStore.GetUser(ctx, user.UID)
 
-	if err == mongo.ErrNoDocuments {
+	if err == store.ErrNotFound {
 		// Create new user
 		phone := body.Phone
 
@@ -64,8 +62,7 @@ func getOrCreateProfile(c *fiber.Ctx) error {
 			UpdatedAt:     time.Now(),
 		}
 
-		_, err := collection.InsertOne(ctx, newUser)
-		if err != nil {
+		if err := userStore.CreateUser(ctx, newUser); err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 				"success": false,
 				"message": "Error creating user profile",
@@ -127,28 +124,10 @@ func updateProfile(c *fiber.Ctx) error {
 		})
 	}
 
-	db := config.GetDB()
-	collection := db.Collection("users")
-
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	update := bson.M{
-		"$set": bson.M{
-			"name":      body.Name,
-			"phone":     body.Phone,
-			"updatedAt": time.Now(),
-		},
-	}
-
-	var updatedUser models.User
-	err := collection.FindOneAndUpdate(
-		ctx,
-		bson.M{"firebaseUid": user.UID},
-		update,
-		// mongo.options.FindOneAndUpdate().SetReturnDocument(mongo.options.After),
-	).Decode(&updatedUser)
-
+	updatedUser, err := userStore.UpdateUser(ctx, user.UID, body.Name, body.Phone)
 	if err != nil {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 			"success": false,
@@ -162,8 +141,8 @@ func updateProfile(c *fiber.Ctx) error {
 			ID:            updatedUser.ID.Hex(),
 			FirebaseUID:   updatedUser.FirebaseUID,
 			Email:         updatedUser.Email,
-			Name:          body.Name,  // Use the updated name from body
-			Phone:         body.Phone, // Use the updated phone from body
+			Name:          updatedUser.Name,
+			Phone:         updatedUser.Phone,
 			EmailVerified: updatedUser.EmailVerified,
 		},
 	})
@@ -0,0 +1,201 @@
+// Package settlement computes per-member balances for a group and the
+// simplified set of transfers needed to settle them.
+package settlement
+
+import (
+	"sort"
+	"split-it/backend/models"
+	"split-it/backend/money"
+)
+
+// MemberBalance represents a member's position within a group.
+// Paid and Owed only cover expenses; Sent and Received cover settle-up
+// payments between members.
+type MemberBalance struct {
+	MemberID string       `json:"memberId"`
+	Name     string       `json:"name"`
+	Paid     money.Amount `json:"paid"`
+	Owed     money.Amount `json:"owed"`
+	Sent     money.Amount `json:"sent"`
+	Received money.Amount `json:"received"`
+	Balance  money.Amount `json:"balance"`
+}
+
+// SkippedExpense is an expense left out of balances or stats because its
+// split can't be worked out, such as a legacy expense whose exact amounts
+// don't add up
+type SkippedExpense struct {
+	ExpenseID string `json:"expenseId"`
+	Reason    string `json:"reason"`
+}
+
+// Transfer represents a single payment from a debtor to a creditor
+type Transfer struct {
+	From   string       `json:"from"`
+	To     string       `json:"to"`
+	Amount money.Amount `json:"amount"`
+}
+
+// ComputeBalances returns the net balance of every member in the group.
+// A positive balance means the member is owed money, a negative balance
+// means the member owes money. Members that appear in expenses but are no
+// longer part of the group are still reported so balances always sum to zero.
+// Each expense is credited to its payers and divided according to its split
+// specification, in the group's base currency. Recorded payments move the
+// sender towards being owed and the recipient towards owing. Expenses whose
+// split can't be worked out are left out and returned alongside, so one bad
+// expense doesn't keep the rest of the group from being balanced.
+func ComputeBalances(group models.Group) ([]MemberBalance, []SkippedExpense) {
+	index := make(map[string]int, len(group.Members))
+	balances := make([]MemberBalance, 0, len(group.Members))
+
+	for _, m := range group.Members {
+		index[m.ID] = len(balances)
+		balances = append(balances, MemberBalance{MemberID: m.ID, Name: m.Name})
+	}
+
+	entry := func(memberID string) *MemberBalance {
+		if i, ok := index[memberID]; ok {
+			return &balances[i]
+		}
+		index[memberID] = len(balances)
+		balances = append(balances, MemberBalance{MemberID: memberID})
+		return &balances[len(balances)-1]
+	}
+
+	var skipped []SkippedExpense
+	for _, e := range group.Expenses {
+		paid, owed, err := baseShares(e)
+		if err != nil {
+			skipped = append(skipped, SkippedExpense{ExpenseID: e.ID, Reason: err.Error()})
+			continue
+		}
+		for _, p := range paid {
+			entry(p.MemberID).Paid += p.Amount
+		}
+		for _, o := range owed {
+			entry(o.MemberID).Owed += o.Amount
+		}
+	}
+
+	for _, p := range group.Payments {
+		entry(p.From).Sent += p.Amount
+		entry(p.To).Received += p.Amount
+	}
+
+	for i := range balances {
+		b := &balances[i]
+		b.Balance = b.Paid - b.Owed + b.Sent - b.Received
+	}
+
+	return balances, skipped
+}
+
+// baseShares returns what each member paid towards an expense and what
+// each owes for it, both in the group's base currency
+func baseShares(e models.Expense) (paid, owed []Share, err error) {
+	payers, err := ExpensePayers(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	shares, err := ExpenseShares(e)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	amounts := make([]money.Amount, len(payers))
+	for i, p := range payers {
+		amounts[i] = p.Amount
+	}
+	for i, amount := range inBaseCurrency(e, amounts) {
+		paid = append(paid, Share{MemberID: payers[i].MemberID, Amount: amount})
+	}
+
+	amounts = make([]money.Amount, len(shares))
+	for i, s := range shares {
+		amounts[i] = s.Amount
+	}
+	for i, amount := range inBaseCurrency(e, amounts) {
+		owed = append(owed, Share{MemberID: shares[i].MemberID, Amount: amount})
+	}
+	return paid, owed, nil
+}
+
+// inBaseCurrency converts the per-member amounts of an expense to the
+// group's base currency. Converting each amount on its own could leave the
+// parts a cent off the converted total, so the total is allocated in
+// proportion to the original amounts instead.
+func inBaseCurrency(e models.Expense, amounts []money.Amount) []money.Amount {
+	total := e.AmountInBase()
+	if total == e.Amount {
+		return amounts
+	}
+
+	weights := make([]int64, len(amounts))
+	for i, a := range amounts {
+		if a < 0 {
+			a = -a
+		}
+		weights[i] = int64(a)
+	}
+	if parts := money.Allocate(total, weights); parts != nil {
+		return parts
+	}
+	// Nothing to allocate against when every amount is zero
+	return make([]money.Amount, len(amounts))
+}
+
+// Simplify produces a minimal list of transfers that settles all balances.
+// Debtors and creditors are matched greedily, largest amounts first.
+func Simplify(balances []MemberBalance) []Transfer {
+	type position struct {
+		memberID string
+		amount   money.Amount
+	}
+
+	var creditors, debtors []position
+	for _, b := range balances {
+		if b.Balance > 0 {
+			creditors = append(creditors, position{b.MemberID, b.Balance})
+		} else if b.Balance < 0 {
+			debtors = append(debtors, position{b.MemberID, -b.Balance})
+		}
+	}
+
+	byAmount := func(p []position) func(i, j int) bool {
+		return func(i, j int) bool {
+			if p[i].amount != p[j].amount {
+				return p[i].amount > p[j].amount
+			}
+			return p[i].memberID < p[j].memberID
+		}
+	}
+	sort.SliceStable(creditors, byAmount(creditors))
+	sort.SliceStable(debtors, byAmount(debtors))
+
+	transfers := []Transfer{}
+	i, j := 0, 0
+	for i < len(creditors) && j < len(debtors) {
+		creditor := &creditors[i]
+		debtor := &debtors[j]
+
+		amount := min(creditor.amount, debtor.amount)
+		transfers = append(transfers, Transfer{
+			From:   debtor.memberID,
+			To:     creditor.memberID,
+			Amount: amount,
+		})
+
+		creditor.amount -= amount
+		debtor.amount -= amount
+
+		if creditor.amount == 0 {
+			i++
+		}
+		if debtor.amount == 0 {
+			j++
+		}
+	}
+
+	return transfers
+}
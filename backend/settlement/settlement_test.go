@@ -0,0 +1,169 @@
+package settlement
+
+import (
+	"split-it/backend/models"
+	"split-it/backend/money"
+	"testing"
+)
+
+func TestComputeBalances(t *testing.T) {
+	members := []models.Member{{ID: "m1", Name: "Alice"}, {ID: "m2", Name: "Bob"}, {ID: "m3", Name: "Carol"}}
+
+	tests := []struct {
+		name     string
+		expenses []models.Expense
+		payments []models.Payment
+		want     map[string]money.Amount
+		skipped  []string
+	}{
+		{
+			name: "no expenses",
+			want: map[string]money.Amount{"m1": 0, "m2": 0, "m3": 0},
+		},
+		{
+			name: "equal split with a remainder",
+			expenses: []models.Expense{
+				{ID: "e1", Amount: 1000, PaidBy: "m1", Participants: []string{"m1", "m2", "m3"}},
+			},
+			want: map[string]money.Amount{"m1": 666, "m2": -333, "m3": -333},
+		},
+		{
+			name: "payments settle debts",
+			expenses: []models.Expense{
+				{ID: "e1", Amount: 3000, PaidBy: "m1", Participants: []string{"m1", "m2", "m3"}},
+			},
+			payments: []models.Payment{{ID: "p1", From: "m2", To: "m1", Amount: 1000}},
+			want:     map[string]money.Amount{"m1": 1000, "m2": 0, "m3": -1000},
+		},
+		{
+			name: "former members are still reported",
+			expenses: []models.Expense{
+				{ID: "e1", Amount: 2000, PaidBy: "m4", Participants: []string{"m1", "m4"}},
+			},
+			want: map[string]money.Amount{"m1": -1000, "m2": 0, "m3": 0, "m4": 1000},
+		},
+		{
+			name: "invalid expenses are skipped",
+			expenses: []models.Expense{
+				{ID: "e1", Amount: 1200, PaidBy: "m1", Participants: []string{"m1", "m2"}},
+				{ID: "bad-split", Amount: 5000, PaidBy: "m2", Split: &models.Split{
+					Type:  models.SplitExact,
+					Parts: []models.SplitPart{{MemberID: "m1", Amount: 1000}, {MemberID: "m3", Amount: 1000}},
+				}},
+				{ID: "no-participants", Amount: 900, PaidBy: "m3"},
+				{ID: "no-payer", Amount: 900, Participants: []string{"m1"}},
+			},
+			want:    map[string]money.Amount{"m1": 600, "m2": -600, "m3": 0},
+			skipped: []string{"bad-split", "no-participants", "no-payer"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			group := models.Group{Members: members, Expenses: tt.expenses, Payments: tt.payments}
+			balances, skipped := ComputeBalances(group)
+
+			if len(balances) != len(tt.want) {
+				t.Fatalf("got %d balances, want %d: %+v", len(balances), len(tt.want), balances)
+			}
+			var sum money.Amount
+			for _, b := range balances {
+				if want, ok := tt.want[b.MemberID]; !ok || b.Balance != want {
+					t.Errorf("balance of %s = %v, want %v", b.MemberID, b.Balance, want)
+				}
+				if b.Balance != b.Paid-b.Owed+b.Sent-b.Received {
+					t.Errorf("balance of %s doesn't add up: %+v", b.MemberID, b)
+				}
+				sum += b.Balance
+			}
+			if sum != 0 {
+				t.Errorf("balances sum to %v, want 0", sum)
+			}
+
+			if len(skipped) != len(tt.skipped) {
+				t.Fatalf("skipped %+v, want %v", skipped, tt.skipped)
+			}
+			for i, s := range skipped {
+				if s.ExpenseID != tt.skipped[i] || s.Reason == "" {
+					t.Errorf("skipped[%d] = %+v, want %s with a reason", i, s, tt.skipped[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSimplify(t *testing.T) {
+	tests := []struct {
+		name     string
+		balances []money.Amount
+		want     []Transfer
+	}{
+		{
+			name:     "settled",
+			balances: []money.Amount{0, 0},
+			want:     []Transfer{},
+		},
+		{
+			name:     "one debt",
+			balances: []money.Amount{500, -500},
+			want:     []Transfer{{From: "m2", To: "m1", Amount: 500}},
+		},
+		{
+			name:     "largest amounts first",
+			balances: []money.Amount{700, -300, -400},
+			want:     []Transfer{{From: "m3", To: "m1", Amount: 400}, {From: "m2", To: "m1", Amount: 300}},
+		},
+		{
+			name:     "ties broken by member ID",
+			balances: []money.Amount{-250, 250, -250, 250},
+			want:     []Transfer{{From: "m1", To: "m2", Amount: 250}, {From: "m3", To: "m4", Amount: 250}},
+		},
+		{
+			name:     "many members",
+			balances: []money.Amount{1234, -1, -333, 5000, -2900, -3000, 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			balances := make([]MemberBalance, len(tt.balances))
+			net := make(map[string]money.Amount, len(tt.balances))
+			for i, b := range tt.balances {
+				id := "m" + string(rune('1'+i))
+				balances[i] = MemberBalance{MemberID: id, Balance: b}
+				net[id] = b
+			}
+
+			transfers := Simplify(balances)
+
+			if tt.want != nil {
+				if len(transfers) != len(tt.want) {
+					t.Fatalf("got %+v, want %+v", transfers, tt.want)
+				}
+				for i := range tt.want {
+					if transfers[i] != tt.want[i] {
+						t.Errorf("transfer %d = %+v, want %+v", i, transfers[i], tt.want[i])
+					}
+				}
+			}
+
+			// Paying every transfer leaves everyone settled, in at most
+			// one transfer fewer than there are members
+			for _, tr := range transfers {
+				if tr.Amount <= 0 {
+					t.Errorf("transfer %+v isn't positive", tr)
+				}
+				net[tr.From] += tr.Amount
+				net[tr.To] -= tr.Amount
+			}
+			for id, b := range net {
+				if b != 0 {
+					t.Errorf("%s is left with %v", id, b)
+				}
+			}
+			if len(balances) > 0 && len(transfers) > len(balances)-1 {
+				t.Errorf("%d transfers for %d members", len(transfers), len(balances))
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package settlement
+
+import (
+	"errors"
+	"math"
+	"split-it/backend/models"
+	"split-it/backend/money"
+)
+
+// percentScale converts percentages to basis points
+const percentScale = 100
+
+var (
+	ErrNoParticipants    = errors.New("expense must have at least one participant")
+	ErrDuplicateMember   = errors.New("a member appears more than once in the split")
+	ErrUnknownSplitType  = errors.New("unknown split type")
+	ErrExactMismatch     = errors.New("exact split amounts must sum to the expense amount")
+	ErrNegativeSplitPart = errors.New("split parts cannot be negative")
+	ErrPercentPrecision  = errors.New("split percentages can have at most two decimal places")
+	ErrPercentMismatch   = errors.New("split percentages must sum to 100")
+	ErrNoShares          = errors.New("split shares must add up to more than zero")
+	ErrNoPayer           = errors.New("expense must have at least one payer")
+	ErrDuplicatePayer    = errors.New("a member appears more than once in the payers")
+	ErrNegativePayer     = errors.New("payer amounts cannot be negative")
+	ErrPayerMismatch     = errors.New("payer amounts must sum to the expense amount")
+	ErrNoItems           = errors.New("itemized split must have at least one item")
+	ErrNegativeItem      = errors.New("item amounts, tax and tip cannot be negative")
+	ErrNoItemTotal       = errors.New("item amounts must add up to more than zero")
+	ErrItemsMismatch     = errors.New("item amounts plus tax and tip must sum to the expense amount")
+)
+
+// Share is the portion of an expense owed by a single member
+type Share struct {
+	MemberID string       `json:"memberId"`
+	Amount   money.Amount `json:"amount"`
+}
+
+// ExpenseShares returns what each participant owes for an expense.
+//
+// Expenses without a split specification are divided equally between their
+// participants. Itemized splits are worked out from their items; their parts
+// are ignored. The returned shares always sum exactly to the expense amount;
+// an error is returned when the split specification is inconsistent.
+func ExpenseShares(e models.Expense) ([]Share, error) {
+	if e.Split == nil {
+		return equalShares(e.Amount, e.Participants)
+	}
+	if e.Split.Type == models.SplitItemized {
+		return itemizedShares(e.Amount, *e.Split)
+	}
+
+	parts := e.Split.Parts
+	if len(parts) == 0 {
+		return nil, ErrNoParticipants
+	}
+
+	seen := make(map[string]bool, len(parts))
+	for _, p := range parts {
+		if seen[p.MemberID] {
+			return nil, ErrDuplicateMember
+		}
+		seen[p.MemberID] = true
+	}
+
+	switch e.Split.Type {
+	case models.SplitEqual, "":
+		members := make([]string, len(parts))
+		for i, p := range parts {
+			members[i] = p.MemberID
+		}
+		return equalShares(e.Amount, members)
+
+	case models.SplitExact:
+		shares := make([]Share, len(parts))
+		var total money.Amount
+		for i, p := range parts {
+			if p.Amount < 0 {
+				return nil, ErrNegativeSplitPart
+			}
+			shares[i] = Share{MemberID: p.MemberID, Amount: p.Amount}
+			total += p.Amount
+		}
+		if total != e.Amount {
+			return nil, ErrExactMismatch
+		}
+		return shares, nil
+
+	case models.SplitPercent:
+		weights := make([]int64, len(parts))
+		var total int64
+		for i, p := range parts {
+			if p.Percent < 0 {
+				return nil, ErrNegativeSplitPart
+			}
+			bp := math.Round(p.Percent * percentScale)
+			if math.Abs(p.Percent*percentScale-bp) > 1e-6 {
+				return nil, ErrPercentPrecision
+			}
+			weights[i] = int64(bp)
+			total += weights[i]
+		}
+		if total != 100*percentScale {
+			return nil, ErrPercentMismatch
+		}
+		return weightedShares(e.Amount, parts, weights), nil
+
+	case models.SplitShares:
+		weights := make([]int64, len(parts))
+		var total int64
+		for i, p := range parts {
+			if p.Shares < 0 {
+				return nil, ErrNegativeSplitPart
+			}
+			weights[i] = p.Shares
+			total += p.Shares
+		}
+		if total <= 0 {
+			return nil, ErrNoShares
+		}
+		return weightedShares(e.Amount, parts, weights), nil
+	}
+
+	return nil, ErrUnknownSplitType
+}
+
+// ExpensePayers returns how much each member paid towards an expense.
+//
+// Expenses without a payer list were paid in full by PaidBy. Otherwise the
+// payer amounts must sum exactly to the expense amount.
+func ExpensePayers(e models.Expense) ([]models.Payer, error) {
+	if len(e.Payers) == 0 {
+		if e.PaidBy == "" {
+			return nil, ErrNoPayer
+		}
+		return []models.Payer{{MemberID: e.PaidBy, Amount: e.Amount}}, nil
+	}
+
+	seen := make(map[string]bool, len(e.Payers))
+	var total money.Amount
+	for _, p := range e.Payers {
+		if seen[p.MemberID] {
+			return nil, ErrDuplicatePayer
+		}
+		seen[p.MemberID] = true
+
+		if p.Amount < 0 {
+			return nil, ErrNegativePayer
+		}
+		total += p.Amount
+	}
+
+	if total != e.Amount {
+		return nil, ErrPayerMismatch
+	}
+	return e.Payers, nil
+}
+
+// SplitMembers returns the IDs of the members taking part in an expense
+func SplitMembers(e models.Expense) []string {
+	if e.Split == nil {
+		return e.Participants
+	}
+
+	members := make([]string, len(e.Split.Parts))
+	for i, p := range e.Split.Parts {
+		members[i] = p.MemberID
+	}
+	return members
+}
+
+func equalShares(amount money.Amount, members []string) ([]Share, error) {
+	if len(members) == 0 {
+		return nil, ErrNoParticipants
+	}
+
+	amounts := money.Split(amount, len(members))
+	shares := make([]Share, len(members))
+	for i, m := range members {
+		shares[i] = Share{MemberID: m, Amount: amounts[i]}
+	}
+	return shares, nil
+}
+
+// itemizedShares divides each item equally between its participants, then
+// spreads tax and tip in proportion to what each member's items came to.
+// Members are listed in the order they first appear in the items.
+func itemizedShares(amount money.Amount, split models.Split) ([]Share, error) {
+	if len(split.Items) == 0 {
+		return nil, ErrNoItems
+	}
+	if split.Tax < 0 || split.Tip < 0 {
+		return nil, ErrNegativeItem
+	}
+
+	var members []string
+	subtotals := make(map[string]money.Amount)
+	total := split.Tax + split.Tip
+	for _, item := range split.Items {
+		if item.Amount < 0 {
+			return nil, ErrNegativeItem
+		}
+		if len(item.Participants) == 0 {
+			return nil, ErrNoParticipants
+		}
+
+		seen := make(map[string]bool, len(item.Participants))
+		for _, m := range item.Participants {
+			if seen[m] {
+				return nil, ErrDuplicateMember
+			}
+			seen[m] = true
+		}
+
+		for i, a := range money.Split(item.Amount, len(item.Participants)) {
+			m := item.Participants[i]
+			if _, ok := subtotals[m]; !ok {
+				members = append(members, m)
+			}
+			subtotals[m] += a
+		}
+		total += item.Amount
+	}
+	if total != amount {
+		return nil, ErrItemsMismatch
+	}
+
+	weights := make([]int64, len(members))
+	for i, m := range members {
+		weights[i] = int64(subtotals[m])
+	}
+	extras := money.Allocate(split.Tax+split.Tip, weights)
+	if extras == nil {
+		return nil, ErrNoItemTotal
+	}
+
+	shares := make([]Share, len(members))
+	for i, m := range members {
+		shares[i] = Share{MemberID: m, Amount: subtotals[m] + extras[i]}
+	}
+	return shares, nil
+}
+
+func weightedShares(amount money.Amount, parts []models.SplitPart, weights []int64) []Share {
+	amounts := money.Allocate(amount, weights)
+	shares := make([]Share, len(parts))
+	for i, p := range parts {
+		shares[i] = Share{MemberID: p.MemberID, Amount: amounts[i]}
+	}
+	return shares
+}
@@ -0,0 +1,347 @@
+package settlement
+
+import (
+	"split-it/backend/models"
+	"split-it/backend/money"
+	"testing"
+)
+
+func TestExpenseShares(t *testing.T) {
+	parts := func(ps ...models.SplitPart) *models.Split {
+		return &models.Split{Parts: ps}
+	}
+	typed := func(typ models.SplitType, split *models.Split) *models.Split {
+		split.Type = typ
+		return split
+	}
+
+	tests := []struct {
+		name         string
+		amount       money.Amount
+		participants []string
+		split        *models.Split
+		want         []Share
+		err          error
+	}{
+		{
+			name:         "participants split equally",
+			amount:       1000,
+			participants: []string{"m1", "m2", "m3"},
+			want:         []Share{{"m1", 334}, {"m2", 333}, {"m3", 333}},
+		},
+		{
+			name:   "no participants",
+			amount: 1000,
+			err:    ErrNoParticipants,
+		},
+		{
+			name:   "equal split over its parts",
+			amount: 1001,
+			split:  typed(models.SplitEqual, parts(models.SplitPart{MemberID: "m2"}, models.SplitPart{MemberID: "m1"})),
+			want:   []Share{{"m2", 501}, {"m1", 500}},
+		},
+		{
+			name:   "untyped split is equal",
+			amount: 600,
+			split:  parts(models.SplitPart{MemberID: "m1"}, models.SplitPart{MemberID: "m2"}, models.SplitPart{MemberID: "m3"}),
+			want:   []Share{{"m1", 200}, {"m2", 200}, {"m3", 200}},
+		},
+		{
+			name:   "exact",
+			amount: 1000,
+			split:  typed(models.SplitExact, parts(models.SplitPart{MemberID: "m1", Amount: 250}, models.SplitPart{MemberID: "m2", Amount: 750})),
+			want:   []Share{{"m1", 250}, {"m2", 750}},
+		},
+		{
+			name:   "exact amounts that don't add up",
+			amount: 1000,
+			split:  typed(models.SplitExact, parts(models.SplitPart{MemberID: "m1", Amount: 250}, models.SplitPart{MemberID: "m2", Amount: 700})),
+			err:    ErrExactMismatch,
+		},
+		{
+			name:   "negative exact amount",
+			amount: 1000,
+			split:  typed(models.SplitExact, parts(models.SplitPart{MemberID: "m1", Amount: -250}, models.SplitPart{MemberID: "m2", Amount: 1250})),
+			err:    ErrNegativeSplitPart,
+		},
+		{
+			name:   "percent",
+			amount: 1000,
+			split:  typed(models.SplitPercent, parts(models.SplitPart{MemberID: "m1", Percent: 33.33}, models.SplitPart{MemberID: "m2", Percent: 66.67})),
+			want:   []Share{{"m1", 333}, {"m2", 667}},
+		},
+		{
+			name:   "percent with cents left over",
+			amount: 100,
+			split:  typed(models.SplitPercent, parts(models.SplitPart{MemberID: "m1", Percent: 33.33}, models.SplitPart{MemberID: "m2", Percent: 33.33}, models.SplitPart{MemberID: "m3", Percent: 33.34})),
+			want:   []Share{{"m1", 33}, {"m2", 33}, {"m3", 34}},
+		},
+		{
+			name:   "percentages that don't add up to 100",
+			amount: 1000,
+			split:  typed(models.SplitPercent, parts(models.SplitPart{MemberID: "m1", Percent: 50}, models.SplitPart{MemberID: "m2", Percent: 49.99})),
+			err:    ErrPercentMismatch,
+		},
+		{
+			name:   "percent with three decimals",
+			amount: 1000,
+			split:  typed(models.SplitPercent, parts(models.SplitPart{MemberID: "m1", Percent: 50.005}, models.SplitPart{MemberID: "m2", Percent: 49.995})),
+			err:    ErrPercentPrecision,
+		},
+		{
+			name:   "shares",
+			amount: 1000,
+			split:  typed(models.SplitShares, parts(models.SplitPart{MemberID: "m1", Shares: 2}, models.SplitPart{MemberID: "m2", Shares: 1})),
+			want:   []Share{{"m1", 667}, {"m2", 333}},
+		},
+		{
+			name:   "zero shares",
+			amount: 1000,
+			split:  typed(models.SplitShares, parts(models.SplitPart{MemberID: "m1"}, models.SplitPart{MemberID: "m2"})),
+			err:    ErrNoShares,
+		},
+		{
+			name:   "negative shares",
+			amount: 1000,
+			split:  typed(models.SplitShares, parts(models.SplitPart{MemberID: "m1", Shares: 3}, models.SplitPart{MemberID: "m2", Shares: -1})),
+			err:    ErrNegativeSplitPart,
+		},
+		{
+			name:   "member listed twice",
+			amount: 1000,
+			split:  typed(models.SplitShares, parts(models.SplitPart{MemberID: "m1", Shares: 1}, models.SplitPart{MemberID: "m1", Shares: 1})),
+			err:    ErrDuplicateMember,
+		},
+		{
+			name:   "split without parts",
+			amount: 1000,
+			split:  typed(models.SplitExact, parts()),
+			err:    ErrNoParticipants,
+		},
+		{
+			name:   "unknown type",
+			amount: 1000,
+			split:  typed("halves", parts(models.SplitPart{MemberID: "m1"})),
+			err:    ErrUnknownSplitType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := models.Expense{ID: "e1", Amount: tt.amount, PaidBy: "m1", Participants: tt.participants, Split: tt.split}
+			got, err := ExpenseShares(e)
+			if err != tt.err {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if !sameShares(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpensePayers(t *testing.T) {
+	tests := []struct {
+		name   string
+		paidBy string
+		payers []models.Payer
+		want   []models.Payer
+		err    error
+	}{
+		{
+			name:   "single payer",
+			paidBy: "m1",
+			want:   []models.Payer{{MemberID: "m1", Amount: 1000}},
+		},
+		{
+			name:   "several payers",
+			payers: []models.Payer{{MemberID: "m1", Amount: 400}, {MemberID: "m2", Amount: 600}},
+			want:   []models.Payer{{MemberID: "m1", Amount: 400}, {MemberID: "m2", Amount: 600}},
+		},
+		{
+			name: "no payer",
+			err:  ErrNoPayer,
+		},
+		{
+			name:   "payers that don't add up",
+			payers: []models.Payer{{MemberID: "m1", Amount: 400}, {MemberID: "m2", Amount: 500}},
+			err:    ErrPayerMismatch,
+		},
+		{
+			name:   "payer listed twice",
+			payers: []models.Payer{{MemberID: "m1", Amount: 500}, {MemberID: "m1", Amount: 500}},
+			err:    ErrDuplicatePayer,
+		},
+		{
+			name:   "negative payer",
+			payers: []models.Payer{{MemberID: "m1", Amount: 1100}, {MemberID: "m2", Amount: -100}},
+			err:    ErrNegativePayer,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := models.Expense{ID: "e1", Amount: 1000, PaidBy: tt.paidBy, Payers: tt.payers}
+			got, err := ExpensePayers(e)
+			if err != tt.err {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("payer %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func sameShares(a, b []Share) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestItemizedShares(t *testing.T) {
+	item := func(amount money.Amount, participants ...string) models.LineItem {
+		return models.LineItem{Amount: amount, Participants: participants}
+	}
+
+	tests := []struct {
+		name     string
+		amount   money.Amount
+		items    []models.LineItem
+		tax, tip money.Amount
+		want     []Share
+		err      error
+	}{
+		{
+			name:   "items without tax or tip",
+			amount: 1600,
+			items:  []models.LineItem{item(1000, "m1"), item(600, "m1", "m2")},
+			want:   []Share{{"m1", 1300}, {"m2", 300}},
+		},
+		{
+			name:   "tax and tip in proportion to items",
+			amount: 4800,
+			items:  []models.LineItem{item(3000, "m1"), item(1000, "m2")},
+			tax:    400,
+			tip:    400,
+			want:   []Share{{"m1", 3600}, {"m2", 1200}},
+		},
+		{
+			name:   "tax tied between members goes to the earliest",
+			amount: 400,
+			items:  []models.LineItem{item(100, "m1"), item(100, "m2"), item(100, "m3")},
+			tax:    100,
+			want:   []Share{{"m1", 134}, {"m2", 133}, {"m3", 133}},
+		},
+		{
+			name:   "leftover tip goes to the largest fraction",
+			amount: 1001,
+			items:  []models.LineItem{item(200, "m3"), item(500, "m1"), item(300, "m2")},
+			tip:    1,
+			want:   []Share{{"m3", 200}, {"m1", 501}, {"m2", 300}},
+		},
+		{
+			name:   "uneven item split weighs the tax",
+			amount: 1010,
+			items:  []models.LineItem{item(1000, "m1", "m2", "m3")},
+			tax:    10,
+			want:   []Share{{"m1", 338}, {"m2", 336}, {"m3", 336}},
+		},
+		{
+			name:   "members in the order they first appear",
+			amount: 300,
+			items:  []models.LineItem{item(200, "m2"), item(100, "m1", "m2")},
+			want:   []Share{{"m2", 250}, {"m1", 50}},
+		},
+		{
+			name:   "free item carries no tip",
+			amount: 1100,
+			items:  []models.LineItem{item(0, "m3"), item(1000, "m1")},
+			tip:    100,
+			want:   []Share{{"m3", 0}, {"m1", 1100}},
+		},
+		{
+			name: "no items",
+			tax:  100,
+			err:  ErrNoItems,
+		},
+		{
+			name:   "negative tax",
+			amount: 900,
+			items:  []models.LineItem{item(1000, "m1")},
+			tax:    -100,
+			err:    ErrNegativeItem,
+		},
+		{
+			name:   "negative tip",
+			amount: 900,
+			items:  []models.LineItem{item(1000, "m1")},
+			tip:    -100,
+			err:    ErrNegativeItem,
+		},
+		{
+			name:   "negative item",
+			amount: 500,
+			items:  []models.LineItem{item(1000, "m1"), item(-500, "m2")},
+			err:    ErrNegativeItem,
+		},
+		{
+			name:   "item without participants",
+			amount: 1000,
+			items:  []models.LineItem{item(1000)},
+			err:    ErrNoParticipants,
+		},
+		{
+			name:   "member listed twice on an item",
+			amount: 1000,
+			items:  []models.LineItem{item(1000, "m1", "m1")},
+			err:    ErrDuplicateMember,
+		},
+		{
+			name:   "items, tax and tip that don't add up",
+			amount: 1000,
+			items:  []models.LineItem{item(1000, "m1")},
+			tax:    100,
+			err:    ErrItemsMismatch,
+		},
+		{
+			name:   "tax on free items only",
+			amount: 100,
+			items:  []models.LineItem{item(0, "m1")},
+			tax:    100,
+			err:    ErrNoItemTotal,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			split := models.Split{Type: models.SplitItemized, Items: tt.items, Tax: tt.tax, Tip: tt.tip}
+			got, err := itemizedShares(tt.amount, split)
+			if err != tt.err {
+				t.Fatalf("got error %v, want %v", err, tt.err)
+			}
+			if !sameShares(got, tt.want) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+
+			var total money.Amount
+			for _, s := range got {
+				total += s.Amount
+			}
+			if err == nil && total != tt.amount {
+				t.Errorf("shares sum to %v, want %v", total, tt.amount)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package settlement
+
+import (
+	"sort"
+	"split-it/backend/models"
+	"split-it/backend/money"
+)
+
+// monthLayout formats the month of an expense, in UTC
+const monthLayout = "2006-01"
+
+// Stats summarizes the spending in a group. Every amount is in the group's
+// base currency. Settle-up payments aren't spending and are left out.
+type Stats struct {
+	Currency     string       `json:"currency"`
+	Total        money.Amount `json:"total"`
+	ExpenseCount int          `json:"expenseCount"`
+	// ByCategory is ordered by total, largest first. Uncategorized
+	// expenses are counted under the empty category.
+	ByCategory []CategoryTotal `json:"byCategory"`
+	// ByMonth is in calendar order and skips months without expenses
+	ByMonth []MonthTotal `json:"byMonth"`
+	// ByPayer is what each member paid towards expenses
+	ByPayer []MemberTotal `json:"byPayer"`
+	// Consumption is each member's share of the expenses, whoever paid
+	Consumption []MemberTotal `json:"consumption"`
+	// Skipped lists the expenses left out because their split can't be
+	// worked out
+	Skipped []SkippedExpense `json:"skipped,omitempty"`
+}
+
+// CategoryTotal is the spending in one expense category
+type CategoryTotal struct {
+	Category string       `json:"category"`
+	Total    money.Amount `json:"total"`
+	Count    int          `json:"count"`
+}
+
+// MonthTotal is the spending in one calendar month, formatted as YYYY-MM
+type MonthTotal struct {
+	Month string       `json:"month"`
+	Total money.Amount `json:"total"`
+	Count int          `json:"count"`
+}
+
+// MemberTotal is an amount attributed to one member
+type MemberTotal struct {
+	MemberID string       `json:"memberId"`
+	Name     string       `json:"name"`
+	Total    money.Amount `json:"total"`
+}
+
+// ComputeStats summarizes the group's loaded expenses. Like balances,
+// member totals list every member of the group, followed by former members
+// who appear in the expenses. Expenses skipped by balances are skipped here
+// too, and don't count towards any total.
+func ComputeStats(group models.Group) Stats {
+	stats := Stats{
+		Currency:   group.BaseCurrency(),
+		ByCategory: []CategoryTotal{},
+		ByMonth:    []MonthTotal{},
+	}
+
+	categories := make(map[string]*CategoryTotal)
+	months := make(map[string]*MonthTotal)
+	payers := newMemberTotals(group.Members)
+	consumers := newMemberTotals(group.Members)
+
+	for _, e := range group.Expenses {
+		paid, owed, err := baseShares(e)
+		if err != nil {
+			stats.Skipped = append(stats.Skipped, SkippedExpense{ExpenseID: e.ID, Reason: err.Error()})
+			continue
+		}
+
+		amount := e.AmountInBase()
+		stats.Total += amount
+		stats.ExpenseCount++
+
+		category, ok := categories[e.Category]
+		if !ok {
+			category = &CategoryTotal{Category: e.Category}
+			categories[e.Category] = category
+		}
+		category.Total += amount
+		category.Count++
+
+		key := e.Date.UTC().Format(monthLayout)
+		month, ok := months[key]
+		if !ok {
+			month = &MonthTotal{Month: key}
+			months[key] = month
+		}
+		month.Total += amount
+		month.Count++
+
+		for _, p := range paid {
+			payers.add(p)
+		}
+		for _, o := range owed {
+			consumers.add(o)
+		}
+	}
+
+	for _, c := range categories {
+		stats.ByCategory = append(stats.ByCategory, *c)
+	}
+	sort.Slice(stats.ByCategory, func(i, j int) bool {
+		a, b := stats.ByCategory[i], stats.ByCategory[j]
+		if a.Total != b.Total {
+			return a.Total > b.Total
+		}
+		return a.Category < b.Category
+	})
+
+	for _, m := range months {
+		stats.ByMonth = append(stats.ByMonth, *m)
+	}
+	sort.Slice(stats.ByMonth, func(i, j int) bool {
+		return stats.ByMonth[i].Month < stats.ByMonth[j].Month
+	})
+
+	stats.ByPayer = payers.totals
+	stats.Consumption = consumers.totals
+	return stats
+}
+
+// memberTotals accumulates per-member amounts in member order
+type memberTotals struct {
+	totals []MemberTotal
+	index  map[string]int
+}
+
+func newMemberTotals(members []models.Member) *memberTotals {
+	t := &memberTotals{
+		totals: make([]MemberTotal, 0, len(members)),
+		index:  make(map[string]int, len(members)),
+	}
+	for _, m := range members {
+		t.index[m.ID] = len(t.totals)
+		t.totals = append(t.totals, MemberTotal{MemberID: m.ID, Name: m.Name})
+	}
+	return t
+}
+
+// add credits a share to its member, adding former members as they appear
+func (t *memberTotals) add(s Share) {
+	i, ok := t.index[s.MemberID]
+	if !ok {
+		i = len(t.totals)
+		t.index[s.MemberID] = i
+		t.totals = append(t.totals, MemberTotal{MemberID: s.MemberID})
+	}
+	t.totals[i].Total += s.Amount
+}
@@ -0,0 +1,120 @@
+package settlement
+
+import (
+	"split-it/backend/models"
+	"split-it/backend/money"
+	"testing"
+	"time"
+)
+
+func TestComputeStats(t *testing.T) {
+	members := []models.Member{{ID: "m1", Name: "Alice"}, {ID: "m2", Name: "Bob"}, {ID: "m3", Name: "Carol"}}
+	date := func(s string) time.Time {
+		d, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return d
+	}
+
+	group := models.Group{
+		Currency: "USD",
+		Members:  members,
+		Expenses: []models.Expense{
+			{ID: "e1", Amount: 3000, PaidBy: "m1", Participants: []string{"m1", "m2", "m3"}, Category: "Food", Date: date("2024-01-15T12:00:00Z")},
+			// 10.00 EUR is 11.00 in the base currency; just after midnight
+			// in UTC+2 is still January in UTC
+			{ID: "e2", Amount: 1000, Currency: "EUR", ExchangeRate: 1.1, BaseAmount: 1100, PaidBy: "m2", Participants: []string{"m1", "m2"}, Category: "Travel", Date: date("2024-02-01T00:30:00+02:00")},
+			// Paid by a former member, without a category
+			{ID: "e3", Amount: 2000, PaidBy: "m4", Participants: []string{"m1", "m4"}, Date: date("2024-03-02T09:00:00Z")},
+			{ID: "bad", Amount: 9900, PaidBy: "m1", Category: "Food", Date: date("2024-03-05T09:00:00Z"), Split: &models.Split{
+				Type:  models.SplitExact,
+				Parts: []models.SplitPart{{MemberID: "m1", Amount: 100}},
+			}},
+			{ID: "e4", Amount: 500, PaidBy: "m1", Participants: []string{"m2"}, Category: "Food", Date: date("2024-03-10T18:00:00Z")},
+		},
+		// Settling up isn't spending
+		Payments: []models.Payment{{ID: "p1", From: "m2", To: "m1", Amount: 1000}},
+	}
+
+	stats := ComputeStats(group)
+
+	if stats.Currency != "USD" || stats.Total != 6600 || stats.ExpenseCount != 4 {
+		t.Errorf("got %s %v over %d expenses, want USD 66.00 over 4", stats.Currency, stats.Total, stats.ExpenseCount)
+	}
+
+	wantCategories := []CategoryTotal{{"Food", 3500, 2}, {"", 2000, 1}, {"Travel", 1100, 1}}
+	if len(stats.ByCategory) != len(wantCategories) {
+		t.Fatalf("by category = %+v, want %+v", stats.ByCategory, wantCategories)
+	}
+	for i, want := range wantCategories {
+		if stats.ByCategory[i] != want {
+			t.Errorf("category %d = %+v, want %+v", i, stats.ByCategory[i], want)
+		}
+	}
+
+	wantMonths := []MonthTotal{{"2024-01", 4100, 2}, {"2024-03", 2500, 2}}
+	if len(stats.ByMonth) != len(wantMonths) {
+		t.Fatalf("by month = %+v, want %+v", stats.ByMonth, wantMonths)
+	}
+	for i, want := range wantMonths {
+		if stats.ByMonth[i] != want {
+			t.Errorf("month %d = %+v, want %+v", i, stats.ByMonth[i], want)
+		}
+	}
+
+	wantPayers := []MemberTotal{{"m1", "Alice", 3500}, {"m2", "Bob", 1100}, {"m3", "Carol", 0}, {"m4", "", 2000}}
+	checkMemberTotals(t, "paid", stats.ByPayer, wantPayers)
+	wantConsumption := []MemberTotal{{"m1", "Alice", 2550}, {"m2", "Bob", 2050}, {"m3", "Carol", 1000}, {"m4", "", 1000}}
+	checkMemberTotals(t, "consumed", stats.Consumption, wantConsumption)
+
+	if len(stats.Skipped) != 1 || stats.Skipped[0].ExpenseID != "bad" || stats.Skipped[0].Reason == "" {
+		t.Errorf("skipped %+v, want bad with a reason", stats.Skipped)
+	}
+}
+
+func TestComputeStatsEmpty(t *testing.T) {
+	stats := ComputeStats(models.Group{Members: []models.Member{{ID: "m1", Name: "Alice"}}})
+
+	if stats.Currency != money.DefaultCurrency || stats.Total != 0 || stats.ExpenseCount != 0 {
+		t.Errorf("got %+v", stats)
+	}
+	// Empty lists rather than null, so clients can iterate them
+	if stats.ByCategory == nil || stats.ByMonth == nil || len(stats.ByCategory)+len(stats.ByMonth) != 0 {
+		t.Errorf("by category %v and by month %v, want both empty", stats.ByCategory, stats.ByMonth)
+	}
+	checkMemberTotals(t, "paid", stats.ByPayer, []MemberTotal{{"m1", "Alice", 0}})
+	checkMemberTotals(t, "consumed", stats.Consumption, []MemberTotal{{"m1", "Alice", 0}})
+}
+
+func TestComputeStatsCategoryTies(t *testing.T) {
+	expense := func(id, category string, amount money.Amount) models.Expense {
+		return models.Expense{ID: id, Amount: amount, PaidBy: "m1", Participants: []string{"m1"}, Category: category}
+	}
+	stats := ComputeStats(models.Group{Expenses: []models.Expense{
+		expense("e1", "Rent", 1000), expense("e2", "Food", 1000), expense("e3", "Bills", 500), expense("e4", "Bills", 500),
+	}})
+
+	// Equal totals are ordered by name
+	want := []string{"Bills", "Food", "Rent"}
+	if len(stats.ByCategory) != len(want) {
+		t.Fatalf("by category = %+v", stats.ByCategory)
+	}
+	for i, c := range stats.ByCategory {
+		if c.Category != want[i] || c.Total != 1000 {
+			t.Errorf("category %d = %+v, want %s totalling 10.00", i, c, want[i])
+		}
+	}
+}
+
+func checkMemberTotals(t *testing.T, what string, got, want []MemberTotal) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("%s = %+v, want %+v", what, got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%s %d = %+v, want %+v", what, i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"encoding/base64"
+	"split-it/backend/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ActivityQuery selects a page of a group's activity log
+type ActivityQuery struct {
+	// Cursor is the NextCursor of the previous page, or empty for the first
+	Cursor string
+	Limit  int
+}
+
+// ActivityPage is one page of a group's activity log, newest first.
+// NextCursor is empty on the last page.
+type ActivityPage struct {
+	Activity   []models.Activity `json:"activity"`
+	NextCursor string            `json:"nextCursor,omitempty"`
+}
+
+// pageLimit clamps a requested page size
+func (q ActivityQuery) pageLimit() int {
+	if q.Limit <= 0 {
+		return DefaultPageSize
+	}
+	if q.Limit > MaxPageSize {
+		return MaxPageSize
+	}
+	return q.Limit
+}
+
+// activityCursor is the position after the last entry of a page. Entries
+// are ordered by time and then ID, both descending.
+type activityCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+func (c activityCursor) encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeActivityCursor parses a cursor, returning nil for an empty one
+func decodeActivityCursor(s string) (*activityCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &activityCursor{CreatedAt: time.Unix(0, n).UTC(), ID: id}, nil
+}
+
+// follows reports whether an entry comes after the cursor. Every entry
+// follows a nil cursor.
+func (c *activityCursor) follows(a models.Activity) bool {
+	if c == nil {
+		return true
+	}
+	return a.CreatedAt.Before(c.CreatedAt) || (a.CreatedAt.Equal(c.CreatedAt) && a.ID < c.ID)
+}
+
+// activityPage trims a result fetched with one extra entry to the limit,
+// setting the next cursor if there are more
+func activityPage(activity []models.Activity, limit int) ActivityPage {
+	if len(activity) <= limit {
+		return ActivityPage{Activity: activity}
+	}
+
+	activity = activity[:limit]
+	last := activity[limit-1]
+	return ActivityPage{
+		Activity:   activity,
+		NextCursor: activityCursor{CreatedAt: last.CreatedAt, ID: last.ID}.encode(),
+	}
+}
@@ -0,0 +1,150 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BlobStore keeps the contents of files, like the attachments of expenses,
+// under slash-separated keys
+type BlobStore interface {
+	// Put stores size bytes read from r under key, replacing any blob
+	// already there
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the blob stored under key
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the blob stored under key. Deleting a blob that
+	// doesn't exist is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// AttachmentKey returns the blob key of an expense attachment. The IDs are
+// escaped, and ones that escaping leaves as path segments of their own,
+// like "." and "..", are refused with ErrInvalidKey, so they can't add or
+// climb segments.
+func AttachmentKey(groupID, expenseID, attachmentID string) (string, error) {
+	segments := []string{groupID, expenseID, attachmentID}
+	for i, id := range segments {
+		if id == "" || id == "." || id == ".." || strings.Contains(id, "/") {
+			return "", ErrInvalidKey
+		}
+		segments[i] = url.PathEscape(id)
+	}
+	return strings.Join(segments, "/"), nil
+}
+
+// OpenBlobs returns the blob store selected by the BLOB_BACKEND environment
+// variable: "local" (the default) keeps blobs in the directory at BLOB_DIR,
+// and "s3" in the S3_BUCKET bucket of an S3-compatible service, such as
+// MinIO, at S3_ENDPOINT.
+func OpenBlobs() (BlobStore, error) {
+	backend := os.Getenv("BLOB_BACKEND")
+
+	switch backend {
+	case "", "local":
+		dir := os.Getenv("BLOB_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		return NewLocalBlobStore(dir)
+	case "s3":
+		return NewS3BlobStore(S3Config{
+			Endpoint:        os.Getenv("S3_ENDPOINT"),
+			Region:          os.Getenv("S3_REGION"),
+			Bucket:          os.Getenv("S3_BUCKET"),
+			AccessKeyID:     os.Getenv("S3_ACCESS_KEY_ID"),
+			SecretAccessKey: os.Getenv("S3_SECRET_ACCESS_KEY"),
+		})
+	}
+
+	return nil, fmt.Errorf("unknown BLOB_BACKEND %q", backend)
+}
+
+// ErrInvalidKey is returned for blob keys that would leave the blob
+// directory, and for IDs that can't be made into one
+var ErrInvalidKey = errors.New("invalid blob key")
+
+// LocalBlobStore implements BlobStore on the local filesystem, keeping each
+// blob in a file whose path below the store's directory is its key
+type LocalBlobStore struct {
+	dir string
+}
+
+// NewLocalBlobStore returns a blob store in dir, creating it if needed
+func NewLocalBlobStore(dir string) (*LocalBlobStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &LocalBlobStore{dir: dir}, nil
+}
+
+// Put writes a blob to a temporary file and moves it into place, so a
+// failed upload never leaves a partial blob behind
+func (s *LocalBlobStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get opens a blob's file
+func (s *LocalBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return f, err
+}
+
+// Delete removes a blob's file
+func (s *LocalBlobStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// path returns the file a key is stored in, refusing keys that are empty,
+// absolute or climb out of the store's directory
+func (s *LocalBlobStore) path(key string) (string, error) {
+	name := filepath.FromSlash(key)
+	if !filepath.IsLocal(name) {
+		return "", ErrInvalidKey
+	}
+	return filepath.Join(s.dir, name), nil
+}
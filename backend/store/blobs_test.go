@@ -0,0 +1,90 @@
+package store_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"split-it/backend/store"
+	"testing"
+)
+
+func TestAttachmentKey(t *testing.T) {
+	tests := []struct {
+		name                             string
+		groupID, expenseID, attachmentID string
+		want                             string
+	}{
+		{"plain", "g1", "e1", "a1", "g1/e1/a1"},
+		{"escaped", "g 1", "e?1", "a%1", "g%201/e%3F1/a%251"},
+		{"dots inside an ID", "g.1", "..e", "a..", "g.1/..e/a.."},
+		{"dot", "g1", ".", "a1", ""},
+		{"dot dot", "g1", "..", "a1", ""},
+		{"dot dot group", "..", "e1", "a1", ""},
+		{"dot dot attachment", "g1", "e1", "..", ""},
+		{"slash", "g1", "../e1", "a1", ""},
+		{"trailing slash", "g1", "e1/", "a1", ""},
+		{"empty", "g1", "", "a1", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := store.AttachmentKey(tt.groupID, tt.expenseID, tt.attachmentID)
+			if tt.want == "" {
+				if err != store.ErrInvalidKey {
+					t.Errorf("AttachmentKey = %q, %v; want ErrInvalidKey", got, err)
+				}
+			} else if err != nil || got != tt.want {
+				t.Errorf("AttachmentKey = %q, %v; want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	dir := filepath.Join(root, "blobs")
+	s, err := store.NewLocalBlobStore(dir)
+	if err != nil {
+		t.Fatalf("NewLocalBlobStore: %v", err)
+	}
+
+	key, err := store.AttachmentKey("g1", "e1", "a1")
+	if err != nil {
+		t.Fatalf("AttachmentKey: %v", err)
+	}
+	if err := s.Put(ctx, key, bytes.NewReader([]byte("receipt")), 7, "image/png"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	body, err := s.Get(ctx, key)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	got, err := io.ReadAll(body)
+	body.Close()
+	if err != nil || string(got) != "receipt" {
+		t.Errorf("read %q, %v; want receipt", got, err)
+	}
+
+	if err := s.Delete(ctx, key); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get(ctx, key); err != store.ErrNotFound {
+		t.Errorf("Get after Delete: got error %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, key); err != nil {
+		t.Errorf("deleting a missing blob: %v", err)
+	}
+
+	// Keys can't reach outside the directory
+	for _, key := range []string{"", "../outside", "g1/../../outside", "/outside"} {
+		if err := s.Put(ctx, key, bytes.NewReader([]byte("x")), 1, "text/plain"); err != store.ErrInvalidKey {
+			t.Errorf("Put(%q): got error %v, want ErrInvalidKey", key, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "outside")); !os.IsNotExist(err) {
+		t.Errorf("a blob was written outside the store: %v", err)
+	}
+}
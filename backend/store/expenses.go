@@ -0,0 +1,262 @@
+package store
+
+import (
+	"cmp"
+	"encoding/base64"
+	"slices"
+	"split-it/backend/models"
+	"split-it/backend/money"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultPageSize is the number of expenses or groups in a page when no
+	// limit is given
+	DefaultPageSize = 20
+	// MaxPageSize is the largest page ListExpenses returns, and the largest
+	// page of groups a client can ask for
+	MaxPageSize = 100
+)
+
+// ExpenseSort is the order of an expense listing: a field name, prefixed
+// with "-" for descending order. Ties are broken by expense ID in the same
+// direction.
+type ExpenseSort string
+
+const (
+	SortNewest   ExpenseSort = "-date"
+	SortOldest   ExpenseSort = "date"
+	SortLargest  ExpenseSort = "-amount"
+	SortSmallest ExpenseSort = "amount"
+)
+
+// Valid reports whether the sort is one of the supported orders
+func (s ExpenseSort) Valid() bool {
+	switch s {
+	case SortNewest, SortOldest, SortLargest, SortSmallest:
+		return true
+	}
+	return false
+}
+
+// Field returns the name of the field expenses are ordered by
+func (s ExpenseSort) Field() string {
+	return strings.TrimPrefix(string(s), "-")
+}
+
+// Descending reports whether the largest values come first
+func (s ExpenseSort) Descending() bool {
+	return strings.HasPrefix(string(s), "-")
+}
+
+// ExpenseQuery selects a page of a group's expenses. Zero-valued filters
+// match everything.
+type ExpenseQuery struct {
+	// Cursor is the NextCursor of the previous page, or empty for the first.
+	// It is only valid with the same sort and filters.
+	Cursor string
+	Limit  int
+	// Sort defaults to SortNewest
+	Sort ExpenseSort
+
+	// From and To bound the expense date; From is inclusive, To exclusive
+	From time.Time
+	To   time.Time
+	// PaidBy matches expenses the member paid for, alone or as one of
+	// several payers
+	PaidBy string
+	// Participant matches expenses the member shares in
+	Participant string
+	// MinAmount and MaxAmount bound the amount in the group's base
+	// currency, both inclusive
+	MinAmount *money.Amount
+	MaxAmount *money.Amount
+	// Search matches descriptions containing the text, ignoring case
+	Search string
+	// Category matches expenses in the category
+	Category string
+	// Tag matches expenses carrying the tag
+	Tag string
+}
+
+// ExpensePage is one page of expenses. NextCursor is empty on the last page.
+type ExpensePage struct {
+	Expenses   []models.Expense `json:"expenses"`
+	NextCursor string           `json:"nextCursor,omitempty"`
+}
+
+// ExpenseTotal summarizes the expenses of a group
+type ExpenseTotal struct {
+	Count int64        `json:"count"`
+	Total money.Amount `json:"total"`
+}
+
+// pageLimit clamps a requested page size
+func (q ExpenseQuery) pageLimit() int {
+	if q.Limit <= 0 {
+		return DefaultPageSize
+	}
+	if q.Limit > MaxPageSize {
+		return MaxPageSize
+	}
+	return q.Limit
+}
+
+// sort returns the query's order, applying the default
+func (q ExpenseQuery) sort() ExpenseSort {
+	if q.Sort == "" {
+		return SortNewest
+	}
+	return q.Sort
+}
+
+// matches reports whether an expense passes the query's filters
+func (q ExpenseQuery) matches(e models.Expense) bool {
+	if !q.From.IsZero() && e.Date.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && !e.Date.Before(q.To) {
+		return false
+	}
+	if q.PaidBy != "" && !paidBy(e, q.PaidBy) {
+		return false
+	}
+	if q.Participant != "" && !slices.Contains(e.Participants, q.Participant) {
+		return false
+	}
+	if q.MinAmount != nil && e.AmountInBase() < *q.MinAmount {
+		return false
+	}
+	if q.MaxAmount != nil && e.AmountInBase() > *q.MaxAmount {
+		return false
+	}
+	if q.Search != "" && !strings.Contains(strings.ToLower(e.Description), strings.ToLower(q.Search)) {
+		return false
+	}
+	if q.Category != "" && e.Category != q.Category {
+		return false
+	}
+	if q.Tag != "" && !slices.Contains(e.Tags, q.Tag) {
+		return false
+	}
+	return true
+}
+
+// paidBy reports whether a member paid for an expense
+func paidBy(e models.Expense, memberID string) bool {
+	if e.PaidBy == memberID {
+		return true
+	}
+	for _, p := range e.Payers {
+		if p.MemberID == memberID {
+			return true
+		}
+	}
+	return false
+}
+
+// expenseCursor is the position after the last expense of a page: the sort
+// key and ID of that expense
+type expenseCursor struct {
+	Sort   ExpenseSort
+	Date   time.Time
+	Amount money.Amount
+	ID     string
+}
+
+// cursorAfter returns the cursor following an expense in the given order
+func cursorAfter(order ExpenseSort, e models.Expense) expenseCursor {
+	return expenseCursor{Sort: order, Date: e.Date, Amount: e.AmountInBase(), ID: e.ID}
+}
+
+func (c expenseCursor) encode() string {
+	var key int64
+	if c.Sort.Field() == "amount" {
+		key = int64(c.Amount)
+	} else {
+		key = c.Date.UnixNano()
+	}
+	raw := string(c.Sort) + ":" + strconv.FormatInt(key, 10) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor for the given order, returning nil for an
+// empty one. Cursors from a listing in another order are rejected.
+func decodeCursor(s string, order ExpenseSort) (*expenseCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), ":", 3)
+	if len(parts) != 3 || ExpenseSort(parts[0]) != order {
+		return nil, ErrInvalidCursor
+	}
+	key, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	c := &expenseCursor{Sort: order, ID: parts[2]}
+	if order.Field() == "amount" {
+		c.Amount = money.Amount(key)
+	} else {
+		c.Date = time.Unix(0, key).UTC()
+	}
+	return c, nil
+}
+
+// key returns the cursor's sort key as stored in the database
+func (c *expenseCursor) key() any {
+	if c.Sort.Field() == "amount" {
+		return c.Amount
+	}
+	return c.Date
+}
+
+// page trims a result fetched with one extra row to the limit, setting the
+// next cursor if there are more
+func page(expenses []models.Expense, limit int, order ExpenseSort) ExpensePage {
+	if len(expenses) <= limit {
+		return ExpensePage{Expenses: expenses}
+	}
+
+	expenses = expenses[:limit]
+	return ExpensePage{
+		Expenses:   expenses,
+		NextCursor: cursorAfter(order, expenses[limit-1]).encode(),
+	}
+}
+
+// compareExpenses orders two expenses by the sort field and then ID,
+// ascending
+func compareExpenses(a, b models.Expense, field string) int {
+	var c int
+	if field == "amount" {
+		c = cmp.Compare(a.AmountInBase(), b.AmountInBase())
+	} else {
+		c = a.Date.Compare(b.Date)
+	}
+	if c != 0 {
+		return c
+	}
+	return strings.Compare(a.ID, b.ID)
+}
+
+// follows reports whether an expense comes after the cursor. Every expense
+// follows a nil cursor.
+func (c *expenseCursor) follows(e models.Expense) bool {
+	if c == nil {
+		return true
+	}
+	diff := compareExpenses(e, models.Expense{Date: c.Date, Amount: c.Amount, ID: c.ID}, c.Sort.Field())
+	if c.Sort.Descending() {
+		return diff < 0
+	}
+	return diff > 0
+}
@@ -0,0 +1,81 @@
+package store
+
+import (
+	"encoding/base64"
+	"split-it/backend/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GroupQuery selects a page of a user's groups
+type GroupQuery struct {
+	// Cursor is the NextCursor of the previous page, or empty for the first
+	Cursor string
+	// Limit is the page size; zero returns every group
+	Limit int
+}
+
+// GroupPage is one page of groups, newest first. NextCursor is empty on the
+// last page.
+type GroupPage struct {
+	Groups     []models.Group
+	NextCursor string
+}
+
+// groupCursor is the position after the last group of a page. Groups are
+// ordered by creation time and then ID, both descending.
+type groupCursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+func (c groupCursor) encode() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + c.ID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeGroupCursor parses a cursor, returning nil for an empty one
+func decodeGroupCursor(s string) (*groupCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, ErrInvalidCursor
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &groupCursor{CreatedAt: time.Unix(0, n).UTC(), ID: id}, nil
+}
+
+// follows reports whether a group comes after the cursor. Every group
+// follows a nil cursor.
+func (c *groupCursor) follows(g models.Group) bool {
+	if c == nil {
+		return true
+	}
+	return g.CreatedAt.Before(c.CreatedAt) || (g.CreatedAt.Equal(c.CreatedAt) && g.GroupID < c.ID)
+}
+
+// groupPage trims a result fetched with one extra group to the limit,
+// setting the next cursor if there are more
+func groupPage(groups []models.Group, limit int) GroupPage {
+	if limit == 0 || len(groups) <= limit {
+		return GroupPage{Groups: groups}
+	}
+
+	groups = groups[:limit]
+	last := groups[limit-1]
+	return GroupPage{
+		Groups:     groups,
+		NextCursor: groupCursor{CreatedAt: last.CreatedAt, ID: last.GroupID}.encode(),
+	}
+}
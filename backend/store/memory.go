@@ -0,0 +1,914 @@
+package store
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"split-it/backend/models"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// MemoryStore implements Store in memory. It is safe for concurrent use
+// and is meant for tests and local development; nothing is persisted.
+// Map keys are always taken from the store's own copies, since strings
+// passed in by handlers may point into reused request buffers.
+type MemoryStore struct {
+	mu     sync.RWMutex
+	users  map[string]models.User
+	groups map[string]models.Group
+	// expenses holds each group's expenses in insertion order
+	expenses map[string][]models.Expense
+	invites  map[string]models.Invite
+	// recurring holds each group's recurring expenses in creation order
+	recurring map[string][]models.RecurringExpense
+	// activity holds each group's activity log in the order it was added
+	activity map[string][]models.Activity
+	// trash holds each group's trashed expenses in the order they were
+	// deleted
+	trash map[string][]models.TrashedExpense
+}
+
+// NewMemoryStore creates an empty in-memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		users:     make(map[string]models.User),
+		groups:    make(map[string]models.Group),
+		expenses:  make(map[string][]models.Expense),
+		invites:   make(map[string]models.Invite),
+		recurring: make(map[string][]models.RecurringExpense),
+		activity:  make(map[string][]models.Activity),
+		trash:     make(map[string][]models.TrashedExpense),
+	}
+}
+
+// GetUser finds a user by Firebase UID
+func (s *MemoryStore) GetUser(ctx context.Context, firebaseUID string) (models.User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[firebaseUID]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+	return clone(user), nil
+}
+
+// CreateUser inserts a new user
+func (s *MemoryStore) CreateUser(ctx context.Context, user models.User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[user.FirebaseUID]; ok {
+		return ErrDuplicate
+	}
+	user = clone(user)
+	s.users[user.FirebaseUID] = user
+	return nil
+}
+
+// UpdateUser changes a user's name and phone number
+func (s *MemoryStore) UpdateUser(ctx context.Context, firebaseUID, name, phone string) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[firebaseUID]
+	if !ok {
+		return models.User{}, ErrNotFound
+	}
+
+	user.Name = name
+	user.Phone = phone
+	user.UpdatedAt = time.Now()
+	s.users[user.FirebaseUID] = user
+	return clone(user), nil
+}
+
+// ListGroups returns a page of the groups a user owns or is a linked
+// member of
+func (s *MemoryStore) ListGroups(ctx context.Context, uid string, query GroupQuery) (GroupPage, error) {
+	cursor, err := decodeGroupCursor(query.Cursor)
+	if err != nil {
+		return GroupPage{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := []models.Group{}
+	for _, g := range s.groups {
+		if g.DeletedAt == nil && g.RoleOf(uid) != "" && cursor.follows(g) {
+			groups = append(groups, clone(g))
+		}
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		return a.CreatedAt.After(b.CreatedAt) || (a.CreatedAt.Equal(b.CreatedAt) && a.GroupID > b.GroupID)
+	})
+	if query.Limit > 0 && len(groups) > query.Limit+1 {
+		groups = groups[:query.Limit+1]
+	}
+	return groupPage(groups, query.Limit), nil
+}
+
+// GetGroup finds a group by ID
+func (s *MemoryStore) GetGroup(ctx context.Context, groupID string) (models.Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	group, ok := s.groups[groupID]
+	if !ok || group.DeletedAt != nil {
+		return models.Group{}, ErrNotFound
+	}
+	return clone(group), nil
+}
+
+// CreateGroup inserts a new group
+func (s *MemoryStore) CreateGroup(ctx context.Context, group models.Group) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.groups[group.GroupID]; ok {
+		return ErrDuplicate
+	}
+	group = clone(group)
+	s.expenses[group.GroupID] = withGroupID(group.Expenses, group.GroupID)
+	group.Expenses = nil
+	s.groups[group.GroupID] = group
+	return nil
+}
+
+// UpdateGroup replaces a group's name, currency and members, and its
+// expenses if given, as long as its version hasn't changed
+func (s *MemoryStore) UpdateGroup(ctx context.Context, group models.Group) (models.Group, error) {
+	return s.update(group.GroupID, func(g *models.Group) error {
+		if g.Version != group.Version {
+			return ErrConflict
+		}
+		g.Name = group.Name
+		g.Currency = group.Currency
+		g.Categories = group.Categories
+		g.Members = group.Members
+		if group.Expenses != nil {
+			s.expenses[g.GroupID] = withGroupID(clone(group.Expenses), g.GroupID)
+		}
+		return nil
+	})
+}
+
+// DeleteGroup removes a group
+func (s *MemoryStore) DeleteGroup(ctx context.Context, groupID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.groups[groupID]; !ok {
+		return ErrNotFound
+	}
+	s.deleteGroup(groupID)
+	return nil
+}
+
+// GroupExpenses returns every expense in a group, oldest first
+func (s *MemoryStore) GroupExpenses(ctx context.Context, groupID string) ([]models.Expense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.groups[groupID]; !ok {
+		return nil, ErrNotFound
+	}
+
+	expenses := clone(s.expenses[groupID])
+	if expenses == nil {
+		expenses = []models.Expense{}
+	}
+	slices.SortFunc(expenses, func(a, b models.Expense) int {
+		return compareExpenses(a, b, "date")
+	})
+	return expenses, nil
+}
+
+// GetExpense finds one expense in a group
+func (s *MemoryStore) GetExpense(ctx context.Context, groupID, expenseID string) (models.Expense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, e := range s.expenses[groupID] {
+		if e.ID == expenseID {
+			return clone(e), nil
+		}
+	}
+	return models.Expense{}, ErrNotFound
+}
+
+// ListExpenses returns one page of a group's expenses matching a query
+func (s *MemoryStore) ListExpenses(ctx context.Context, groupID string, query ExpenseQuery) (ExpensePage, error) {
+	order := query.sort()
+	cursor, err := decodeCursor(query.Cursor, order)
+	if err != nil {
+		return ExpensePage{}, err
+	}
+
+	all, err := s.GroupExpenses(ctx, groupID)
+	if err != nil {
+		return ExpensePage{}, err
+	}
+
+	expenses := []models.Expense{}
+	for _, e := range all {
+		if query.matches(e) && cursor.follows(e) {
+			expenses = append(expenses, e)
+		}
+	}
+	slices.SortFunc(expenses, func(a, b models.Expense) int {
+		if order.Descending() {
+			a, b = b, a
+		}
+		return compareExpenses(a, b, order.Field())
+	})
+
+	limit := query.pageLimit()
+	if len(expenses) > limit+1 {
+		expenses = expenses[:limit+1]
+	}
+	return page(expenses, limit, order), nil
+}
+
+// ExpenseTotals counts and sums the expenses of each of the given groups
+func (s *MemoryStore) ExpenseTotals(ctx context.Context, groupIDs []string) (map[string]ExpenseTotal, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	totals := make(map[string]ExpenseTotal)
+	for _, id := range groupIDs {
+		for _, e := range s.expenses[id] {
+			t := totals[id]
+			t.Count++
+			t.Total += e.AmountInBase()
+			totals[id] = t
+		}
+	}
+	return totals, nil
+}
+
+// AddExpense appends an expense to a group
+func (s *MemoryStore) AddExpense(ctx context.Context, groupID string, expense models.Expense) error {
+	_, err := s.update(groupID, func(g *models.Group) error {
+		for _, e := range s.expenses[g.GroupID] {
+			if e.ID == expense.ID {
+				return ErrDuplicate
+			}
+		}
+		expense = clone(expense)
+		expense.GroupID = g.GroupID
+		s.expenses[g.GroupID] = append(s.expenses[g.GroupID], expense)
+		return nil
+	})
+	return err
+}
+
+// UpdateExpense edits an expense in place, keeping its ID, date and
+// attachments
+func (s *MemoryStore) UpdateExpense(ctx context.Context, groupID string, expense models.Expense) (models.Expense, error) {
+	var updated models.Expense
+	_, err := s.update(groupID, func(g *models.Group) error {
+		expenses := s.expenses[g.GroupID]
+		for i := range expenses {
+			if expenses[i].ID == expense.ID {
+				expense = clone(expense)
+				expense.GroupID = g.GroupID
+				expense.Date = expenses[i].Date
+				expense.Attachments = expenses[i].Attachments
+				expenses[i] = expense
+				updated = expense
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	return clone(updated), err
+}
+
+// DeleteExpense removes an expense from a group
+func (s *MemoryStore) DeleteExpense(ctx context.Context, groupID, expenseID string) error {
+	_, err := s.update(groupID, func(g *models.Group) error {
+		var expenses []models.Expense
+		for _, e := range s.expenses[g.GroupID] {
+			if e.ID != expenseID {
+				expenses = append(expenses, e)
+			}
+		}
+		s.expenses[g.GroupID] = expenses
+		return nil
+	})
+	return err
+}
+
+// AddAttachment appends an attachment to an expense
+func (s *MemoryStore) AddAttachment(ctx context.Context, groupID, expenseID string, attachment models.Attachment) error {
+	_, err := s.update(groupID, func(g *models.Group) error {
+		expenses := s.expenses[g.GroupID]
+		for i := range expenses {
+			if expenses[i].ID == expenseID {
+				expenses[i].Attachments = append(expenses[i].Attachments, clone(attachment))
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	return err
+}
+
+// RemoveAttachment removes an attachment from an expense
+func (s *MemoryStore) RemoveAttachment(ctx context.Context, groupID, expenseID, attachmentID string) error {
+	_, err := s.update(groupID, func(g *models.Group) error {
+		expenses := s.expenses[g.GroupID]
+		for i := range expenses {
+			if expenses[i].ID != expenseID {
+				continue
+			}
+			for j, a := range expenses[i].Attachments {
+				if a.ID == attachmentID {
+					expenses[i].Attachments = slices.Delete(expenses[i].Attachments, j, j+1)
+					return nil
+				}
+			}
+		}
+		return ErrNotFound
+	})
+	return err
+}
+
+// AddPayment appends a payment to a group
+func (s *MemoryStore) AddPayment(ctx context.Context, groupID string, payment models.Payment) error {
+	_, err := s.update(groupID, func(g *models.Group) error {
+		for _, p := range g.Payments {
+			if p.ID == payment.ID {
+				return ErrDuplicate
+			}
+		}
+		g.Payments = append(g.Payments, payment)
+		return nil
+	})
+	return err
+}
+
+// DeletePayment removes a payment from a group
+func (s *MemoryStore) DeletePayment(ctx context.Context, groupID, paymentID string) error {
+	_, err := s.update(groupID, func(g *models.Group) error {
+		for i, p := range g.Payments {
+			if p.ID == paymentID {
+				g.Payments = slices.Delete(g.Payments, i, i+1)
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+	return err
+}
+
+// AddMember appends a member to a group. It returns ErrDuplicate if the
+// member's user is already linked to another member of the group.
+func (s *MemoryStore) AddMember(ctx context.Context, groupID string, member models.Member) (models.Group, error) {
+	return s.update(groupID, func(g *models.Group) error {
+		if member.UserID != "" && linkedTo(g.Members, member.UserID) {
+			return ErrDuplicate
+		}
+		g.Members = append(g.Members, member)
+		return nil
+	})
+}
+
+// LinkMember links a placeholder member to a user account. It returns
+// ErrConflict if the member doesn't exist or is already linked, and
+// ErrDuplicate if the user is already linked to another member of the group.
+func (s *MemoryStore) LinkMember(ctx context.Context, groupID, memberID, uid string, role models.Role) (models.Group, error) {
+	return s.update(groupID, func(g *models.Group) error {
+		if linkedTo(g.Members, uid) {
+			return ErrDuplicate
+		}
+		for i := range g.Members {
+			if g.Members[i].ID == memberID && g.Members[i].UserID == "" {
+				g.Members[i].UserID = uid
+				g.Members[i].Role = role
+				return nil
+			}
+		}
+		return ErrConflict
+	})
+}
+
+// linkedTo reports whether any of members is linked to the user
+func linkedTo(members []models.Member, uid string) bool {
+	for _, m := range members {
+		if m.UserID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// SetMemberRole changes a member's role
+func (s *MemoryStore) SetMemberRole(ctx context.Context, groupID, memberID string, role models.Role) (models.Group, error) {
+	return s.update(groupID, func(g *models.Group) error {
+		for i := range g.Members {
+			if g.Members[i].ID == memberID {
+				g.Members[i].Role = role
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+}
+
+// RemoveMember removes a member from a group
+func (s *MemoryStore) RemoveMember(ctx context.Context, groupID, memberID string) error {
+	_, err := s.update(groupID, func(g *models.Group) error {
+		members := g.Members[:0]
+		for _, m := range g.Members {
+			if m.ID != memberID {
+				members = append(members, m)
+			}
+		}
+		g.Members = members
+		return nil
+	})
+	return err
+}
+
+// CreateInvite inserts a new invite
+func (s *MemoryStore) CreateInvite(ctx context.Context, invite models.Invite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.invites[invite.Token]; ok {
+		return ErrDuplicate
+	}
+	invite = clone(invite)
+	s.invites[invite.Token] = invite
+	return nil
+}
+
+// GetInvite finds an invite by token
+func (s *MemoryStore) GetInvite(ctx context.Context, token string) (models.Invite, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	invite, ok := s.invites[token]
+	if !ok {
+		return models.Invite{}, ErrNotFound
+	}
+	return clone(invite), nil
+}
+
+// RedeemInvite uses up one redemption of a valid invite
+func (s *MemoryStore) RedeemInvite(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invite, ok := s.invites[token]
+	if !ok || invite.Uses >= invite.MaxUses || !time.Now().Before(invite.ExpiresAt) {
+		return ErrInviteUnavailable
+	}
+
+	invite.Uses++
+	s.invites[invite.Token] = invite
+	return nil
+}
+
+// ReleaseInvite gives back a redemption
+func (s *MemoryStore) ReleaseInvite(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if invite, ok := s.invites[token]; ok {
+		invite.Uses--
+		s.invites[invite.Token] = invite
+	}
+	return nil
+}
+
+// ListRecurring returns a group's recurring expenses, oldest first
+func (s *MemoryStore) ListRecurring(ctx context.Context, groupID string) ([]models.RecurringExpense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.groups[groupID]; !ok {
+		return nil, ErrNotFound
+	}
+	recurring := clone(s.recurring[groupID])
+	if recurring == nil {
+		recurring = []models.RecurringExpense{}
+	}
+	return recurring, nil
+}
+
+// GetRecurring finds one recurring expense in a group
+func (s *MemoryStore) GetRecurring(ctx context.Context, groupID, id string) (models.RecurringExpense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, r := range s.recurring[groupID] {
+		if r.ID == id {
+			return clone(r), nil
+		}
+	}
+	return models.RecurringExpense{}, ErrNotFound
+}
+
+// CreateRecurring adds a recurring expense to its group
+func (s *MemoryStore) CreateRecurring(ctx context.Context, recurring models.RecurringExpense) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.groups[recurring.GroupID]
+	if !ok {
+		return ErrNotFound
+	}
+	for _, r := range s.recurring[stored.GroupID] {
+		if r.ID == recurring.ID {
+			return ErrDuplicate
+		}
+	}
+	s.recurring[stored.GroupID] = append(s.recurring[stored.GroupID], clone(recurring))
+	return nil
+}
+
+// UpdateRecurring replaces the template and schedule of a recurring expense
+func (s *MemoryStore) UpdateRecurring(ctx context.Context, recurring models.RecurringExpense) (models.RecurringExpense, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := s.recurring[recurring.GroupID]
+	for i := range list {
+		if list[i].ID == recurring.ID {
+			recurring = clone(recurring)
+			recurring.GroupID = list[i].GroupID
+			recurring.CreatedBy = list[i].CreatedBy
+			recurring.CreatedAt = list[i].CreatedAt
+			list[i] = recurring
+			return clone(recurring), nil
+		}
+	}
+	return models.RecurringExpense{}, ErrNotFound
+}
+
+// DeleteRecurring removes a recurring expense
+func (s *MemoryStore) DeleteRecurring(ctx context.Context, groupID, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := s.recurring[groupID]
+	for i := range list {
+		if list[i].ID == id {
+			s.recurring[groupID] = slices.Delete(list, i, i+1)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// DueRecurring returns recurring expenses whose next run is due
+func (s *MemoryStore) DueRecurring(ctx context.Context, now time.Time, limit int) ([]models.RecurringExpense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	due := []models.RecurringExpense{}
+	for _, list := range s.recurring {
+		for _, r := range list {
+			if r.NextRun != nil && !r.NextRun.After(now) {
+				due = append(due, r)
+			}
+		}
+	}
+	slices.SortFunc(due, func(a, b models.RecurringExpense) int {
+		return a.NextRun.Compare(*b.NextRun)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return clone(due), nil
+}
+
+// AdvanceRecurring moves a recurring expense on from a due run
+func (s *MemoryStore) AdvanceRecurring(ctx context.Context, groupID, id string, due time.Time, next *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list := s.recurring[groupID]
+	for i := range list {
+		if list[i].ID == id {
+			if list[i].NextRun == nil || !list[i].NextRun.Equal(due) {
+				return ErrConflict
+			}
+			list[i].NextRun = clone(next)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// AddActivity appends an entry to its group's log
+func (s *MemoryStore) AddActivity(ctx context.Context, activity models.Activity) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.groups[activity.GroupID]
+	if !ok {
+		return ErrNotFound
+	}
+	s.activity[stored.GroupID] = append(s.activity[stored.GroupID], clone(activity))
+	return nil
+}
+
+// ListActivity returns a page of a group's log, newest first
+func (s *MemoryStore) ListActivity(ctx context.Context, groupID string, query ActivityQuery) (ActivityPage, error) {
+	cursor, err := decodeActivityCursor(query.Cursor)
+	if err != nil {
+		return ActivityPage{}, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.groups[groupID]; !ok {
+		return ActivityPage{}, ErrNotFound
+	}
+
+	activity := []models.Activity{}
+	for _, a := range s.activity[groupID] {
+		if cursor.follows(a) {
+			activity = append(activity, clone(a))
+		}
+	}
+
+	sort.Slice(activity, func(i, j int) bool {
+		a, b := activity[i], activity[j]
+		return a.CreatedAt.After(b.CreatedAt) || (a.CreatedAt.Equal(b.CreatedAt) && a.ID > b.ID)
+	})
+	limit := query.pageLimit()
+	if len(activity) > limit+1 {
+		activity = activity[:limit+1]
+	}
+	return activityPage(activity, limit), nil
+}
+
+// TrashExpense moves an expense into its group's trash
+func (s *MemoryStore) TrashExpense(ctx context.Context, groupID, expenseID, deletedBy string, at time.Time) (models.TrashedExpense, error) {
+	var trashed models.TrashedExpense
+	_, err := s.update(groupID, func(g *models.Group) error {
+		expenses := s.expenses[g.GroupID]
+		i := slices.IndexFunc(expenses, func(e models.Expense) bool { return e.ID == expenseID })
+		if i < 0 {
+			return ErrNotFound
+		}
+
+		trashed = models.TrashedExpense{GroupID: g.GroupID, Expense: expenses[i], DeletedBy: deletedBy, DeletedAt: at}
+		trash := slices.DeleteFunc(s.trash[g.GroupID], func(t models.TrashedExpense) bool {
+			return t.Expense.ID == expenseID
+		})
+		s.trash[g.GroupID] = append(trash, clone(trashed))
+		s.expenses[g.GroupID] = slices.Delete(expenses, i, i+1)
+		return nil
+	})
+	return clone(trashed), err
+}
+
+// ListTrashedExpenses returns a group's trashed expenses, most recently
+// deleted first
+func (s *MemoryStore) ListTrashedExpenses(ctx context.Context, groupID string) ([]models.TrashedExpense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, ok := s.groups[groupID]; !ok {
+		return nil, ErrNotFound
+	}
+
+	trash := clone(s.trash[groupID])
+	if trash == nil {
+		trash = []models.TrashedExpense{}
+	}
+	slices.SortStableFunc(trash, func(a, b models.TrashedExpense) int {
+		return b.DeletedAt.Compare(a.DeletedAt)
+	})
+	return trash, nil
+}
+
+// RestoreExpense moves an expense out of the trash and back into its group
+func (s *MemoryStore) RestoreExpense(ctx context.Context, groupID, expenseID string) (models.Expense, error) {
+	var restored models.Expense
+	_, err := s.update(groupID, func(g *models.Group) error {
+		trash := s.trash[g.GroupID]
+		i := slices.IndexFunc(trash, func(t models.TrashedExpense) bool { return t.Expense.ID == expenseID })
+		if i < 0 {
+			return ErrNotFound
+		}
+		for _, e := range s.expenses[g.GroupID] {
+			if e.ID == expenseID {
+				return ErrDuplicate
+			}
+		}
+
+		restored = trash[i].Expense
+		s.expenses[g.GroupID] = append(s.expenses[g.GroupID], restored)
+		s.trash[g.GroupID] = slices.Delete(trash, i, i+1)
+		return nil
+	})
+	return clone(restored), err
+}
+
+// ExpiredExpenses returns trashed expenses deleted before the given time
+func (s *MemoryStore) ExpiredExpenses(ctx context.Context, before time.Time, limit int) ([]models.TrashedExpense, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expired := []models.TrashedExpense{}
+	for _, trash := range s.trash {
+		for _, t := range trash {
+			if t.DeletedAt.Before(before) {
+				expired = append(expired, t)
+			}
+		}
+	}
+	slices.SortFunc(expired, func(a, b models.TrashedExpense) int {
+		return a.DeletedAt.Compare(b.DeletedAt)
+	})
+	if len(expired) > limit {
+		expired = expired[:limit]
+	}
+	return clone(expired), nil
+}
+
+// PurgeExpense permanently deletes a trashed expense that was deleted
+// before the given time
+func (s *MemoryStore) PurgeExpense(ctx context.Context, groupID, expenseID string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trash := s.trash[groupID]
+	i := slices.IndexFunc(trash, func(t models.TrashedExpense) bool {
+		return t.Expense.ID == expenseID && t.DeletedAt.Before(before)
+	})
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.trash[groupID] = slices.Delete(trash, i, i+1)
+	return nil
+}
+
+// TrashGroup moves a group into the trash
+func (s *MemoryStore) TrashGroup(ctx context.Context, groupID, deletedBy string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[groupID]
+	if !ok || group.DeletedAt != nil {
+		return ErrNotFound
+	}
+	group.DeletedAt = &at
+	group.DeletedBy = deletedBy
+	s.groups[group.GroupID] = clone(group)
+	return nil
+}
+
+// ListTrashedGroups returns the groups in the trash that a user owns, most
+// recently deleted first
+func (s *MemoryStore) ListTrashedGroups(ctx context.Context, uid string) ([]models.Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	groups := []models.Group{}
+	for _, g := range s.groups {
+		if g.DeletedAt != nil && g.UserID == uid {
+			groups = append(groups, clone(g))
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i], groups[j]
+		return a.DeletedAt.After(*b.DeletedAt) || (a.DeletedAt.Equal(*b.DeletedAt) && a.GroupID < b.GroupID)
+	})
+	return groups, nil
+}
+
+// GetTrashedGroup finds a group in the trash by ID
+func (s *MemoryStore) GetTrashedGroup(ctx context.Context, groupID string) (models.Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	group, ok := s.groups[groupID]
+	if !ok || group.DeletedAt == nil {
+		return models.Group{}, ErrNotFound
+	}
+	return clone(group), nil
+}
+
+// RestoreGroup moves a group out of the trash
+func (s *MemoryStore) RestoreGroup(ctx context.Context, groupID string) (models.Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[groupID]
+	if !ok || group.DeletedAt == nil {
+		return models.Group{}, ErrNotFound
+	}
+	group.DeletedAt = nil
+	group.DeletedBy = ""
+	s.groups[group.GroupID] = group
+	return clone(group), nil
+}
+
+// ExpiredGroups returns groups in the trash deleted before the given time
+func (s *MemoryStore) ExpiredGroups(ctx context.Context, before time.Time, limit int) ([]models.Group, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	expired := []models.Group{}
+	for _, g := range s.groups {
+		if g.DeletedAt != nil && g.DeletedAt.Before(before) {
+			expired = append(expired, clone(g))
+		}
+	}
+	sort.Slice(expired, func(i, j int) bool {
+		a, b := expired[i], expired[j]
+		return a.DeletedAt.Before(*b.DeletedAt) || (a.DeletedAt.Equal(*b.DeletedAt) && a.GroupID < b.GroupID)
+	})
+	if len(expired) > limit {
+		expired = expired[:limit]
+	}
+	return expired, nil
+}
+
+// PurgeGroup permanently deletes a group in the trash that was deleted
+// before the given time
+func (s *MemoryStore) PurgeGroup(ctx context.Context, groupID string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	group, ok := s.groups[groupID]
+	if !ok || group.DeletedAt == nil || !group.DeletedAt.Before(before) {
+		return ErrNotFound
+	}
+	s.deleteGroup(groupID)
+	return nil
+}
+
+// deleteGroup removes a group and everything in it. The caller must hold
+// the write lock.
+func (s *MemoryStore) deleteGroup(groupID string) {
+	delete(s.groups, groupID)
+	delete(s.expenses, groupID)
+	delete(s.recurring, groupID)
+	delete(s.activity, groupID)
+	delete(s.trash, groupID)
+}
+
+// update applies fn to a copy of the group under the write lock and saves
+// it, bumping the version and timestamp, unless fn returns an error
+func (s *MemoryStore) update(groupID string, fn func(*models.Group) error) (models.Group, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.groups[groupID]
+	if !ok {
+		return models.Group{}, ErrNotFound
+	}
+
+	group := clone(stored)
+	if err := fn(&group); err != nil {
+		return models.Group{}, err
+	}
+
+	group.Version++
+	group.UpdatedAt = time.Now()
+	s.groups[stored.GroupID] = clone(group)
+	return group, nil
+}
+
+// withGroupID links expenses to their group
+func withGroupID(expenses []models.Expense, groupID string) []models.Expense {
+	for i := range expenses {
+		expenses[i].GroupID = groupID
+	}
+	return expenses
+}
+
+// clone deep-copies a record by round-tripping it through BSON, so callers
+// never share slices with the store and values look exactly as they would
+// coming out of MongoDB
+func clone[T any](v T) T {
+	// Wrapped so slices can be cloned too; BSON documents must be structs
+	// or maps at the top level
+	type wrapper struct{ V T }
+
+	var out wrapper
+	data, err := bson.Marshal(wrapper{V: v})
+	if err != nil {
+		panic(err)
+	}
+	if err := bson.Unmarshal(data, &out); err != nil {
+		panic(err)
+	}
+	return out.V
+}
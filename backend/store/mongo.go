@@ -0,0 +1,1073 @@
+package store
+
+import (
+	"context"
+	"regexp"
+	"split-it/backend/models"
+	"split-it/backend/money"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore implements Store on top of MongoDB
+type MongoStore struct {
+	db *mongo.Database
+}
+
+// NewMongoStore creates a store backed by the given database
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{db: db}
+}
+
+func (s *MongoStore) users() *mongo.Collection {
+	return s.db.Collection("users")
+}
+
+func (s *MongoStore) groups() *mongo.Collection {
+	return s.db.Collection("groups")
+}
+
+func (s *MongoStore) expenses() *mongo.Collection {
+	return s.db.Collection("expenses")
+}
+
+func (s *MongoStore) invites() *mongo.Collection {
+	return s.db.Collection("invites")
+}
+
+func (s *MongoStore) recurring() *mongo.Collection {
+	return s.db.Collection("recurring_expenses")
+}
+
+func (s *MongoStore) activity() *mongo.Collection {
+	return s.db.Collection("activity")
+}
+
+func (s *MongoStore) trash() *mongo.Collection {
+	return s.db.Collection("trashed_expenses")
+}
+
+// GetUser finds a user by Firebase UID
+func (s *MongoStore) GetUser(ctx context.Context, firebaseUID string) (models.User, error) {
+	var user models.User
+	err := s.users().FindOne(ctx, bson.M{"firebaseUid": firebaseUID}).Decode(&user)
+	return user, mongoErr(err)
+}
+
+// CreateUser inserts a new user
+func (s *MongoStore) CreateUser(ctx context.Context, user models.User) error {
+	_, err := s.users().InsertOne(ctx, user)
+	return mongoErr(err)
+}
+
+// UpdateUser changes a user's name and phone number
+func (s *MongoStore) UpdateUser(ctx context.Context, firebaseUID, name, phone string) (models.User, error) {
+	update := bson.M{
+		"$set": bson.M{
+			"name":      name,
+			"phone":     phone,
+			"updatedAt": time.Now(),
+		},
+	}
+
+	var user models.User
+	err := s.users().FindOneAndUpdate(
+		ctx,
+		bson.M{"firebaseUid": firebaseUID},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&user)
+	return user, mongoErr(err)
+}
+
+// ListGroups returns a page of the groups a user owns or is a linked
+// member of
+func (s *MongoStore) ListGroups(ctx context.Context, uid string, query GroupQuery) (GroupPage, error) {
+	cursor, err := decodeGroupCursor(query.Cursor)
+	if err != nil {
+		return GroupPage{}, err
+	}
+
+	and := bson.A{bson.M{"deletedAt": nil}, bson.M{"$or": bson.A{
+		bson.M{"userId": uid},
+		bson.M{"members.userId": uid},
+	}}}
+	if cursor != nil {
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"createdAt": bson.M{"$lt": cursor.CreatedAt}},
+			bson.M{"createdAt": cursor.CreatedAt, "id": bson.M{"$lt": cursor.ID}},
+		}})
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "id", Value: -1}})
+	if query.Limit > 0 {
+		opts.SetLimit(int64(query.Limit + 1))
+	}
+	found, err := s.groups().Find(ctx, bson.M{"$and": and}, opts)
+	if err != nil {
+		return GroupPage{}, err
+	}
+	defer found.Close(ctx)
+
+	groups := []models.Group{}
+	if err = found.All(ctx, &groups); err != nil {
+		return GroupPage{}, err
+	}
+	return groupPage(groups, query.Limit), nil
+}
+
+// GetGroup finds a group by ID
+func (s *MongoStore) GetGroup(ctx context.Context, groupID string) (models.Group, error) {
+	var group models.Group
+	err := s.groups().FindOne(ctx, bson.M{"id": groupID, "deletedAt": nil}).Decode(&group)
+	return group, mongoErr(err)
+}
+
+// CreateGroup inserts a new group, followed by its expenses. The unique
+// index on the group ID rejects a taken one.
+func (s *MongoStore) CreateGroup(ctx context.Context, group models.Group) error {
+	expenses := group.Expenses
+	group.Expenses = nil
+
+	if _, err := s.groups().InsertOne(ctx, group); err != nil {
+		return mongoErr(err)
+	}
+	return s.insertExpenses(ctx, group.GroupID, expenses)
+}
+
+// UpdateGroup replaces a group's name, currency, categories and members if
+// its version hasn't changed. When expenses are given they replace the
+// stored ones; that happens after the version check, so a concurrent edit
+// can't be lost, but it isn't atomic with the group update. See
+// replaceExpenses for what a failure part of the way leaves behind.
+func (s *MongoStore) UpdateGroup(ctx context.Context, group models.Group) (models.Group, error) {
+	set := bson.M{
+		"name":      group.Name,
+		"currency":  group.Currency,
+		"members":   group.Members,
+		"updatedAt": time.Now(),
+	}
+	update := bson.M{
+		"$set": set,
+		"$inc": bson.M{"version": 1},
+	}
+	if len(group.Categories) > 0 {
+		set["categories"] = group.Categories
+	} else {
+		update["$unset"] = bson.M{"categories": ""}
+	}
+
+	var updated models.Group
+	err := s.groups().FindOneAndUpdate(
+		ctx,
+		bson.M{"id": group.GroupID, "version": versionFilter(group.Version)},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+
+	if err == mongo.ErrNoDocuments {
+		// Tell a stale version apart from a missing group
+		count, countErr := s.groups().CountDocuments(ctx, bson.M{"id": group.GroupID})
+		if countErr != nil {
+			return updated, countErr
+		}
+		if count > 0 {
+			return updated, ErrConflict
+		}
+		return updated, ErrNotFound
+	} else if err != nil {
+		return updated, err
+	}
+
+	if group.Expenses != nil {
+		if err := s.replaceExpenses(ctx, group.GroupID, group.Expenses); err != nil {
+			return updated, err
+		}
+	}
+	return updated, nil
+}
+
+// DeleteGroup removes a group, its expenses, its recurring expenses, its
+// activity log and its trash
+func (s *MongoStore) DeleteGroup(ctx context.Context, groupID string) error {
+	return s.deleteGroup(ctx, bson.M{"id": groupID})
+}
+
+// GroupExpenses returns every expense in a group, oldest first
+func (s *MongoStore) GroupExpenses(ctx context.Context, groupID string) ([]models.Expense, error) {
+	if err := s.groupExists(ctx, groupID); err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "date", Value: 1}, {Key: "id", Value: 1}})
+	return s.findExpenses(ctx, bson.M{"groupId": groupID}, opts)
+}
+
+// GetExpense finds one expense in a group
+func (s *MongoStore) GetExpense(ctx context.Context, groupID, expenseID string) (models.Expense, error) {
+	var expense models.Expense
+	err := s.expenses().FindOne(ctx, bson.M{"groupId": groupID, "id": expenseID}).Decode(&expense)
+	return expense, mongoErr(err)
+}
+
+// ListExpenses returns one page of a group's expenses matching a query
+func (s *MongoStore) ListExpenses(ctx context.Context, groupID string, query ExpenseQuery) (ExpensePage, error) {
+	order := query.sort()
+	cursor, err := decodeCursor(query.Cursor, order)
+	if err != nil {
+		return ExpensePage{}, err
+	}
+	if err := s.groupExists(ctx, groupID); err != nil {
+		return ExpensePage{}, err
+	}
+
+	// Each condition is a separate clause so that several $or filters
+	// can be combined
+	and := bson.A{bson.M{"groupId": groupID}}
+	if !query.From.IsZero() {
+		and = append(and, bson.M{"date": bson.M{"$gte": query.From}})
+	}
+	if !query.To.IsZero() {
+		and = append(and, bson.M{"date": bson.M{"$lt": query.To}})
+	}
+	if query.PaidBy != "" {
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"paidBy": query.PaidBy},
+			bson.M{"payers.memberId": query.PaidBy},
+		}})
+	}
+	if query.Participant != "" {
+		and = append(and, bson.M{"participants": query.Participant})
+	}
+	if query.MinAmount != nil {
+		and = append(and, bson.M{"amountInBase": bson.M{"$gte": *query.MinAmount}})
+	}
+	if query.MaxAmount != nil {
+		and = append(and, bson.M{"amountInBase": bson.M{"$lte": *query.MaxAmount}})
+	}
+	if query.Search != "" {
+		and = append(and, bson.M{"description": primitive.Regex{
+			Pattern: regexp.QuoteMeta(query.Search),
+			Options: "i",
+		}})
+	}
+	if query.Category != "" {
+		and = append(and, bson.M{"category": query.Category})
+	}
+	if query.Tag != "" {
+		and = append(and, bson.M{"tags": query.Tag})
+	}
+
+	field, dir, op := order.Field(), 1, "$gt"
+	if field == "amount" {
+		field = "amountInBase"
+	}
+	if order.Descending() {
+		dir, op = -1, "$lt"
+	}
+	if cursor != nil {
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{field: bson.M{op: cursor.key()}},
+			bson.M{field: cursor.key(), "id": bson.M{op: cursor.ID}},
+		}})
+	}
+
+	// Amounts are compared in the base currency, which is worked out for
+	// each expense before the filters run
+	limit := query.pageLimit()
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"groupId": groupID}}},
+		{{Key: "$addFields", Value: bson.M{"amountInBase": amountInBaseExpr}}},
+		{{Key: "$match", Value: bson.M{"$and": and}}},
+		{{Key: "$sort", Value: bson.D{{Key: field, Value: dir}, {Key: "id", Value: dir}}}},
+		{{Key: "$limit", Value: limit + 1}},
+		{{Key: "$project", Value: bson.M{"amountInBase": 0}}},
+	}
+
+	expenses, err := s.aggregateExpenses(ctx, pipeline)
+	if err != nil {
+		return ExpensePage{}, err
+	}
+	return page(expenses, limit, order), nil
+}
+
+// amountInBaseExpr works out an expense's amount in the group's base
+// currency, like models.Expense.AmountInBase. Expenses without a currency
+// are already in the base currency.
+var amountInBaseExpr = bson.M{"$cond": bson.A{
+	bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$currency", ""}}, ""}},
+	"$amount",
+	"$baseAmount",
+}}
+
+// ExpenseTotals counts and sums the expenses of each of the given groups
+func (s *MongoStore) ExpenseTotals(ctx context.Context, groupIDs []string) (map[string]ExpenseTotal, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"groupId": bson.M{"$in": groupIDs}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":   "$groupId",
+			"count": bson.M{"$sum": 1},
+			"total": bson.M{"$sum": amountInBaseExpr},
+		}}},
+	}
+
+	cursor, err := s.expenses().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []struct {
+		GroupID string       `bson:"_id"`
+		Count   int64        `bson:"count"`
+		Total   money.Amount `bson:"total"`
+	}
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]ExpenseTotal, len(results))
+	for _, r := range results {
+		totals[r.GroupID] = ExpenseTotal{Count: r.Count, Total: r.Total}
+	}
+	return totals, nil
+}
+
+// AddExpense adds an expense to a group. The group is only bumped once the
+// expense is in, so one with a taken ID leaves the version alone.
+func (s *MongoStore) AddExpense(ctx context.Context, groupID string, expense models.Expense) error {
+	if err := s.groupExists(ctx, groupID); err != nil {
+		return err
+	}
+
+	expense.GroupID = groupID
+	if _, err := s.expenses().InsertOne(ctx, expense); err != nil {
+		return mongoErr(err)
+	}
+	return s.updateOne(ctx, bson.M{"id": groupID}, bson.M{})
+}
+
+// UpdateExpense edits an expense, keeping its ID and date
+func (s *MongoStore) UpdateExpense(ctx context.Context, groupID string, expense models.Expense) (models.Expense, error) {
+	set := bson.M{
+		"description":  expense.Description,
+		"amount":       expense.Amount,
+		"paidBy":       expense.PaidBy,
+		"participants": expense.Participants,
+	}
+	unset := bson.M{}
+
+	if len(expense.Payers) > 0 {
+		set["payers"] = expense.Payers
+	} else {
+		unset["payers"] = ""
+	}
+	if expense.Split != nil {
+		set["split"] = expense.Split
+	} else {
+		unset["split"] = ""
+	}
+	if expense.Currency != "" {
+		set["currency"] = expense.Currency
+		set["exchangeRate"] = expense.ExchangeRate
+		set["baseAmount"] = expense.BaseAmount
+	} else {
+		unset["currency"] = ""
+		unset["exchangeRate"] = ""
+		unset["baseAmount"] = ""
+	}
+	if expense.Category != "" {
+		set["category"] = expense.Category
+	} else {
+		unset["category"] = ""
+	}
+	if len(expense.Tags) > 0 {
+		set["tags"] = expense.Tags
+	} else {
+		unset["tags"] = ""
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var updated models.Expense
+	err := s.expenses().FindOneAndUpdate(
+		ctx,
+		bson.M{"groupId": groupID, "id": expense.ID},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return models.Expense{}, mongoErr(err)
+	}
+
+	return updated, s.updateOne(ctx, bson.M{"id": groupID}, bson.M{})
+}
+
+// DeleteExpense removes an expense from a group
+func (s *MongoStore) DeleteExpense(ctx context.Context, groupID, expenseID string) error {
+	if _, err := s.expenses().DeleteOne(ctx, bson.M{"groupId": groupID, "id": expenseID}); err != nil {
+		return err
+	}
+	return s.updateOne(ctx, bson.M{"id": groupID}, bson.M{})
+}
+
+// AddAttachment appends an attachment to an expense
+func (s *MongoStore) AddAttachment(ctx context.Context, groupID, expenseID string, attachment models.Attachment) error {
+	result, err := s.expenses().UpdateOne(ctx,
+		bson.M{"groupId": groupID, "id": expenseID},
+		bson.M{"$push": bson.M{"attachments": attachment}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return s.updateOne(ctx, bson.M{"id": groupID}, bson.M{})
+}
+
+// RemoveAttachment removes an attachment from an expense
+func (s *MongoStore) RemoveAttachment(ctx context.Context, groupID, expenseID, attachmentID string) error {
+	result, err := s.expenses().UpdateOne(ctx,
+		bson.M{"groupId": groupID, "id": expenseID, "attachments.id": attachmentID},
+		bson.M{"$pull": bson.M{"attachments": bson.M{"id": attachmentID}}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return s.updateOne(ctx, bson.M{"id": groupID}, bson.M{})
+}
+
+// AddPayment appends a payment to a group. Payments are embedded in the
+// group, so the filter is what keeps their IDs unique.
+func (s *MongoStore) AddPayment(ctx context.Context, groupID string, payment models.Payment) error {
+	err := s.updateOne(ctx, bson.M{"id": groupID, "payments.id": bson.M{"$ne": payment.ID}}, bson.M{
+		"$push": bson.M{"payments": payment},
+	})
+	if err == ErrNotFound {
+		// Tell a taken ID apart from a missing group
+		if err := s.groupExists(ctx, groupID); err != nil {
+			return err
+		}
+		return ErrDuplicate
+	}
+	return err
+}
+
+// DeletePayment removes a payment from a group. Only a group holding the
+// payment matches, so deleting a missing payment leaves the version alone.
+func (s *MongoStore) DeletePayment(ctx context.Context, groupID, paymentID string) error {
+	return s.updateOne(ctx, bson.M{"id": groupID, "payments.id": paymentID}, bson.M{
+		"$pull": bson.M{"payments": bson.M{"id": paymentID}},
+	})
+}
+
+// AddMember appends a member to a group. It returns ErrDuplicate if the
+// member's user is already linked to another member of the group.
+func (s *MongoStore) AddMember(ctx context.Context, groupID string, member models.Member) (models.Group, error) {
+	filter := bson.M{"id": groupID}
+	if member.UserID != "" {
+		filter["members.userId"] = bson.M{"$ne": member.UserID}
+	}
+
+	group, err := s.findOneAndUpdate(ctx, filter, bson.M{
+		"$push": bson.M{"members": member},
+	})
+	if err == ErrNotFound && member.UserID != "" {
+		return group, s.linkedMiss(ctx, groupID, member.UserID, ErrNotFound)
+	}
+	return group, err
+}
+
+// LinkMember links a placeholder member to a user account. It returns
+// ErrConflict if the member doesn't exist or is already linked, and
+// ErrDuplicate if the user is already linked to another member of the group.
+func (s *MongoStore) LinkMember(ctx context.Context, groupID, memberID, uid string, role models.Role) (models.Group, error) {
+	filter := bson.M{
+		"id": groupID,
+		"members": bson.M{"$elemMatch": bson.M{
+			"id":     memberID,
+			"userId": bson.M{"$in": bson.A{nil, ""}},
+		}},
+		"members.userId": bson.M{"$ne": uid},
+	}
+
+	group, err := s.findOneAndUpdate(ctx, filter, bson.M{
+		"$set": bson.M{"members.$.userId": uid, "members.$.role": role},
+	})
+	if err == ErrNotFound {
+		return group, s.linkedMiss(ctx, groupID, uid, ErrConflict)
+	}
+	return group, err
+}
+
+// linkedMiss explains why an update guarded against linking a user twice
+// matched nothing: ErrDuplicate if the user is already linked to a member of
+// the group, ErrNotFound if the group is gone, and miss otherwise.
+func (s *MongoStore) linkedMiss(ctx context.Context, groupID, uid string, miss error) error {
+	err := s.groups().FindOne(ctx, bson.M{"id": groupID, "members.userId": uid}).Err()
+	if err == nil {
+		return ErrDuplicate
+	}
+	if err != mongo.ErrNoDocuments {
+		return err
+	}
+
+	err = s.groups().FindOne(ctx, bson.M{"id": groupID}).Err()
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return miss
+}
+
+// SetMemberRole changes a member's role
+func (s *MongoStore) SetMemberRole(ctx context.Context, groupID, memberID string, role models.Role) (models.Group, error) {
+	return s.findOneAndUpdate(ctx, bson.M{"id": groupID, "members.id": memberID}, bson.M{
+		"$set": bson.M{"members.$.role": role},
+	})
+}
+
+// RemoveMember removes a member from a group
+func (s *MongoStore) RemoveMember(ctx context.Context, groupID, memberID string) error {
+	return s.updateOne(ctx, bson.M{"id": groupID}, bson.M{
+		"$pull": bson.M{"members": bson.M{"id": memberID}},
+	})
+}
+
+// CreateInvite inserts a new invite
+func (s *MongoStore) CreateInvite(ctx context.Context, invite models.Invite) error {
+	_, err := s.invites().InsertOne(ctx, invite)
+	return mongoErr(err)
+}
+
+// GetInvite finds an invite by token
+func (s *MongoStore) GetInvite(ctx context.Context, token string) (models.Invite, error) {
+	var invite models.Invite
+	err := s.invites().FindOne(ctx, bson.M{"token": token}).Decode(&invite)
+	return invite, mongoErr(err)
+}
+
+// RedeemInvite uses up one redemption. The filter guards against concurrent
+// redemptions exceeding the limit or racing the expiry.
+func (s *MongoStore) RedeemInvite(ctx context.Context, token string) error {
+	result, err := s.invites().UpdateOne(ctx, bson.M{
+		"token":     token,
+		"expiresAt": bson.M{"$gt": time.Now()},
+		"$expr":     bson.M{"$lt": bson.A{"$uses", "$maxUses"}},
+	}, bson.M{"$inc": bson.M{"uses": 1}})
+	if err != nil {
+		return err
+	}
+	if result.ModifiedCount == 0 {
+		return ErrInviteUnavailable
+	}
+	return nil
+}
+
+// ReleaseInvite gives back a redemption
+func (s *MongoStore) ReleaseInvite(ctx context.Context, token string) error {
+	_, err := s.invites().UpdateOne(ctx, bson.M{"token": token}, bson.M{"$inc": bson.M{"uses": -1}})
+	return err
+}
+
+// ListRecurring returns a group's recurring expenses, oldest first
+func (s *MongoStore) ListRecurring(ctx context.Context, groupID string) ([]models.RecurringExpense, error) {
+	if err := s.groupExists(ctx, groupID); err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "createdAt", Value: 1}, {Key: "id", Value: 1}})
+	return s.findRecurring(ctx, bson.M{"groupId": groupID}, opts)
+}
+
+// GetRecurring finds one recurring expense in a group
+func (s *MongoStore) GetRecurring(ctx context.Context, groupID, id string) (models.RecurringExpense, error) {
+	var recurring models.RecurringExpense
+	err := s.recurring().FindOne(ctx, bson.M{"groupId": groupID, "id": id}).Decode(&recurring)
+	return recurring, mongoErr(err)
+}
+
+// CreateRecurring adds a recurring expense to its group
+func (s *MongoStore) CreateRecurring(ctx context.Context, recurring models.RecurringExpense) error {
+	if err := s.groupExists(ctx, recurring.GroupID); err != nil {
+		return err
+	}
+
+	_, err := s.recurring().InsertOne(ctx, recurring)
+	return mongoErr(err)
+}
+
+// UpdateRecurring replaces the template and schedule of a recurring expense
+func (s *MongoStore) UpdateRecurring(ctx context.Context, recurring models.RecurringExpense) (models.RecurringExpense, error) {
+	set := bson.M{
+		"template":  recurring.Template,
+		"frequency": recurring.Frequency,
+		"interval":  recurring.Interval,
+		"startDate": recurring.StartDate,
+	}
+	unset := bson.M{}
+	if recurring.EndDate != nil {
+		set["endDate"] = recurring.EndDate
+	} else {
+		unset["endDate"] = ""
+	}
+	if recurring.NextRun != nil {
+		set["nextRun"] = recurring.NextRun
+	} else {
+		unset["nextRun"] = ""
+	}
+
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	var updated models.RecurringExpense
+	err := s.recurring().FindOneAndUpdate(
+		ctx,
+		bson.M{"groupId": recurring.GroupID, "id": recurring.ID},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	return updated, mongoErr(err)
+}
+
+// DeleteRecurring removes a recurring expense
+func (s *MongoStore) DeleteRecurring(ctx context.Context, groupID, id string) error {
+	result, err := s.recurring().DeleteOne(ctx, bson.M{"groupId": groupID, "id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DueRecurring returns recurring expenses whose next run is due
+func (s *MongoStore) DueRecurring(ctx context.Context, now time.Time, limit int) ([]models.RecurringExpense, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "nextRun", Value: 1}}).
+		SetLimit(int64(limit))
+	return s.findRecurring(ctx, bson.M{"nextRun": bson.M{"$lte": now}}, opts)
+}
+
+// AdvanceRecurring moves a recurring expense on from a due run. Matching on
+// the due run makes it a compare-and-swap.
+func (s *MongoStore) AdvanceRecurring(ctx context.Context, groupID, id string, due time.Time, next *time.Time) error {
+	update := bson.M{"$unset": bson.M{"nextRun": ""}}
+	if next != nil {
+		update = bson.M{"$set": bson.M{"nextRun": next}}
+	}
+
+	result, err := s.recurring().UpdateOne(ctx, bson.M{"groupId": groupID, "id": id, "nextRun": due}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	if _, err := s.GetRecurring(ctx, groupID, id); err != nil {
+		return err
+	}
+	return ErrConflict
+}
+
+// AddActivity appends an entry to its group's log
+func (s *MongoStore) AddActivity(ctx context.Context, activity models.Activity) error {
+	if err := s.groupExists(ctx, activity.GroupID); err != nil {
+		return err
+	}
+
+	_, err := s.activity().InsertOne(ctx, activity)
+	return mongoErr(err)
+}
+
+// ListActivity returns a page of a group's log, newest first
+func (s *MongoStore) ListActivity(ctx context.Context, groupID string, query ActivityQuery) (ActivityPage, error) {
+	cursor, err := decodeActivityCursor(query.Cursor)
+	if err != nil {
+		return ActivityPage{}, err
+	}
+	if err := s.groupExists(ctx, groupID); err != nil {
+		return ActivityPage{}, err
+	}
+
+	filter := bson.M{"groupId": groupID}
+	if cursor != nil {
+		filter["$or"] = bson.A{
+			bson.M{"createdAt": bson.M{"$lt": cursor.CreatedAt}},
+			bson.M{"createdAt": cursor.CreatedAt, "id": bson.M{"$lt": cursor.ID}},
+		}
+	}
+
+	limit := query.pageLimit()
+	opts := options.Find().
+		SetSort(bson.D{{Key: "createdAt", Value: -1}, {Key: "id", Value: -1}}).
+		SetLimit(int64(limit + 1))
+	found, err := s.activity().Find(ctx, filter, opts)
+	if err != nil {
+		return ActivityPage{}, err
+	}
+	defer found.Close(ctx)
+
+	activity := []models.Activity{}
+	if err := found.All(ctx, &activity); err != nil {
+		return ActivityPage{}, err
+	}
+	return activityPage(activity, limit), nil
+}
+
+// TrashExpense moves an expense into its group's trash. The expense is
+// copied into the trash before it is deleted, so an interrupted move leaves
+// it in both places rather than neither.
+func (s *MongoStore) TrashExpense(ctx context.Context, groupID, expenseID, deletedBy string, at time.Time) (models.TrashedExpense, error) {
+	// Bumping the group first makes sure it exists
+	if err := s.updateOne(ctx, bson.M{"id": groupID}, bson.M{}); err != nil {
+		return models.TrashedExpense{}, err
+	}
+
+	expense, err := s.GetExpense(ctx, groupID, expenseID)
+	if err != nil {
+		return models.TrashedExpense{}, err
+	}
+
+	trashed := models.TrashedExpense{GroupID: groupID, Expense: expense, DeletedBy: deletedBy, DeletedAt: at}
+	_, err = s.trash().ReplaceOne(ctx,
+		bson.M{"groupId": groupID, "expense.id": expenseID},
+		trashed,
+		options.Replace().SetUpsert(true),
+	)
+	if err != nil {
+		return models.TrashedExpense{}, mongoErr(err)
+	}
+
+	_, err = s.expenses().DeleteOne(ctx, bson.M{"groupId": groupID, "id": expenseID})
+	return trashed, err
+}
+
+// ListTrashedExpenses returns a group's trashed expenses, most recently
+// deleted first
+func (s *MongoStore) ListTrashedExpenses(ctx context.Context, groupID string) ([]models.TrashedExpense, error) {
+	if err := s.groupExists(ctx, groupID); err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "deletedAt", Value: -1}, {Key: "expense.id", Value: 1}})
+	return s.findTrashed(ctx, bson.M{"groupId": groupID}, opts)
+}
+
+// RestoreExpense moves an expense out of the trash and back into its group.
+// The expense is added back before it leaves the trash, for the same reason
+// TrashExpense copies it first.
+func (s *MongoStore) RestoreExpense(ctx context.Context, groupID, expenseID string) (models.Expense, error) {
+	filter := bson.M{"groupId": groupID, "expense.id": expenseID}
+
+	var trashed models.TrashedExpense
+	if err := s.trash().FindOne(ctx, filter).Decode(&trashed); err != nil {
+		return models.Expense{}, mongoErr(err)
+	}
+
+	expense := trashed.Expense
+	if err := s.AddExpense(ctx, groupID, expense); err != nil {
+		return models.Expense{}, err
+	}
+
+	_, err := s.trash().DeleteOne(ctx, filter)
+	expense.GroupID = groupID
+	return expense, err
+}
+
+// ExpiredExpenses returns trashed expenses deleted before the given time
+func (s *MongoStore) ExpiredExpenses(ctx context.Context, before time.Time, limit int) ([]models.TrashedExpense, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "deletedAt", Value: 1}}).SetLimit(int64(limit))
+	return s.findTrashed(ctx, bson.M{"deletedAt": bson.M{"$lt": before}}, opts)
+}
+
+// PurgeExpense permanently deletes a trashed expense that was deleted
+// before the given time
+func (s *MongoStore) PurgeExpense(ctx context.Context, groupID, expenseID string, before time.Time) error {
+	result, err := s.trash().DeleteOne(ctx, bson.M{
+		"groupId":    groupID,
+		"expense.id": expenseID,
+		"deletedAt":  bson.M{"$lt": before},
+	})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// TrashGroup moves a group into the trash
+func (s *MongoStore) TrashGroup(ctx context.Context, groupID, deletedBy string, at time.Time) error {
+	result, err := s.groups().UpdateOne(ctx,
+		bson.M{"id": groupID, "deletedAt": nil},
+		bson.M{"$set": bson.M{"deletedAt": at, "deletedBy": deletedBy}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListTrashedGroups returns the groups in the trash that a user owns, most
+// recently deleted first
+func (s *MongoStore) ListTrashedGroups(ctx context.Context, uid string) ([]models.Group, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "deletedAt", Value: -1}, {Key: "id", Value: 1}})
+	return s.findGroups(ctx, bson.M{"userId": uid, "deletedAt": bson.M{"$ne": nil}}, opts)
+}
+
+// GetTrashedGroup finds a group in the trash by ID
+func (s *MongoStore) GetTrashedGroup(ctx context.Context, groupID string) (models.Group, error) {
+	var group models.Group
+	err := s.groups().FindOne(ctx, bson.M{"id": groupID, "deletedAt": bson.M{"$ne": nil}}).Decode(&group)
+	return group, mongoErr(err)
+}
+
+// RestoreGroup moves a group out of the trash
+func (s *MongoStore) RestoreGroup(ctx context.Context, groupID string) (models.Group, error) {
+	var group models.Group
+	err := s.groups().FindOneAndUpdate(
+		ctx,
+		bson.M{"id": groupID, "deletedAt": bson.M{"$ne": nil}},
+		bson.M{"$unset": bson.M{"deletedAt": "", "deletedBy": ""}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&group)
+	return group, mongoErr(err)
+}
+
+// ExpiredGroups returns groups in the trash deleted before the given time
+func (s *MongoStore) ExpiredGroups(ctx context.Context, before time.Time, limit int) ([]models.Group, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "deletedAt", Value: 1}, {Key: "id", Value: 1}}).SetLimit(int64(limit))
+	return s.findGroups(ctx, bson.M{"deletedAt": bson.M{"$lt": before}}, opts)
+}
+
+// PurgeGroup permanently deletes a group in the trash that was deleted
+// before the given time, along with everything in it
+func (s *MongoStore) PurgeGroup(ctx context.Context, groupID string, before time.Time) error {
+	return s.deleteGroup(ctx, bson.M{"id": groupID, "deletedAt": bson.M{"$lt": before}})
+}
+
+// deleteGroup removes the group matching a filter, followed by its
+// expenses, recurring expenses, activity log and trash
+func (s *MongoStore) deleteGroup(ctx context.Context, filter bson.M) error {
+	var group models.Group
+	if err := s.groups().FindOneAndDelete(ctx, filter).Decode(&group); err != nil {
+		return mongoErr(err)
+	}
+
+	groupID := group.GroupID
+	if _, err := s.recurring().DeleteMany(ctx, bson.M{"groupId": groupID}); err != nil {
+		return err
+	}
+	if _, err := s.activity().DeleteMany(ctx, bson.M{"groupId": groupID}); err != nil {
+		return err
+	}
+	if _, err := s.trash().DeleteMany(ctx, bson.M{"groupId": groupID}); err != nil {
+		return err
+	}
+	_, err := s.expenses().DeleteMany(ctx, bson.M{"groupId": groupID})
+	return err
+}
+
+// groupExists returns ErrNotFound if there is no group with the given ID
+func (s *MongoStore) groupExists(ctx context.Context, groupID string) error {
+	count, err := s.groups().CountDocuments(ctx, bson.M{"id": groupID}, options.Count().SetLimit(1))
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// insertExpenses adds expenses to a group's expense collection
+func (s *MongoStore) insertExpenses(ctx context.Context, groupID string, expenses []models.Expense) error {
+	if len(expenses) == 0 {
+		return nil
+	}
+
+	docs := make([]interface{}, len(expenses))
+	for i, e := range expenses {
+		e.GroupID = groupID
+		docs[i] = e
+	}
+	_, err := s.expenses().InsertMany(ctx, docs)
+	return mongoErr(err)
+}
+
+// replaceExpenses makes the given expenses a group's only ones. Without a
+// transaction the writes can't be atomic, so they are ordered to never lose
+// an expense: every given one is written, replacing the stored one with the
+// same ID, before those that are left out are deleted. A failure part of
+// the way leaves some expenses as they were, never fewer of them.
+// The expense IDs must be unique.
+func (s *MongoStore) replaceExpenses(ctx context.Context, groupID string, expenses []models.Expense) error {
+	ids := make(bson.A, len(expenses))
+	writes := make([]mongo.WriteModel, len(expenses))
+	for i, e := range expenses {
+		ids[i] = e.ID
+		e.GroupID = groupID
+		writes[i] = mongo.NewReplaceOneModel().
+			SetFilter(bson.M{"groupId": groupID, "id": e.ID}).
+			SetReplacement(e).
+			SetUpsert(true)
+	}
+
+	if len(writes) > 0 {
+		if _, err := s.expenses().BulkWrite(ctx, writes); err != nil {
+			return mongoErr(err)
+		}
+	}
+	_, err := s.expenses().DeleteMany(ctx, bson.M{"groupId": groupID, "id": bson.M{"$nin": ids}})
+	return err
+}
+
+// findExpenses runs an expense query, returning an empty list if nothing matched
+func (s *MongoStore) findExpenses(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.Expense, error) {
+	cursor, err := s.expenses().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	expenses := []models.Expense{}
+	if err := cursor.All(ctx, &expenses); err != nil {
+		return nil, err
+	}
+	return expenses, nil
+}
+
+// aggregateExpenses runs a pipeline over the expenses collection, returning
+// an empty list if nothing matched
+func (s *MongoStore) aggregateExpenses(ctx context.Context, pipeline mongo.Pipeline) ([]models.Expense, error) {
+	cursor, err := s.expenses().Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+
+	expenses := []models.Expense{}
+	if err := cursor.All(ctx, &expenses); err != nil {
+		return nil, err
+	}
+	return expenses, nil
+}
+
+// findGroups runs a group query, returning an empty list if nothing matched
+func (s *MongoStore) findGroups(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.Group, error) {
+	cursor, err := s.groups().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := []models.Group{}
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// findTrashed runs a trashed expense query, returning an empty list if
+// nothing matched
+func (s *MongoStore) findTrashed(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.TrashedExpense, error) {
+	cursor, err := s.trash().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	trashed := []models.TrashedExpense{}
+	if err := cursor.All(ctx, &trashed); err != nil {
+		return nil, err
+	}
+	return trashed, nil
+}
+
+// findRecurring runs a recurring expense query, returning an empty list if
+// nothing matched
+func (s *MongoStore) findRecurring(ctx context.Context, filter bson.M, opts *options.FindOptions) ([]models.RecurringExpense, error) {
+	cursor, err := s.recurring().Find(ctx, filter, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	recurring := []models.RecurringExpense{}
+	if err := cursor.All(ctx, &recurring); err != nil {
+		return nil, err
+	}
+	return recurring, nil
+}
+
+// touch adds the version and timestamp bump every group mutation carries
+func touch(update bson.M) bson.M {
+	set, _ := update["$set"].(bson.M)
+	if set == nil {
+		set = bson.M{}
+	}
+	set["updatedAt"] = time.Now()
+	update["$set"] = set
+	update["$inc"] = bson.M{"version": 1}
+	return update
+}
+
+// updateOne applies a group mutation, returning ErrNotFound if no group matched
+func (s *MongoStore) updateOne(ctx context.Context, filter, update bson.M) error {
+	result, err := s.groups().UpdateOne(ctx, filter, touch(update))
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// findOneAndUpdate applies a group mutation and returns the updated group
+func (s *MongoStore) findOneAndUpdate(ctx context.Context, filter, update bson.M) (models.Group, error) {
+	var group models.Group
+	err := s.groups().FindOneAndUpdate(
+		ctx,
+		filter,
+		touch(update),
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&group)
+	return group, mongoErr(err)
+}
+
+// versionFilter matches a group at the given version. Groups created before
+// versioning have no version field, which is treated as version 0.
+func versionFilter(version int64) interface{} {
+	if version == 0 {
+		return bson.M{"$in": bson.A{0, nil}}
+	}
+	return version
+}
+
+// mongoErr maps driver errors onto the store's errors
+func mongoErr(err error) error {
+	if err == mongo.ErrNoDocuments {
+		return ErrNotFound
+	}
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrDuplicate
+	}
+	return err
+}
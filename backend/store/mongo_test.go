@@ -0,0 +1,47 @@
+package store_test
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"split-it/backend/migrations"
+	"split-it/backend/store"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// TestMongoStore runs against the server at MONGODB_TEST_URI, and is skipped
+// without one. Each subtest gets a database of its own, dropped afterwards.
+func TestMongoStore(t *testing.T) {
+	uri := os.Getenv("MONGODB_TEST_URI")
+	if uri == "" {
+		t.Skip("MONGODB_TEST_URI is not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	defer client.Disconnect(context.Background())
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+
+	n := 0
+	testStore(t, func(t *testing.T) store.Store {
+		n++
+		db := client.Database(fmt.Sprintf("split-it-test-%d-%d", time.Now().Unix(), n))
+		t.Cleanup(func() { db.Drop(context.Background()) })
+
+		// The unique indexes the store relies on come from the migrations
+		if err := migrations.Run(context.Background(), db); err != nil {
+			t.Fatalf("migrations.Run: %v", err)
+		}
+		return store.NewMongoStore(db)
+	})
+}
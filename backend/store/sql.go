@@ -0,0 +1,478 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"split-it/backend/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// dialect captures the differences between the SQL databases we support
+type dialect struct {
+	name      string
+	timestamp string
+	float     string
+	// numbered placeholders ($1, $2, ...) instead of ?
+	numbered bool
+}
+
+var (
+	sqliteDialect   = dialect{name: "sqlite", timestamp: "TIMESTAMP", float: "REAL"}
+	postgresDialect = dialect{name: "postgres", timestamp: "TIMESTAMPTZ", float: "DOUBLE PRECISION", numbered: true}
+)
+
+// rebind rewrites the ? placeholders in a query for the dialect
+func (d dialect) rebind(query string) string {
+	if !d.numbered {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// schema creates the tables. Groups are normalized into one table per
+// nested list; list order is kept in a position column.
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		id TEXT PRIMARY KEY,
+		firebase_uid TEXT NOT NULL UNIQUE,
+		email TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL DEFAULT '',
+		phone TEXT NOT NULL DEFAULT '',
+		email_verified BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at {{timestamp}} NOT NULL,
+		updated_at {{timestamp}} NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS groups (
+		id TEXT PRIMARY KEY,
+		object_id TEXT NOT NULL DEFAULT '',
+		name TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		version BIGINT NOT NULL DEFAULT 0,
+		created_at {{timestamp}} NOT NULL,
+		updated_at {{timestamp}} NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS groups_user_id_idx ON groups (user_id)`,
+	`CREATE TABLE IF NOT EXISTS members (
+		group_id TEXT NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+		id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		user_id TEXT NOT NULL DEFAULT '',
+		role TEXT NOT NULL DEFAULT '',
+		PRIMARY KEY (group_id, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS members_user_id_idx ON members (user_id)`,
+	// A user is linked to at most one member of a group. Databases from
+	// before the index was added keep only the first of any such members
+	// linked.
+	`UPDATE members SET user_id = ''
+	WHERE user_id <> '' AND EXISTS (
+		SELECT 1 FROM members earlier
+		WHERE earlier.group_id = members.group_id
+			AND earlier.user_id = members.user_id
+			AND earlier.position < members.position
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS members_group_user_idx
+	ON members (group_id, user_id) WHERE user_id <> ''`,
+	`CREATE TABLE IF NOT EXISTS group_categories (
+		group_id TEXT NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+		position INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		PRIMARY KEY (group_id, position)
+	)`,
+	`CREATE TABLE IF NOT EXISTS expenses (
+		group_id TEXT NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+		id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		description TEXT NOT NULL,
+		amount BIGINT NOT NULL,
+		paid_by TEXT NOT NULL,
+		split_type TEXT NOT NULL DEFAULT '',
+		date {{timestamp}} NOT NULL,
+		PRIMARY KEY (group_id, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS expenses_date_idx ON expenses (group_id, date, id)`,
+	`CREATE TABLE IF NOT EXISTS expense_participants (
+		group_id TEXT NOT NULL,
+		expense_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		member_id TEXT NOT NULL,
+		PRIMARY KEY (group_id, expense_id, position),
+		FOREIGN KEY (group_id, expense_id) REFERENCES expenses (group_id, id) ON DELETE CASCADE
+	)`,
+	`CREATE TABLE IF NOT EXISTS expense_payers (
+		group_id TEXT NOT NULL,
+		expense_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		member_id TEXT NOT NULL,
+		amount BIGINT NOT NULL,
+		PRIMARY KEY (group_id, expense_id, position),
+		FOREIGN KEY (group_id, expense_id) REFERENCES expenses (group_id, id) ON DELETE CASCADE
+	)`,
+	`CREATE TABLE IF NOT EXISTS expense_split_parts (
+		group_id TEXT NOT NULL,
+		expense_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		member_id TEXT NOT NULL,
+		amount BIGINT NOT NULL DEFAULT 0,
+		percent {{float}} NOT NULL DEFAULT 0,
+		shares BIGINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (group_id, expense_id, position),
+		FOREIGN KEY (group_id, expense_id) REFERENCES expenses (group_id, id) ON DELETE CASCADE
+	)`,
+	`CREATE TABLE IF NOT EXISTS expense_items (
+		group_id TEXT NOT NULL,
+		expense_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		description TEXT NOT NULL,
+		amount BIGINT NOT NULL,
+		PRIMARY KEY (group_id, expense_id, position),
+		FOREIGN KEY (group_id, expense_id) REFERENCES expenses (group_id, id) ON DELETE CASCADE
+	)`,
+	`CREATE TABLE IF NOT EXISTS expense_item_participants (
+		group_id TEXT NOT NULL,
+		expense_id TEXT NOT NULL,
+		item_position INTEGER NOT NULL,
+		position INTEGER NOT NULL,
+		member_id TEXT NOT NULL,
+		PRIMARY KEY (group_id, expense_id, item_position, position),
+		FOREIGN KEY (group_id, expense_id) REFERENCES expenses (group_id, id) ON DELETE CASCADE
+	)`,
+	`CREATE TABLE IF NOT EXISTS expense_tags (
+		group_id TEXT NOT NULL,
+		expense_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		tag TEXT NOT NULL,
+		PRIMARY KEY (group_id, expense_id, position),
+		FOREIGN KEY (group_id, expense_id) REFERENCES expenses (group_id, id) ON DELETE CASCADE
+	)`,
+	`CREATE INDEX IF NOT EXISTS expense_tags_tag_idx ON expense_tags (group_id, tag)`,
+	`CREATE TABLE IF NOT EXISTS expense_attachments (
+		group_id TEXT NOT NULL,
+		expense_id TEXT NOT NULL,
+		id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		filename TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		size BIGINT NOT NULL,
+		uploaded_by TEXT NOT NULL,
+		uploaded_at {{timestamp}} NOT NULL,
+		PRIMARY KEY (group_id, expense_id, id),
+		FOREIGN KEY (group_id, expense_id) REFERENCES expenses (group_id, id) ON DELETE CASCADE
+	)`,
+	`CREATE TABLE IF NOT EXISTS payments (
+		group_id TEXT NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+		id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		from_member TEXT NOT NULL,
+		to_member TEXT NOT NULL,
+		amount BIGINT NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		date {{timestamp}} NOT NULL,
+		PRIMARY KEY (group_id, id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS invites (
+		token TEXT PRIMARY KEY,
+		group_id TEXT NOT NULL,
+		member_id TEXT NOT NULL DEFAULT '',
+		role TEXT NOT NULL DEFAULT '',
+		created_by TEXT NOT NULL,
+		max_uses INTEGER NOT NULL,
+		uses INTEGER NOT NULL DEFAULT 0,
+		expires_at {{timestamp}} NOT NULL,
+		created_at {{timestamp}} NOT NULL
+	)`,
+	// The template is only ever read and written whole, so it is kept as a
+	// JSON document rather than spread over tables like expenses are
+	`CREATE TABLE IF NOT EXISTS recurring_expenses (
+		group_id TEXT NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+		id TEXT NOT NULL,
+		template TEXT NOT NULL,
+		frequency TEXT NOT NULL,
+		interval_count INTEGER NOT NULL,
+		start_date {{timestamp}} NOT NULL,
+		end_date {{timestamp}},
+		next_run {{timestamp}},
+		created_by TEXT NOT NULL,
+		created_at {{timestamp}} NOT NULL,
+		PRIMARY KEY (group_id, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS recurring_expenses_next_run_idx ON recurring_expenses (next_run)`,
+	// Snapshots are kept as JSON documents for the same reason as templates
+	`CREATE TABLE IF NOT EXISTS activity (
+		group_id TEXT NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+		id TEXT NOT NULL,
+		actor TEXT NOT NULL,
+		actor_name TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		target_id TEXT NOT NULL DEFAULT '',
+		before_state TEXT,
+		after_state TEXT,
+		created_at {{timestamp}} NOT NULL,
+		PRIMARY KEY (group_id, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS activity_created_at_idx ON activity (group_id, created_at, id)`,
+	// Expenses in the trash are only ever read and written whole too
+	`CREATE TABLE IF NOT EXISTS trashed_expenses (
+		group_id TEXT NOT NULL REFERENCES groups (id) ON DELETE CASCADE,
+		expense_id TEXT NOT NULL,
+		expense TEXT NOT NULL,
+		deleted_by TEXT NOT NULL,
+		deleted_at {{timestamp}} NOT NULL,
+		PRIMARY KEY (group_id, expense_id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS trashed_expenses_deleted_at_idx ON trashed_expenses (deleted_at)`,
+}
+
+// addedColumns lists columns added to tables after they were first
+// released. They are added to existing databases when missing.
+var addedColumns = []struct {
+	table, column, definition string
+}{
+	{"groups", "currency", "TEXT NOT NULL DEFAULT ''"},
+	{"groups", "deleted_at", "{{timestamp}}"},
+	{"groups", "deleted_by", "TEXT NOT NULL DEFAULT ''"},
+	{"expenses", "currency", "TEXT NOT NULL DEFAULT ''"},
+	{"expenses", "exchange_rate", "{{float}} NOT NULL DEFAULT 0"},
+	{"expenses", "base_amount", "BIGINT NOT NULL DEFAULT 0"},
+	{"expenses", "category", "TEXT NOT NULL DEFAULT ''"},
+	{"expenses", "split_tax", "BIGINT NOT NULL DEFAULT 0"},
+	{"expenses", "split_tip", "BIGINT NOT NULL DEFAULT 0"},
+}
+
+// SQLStore implements Store on top of SQLite or PostgreSQL
+type SQLStore struct {
+	db      *sql.DB
+	dialect dialect
+}
+
+// OpenSQLite opens (creating if needed) a SQLite database file. Use
+// ":memory:" for a throwaway database.
+func OpenSQLite(path string) (*SQLStore, error) {
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; sharing one connection also keeps an
+	// in-memory database alive and visible to every query
+	db.SetMaxOpenConns(1)
+
+	return newSQLStore(db, sqliteDialect)
+}
+
+// OpenPostgres connects to a PostgreSQL database given a connection URL
+func OpenPostgres(url string) (*SQLStore, error) {
+	db, err := sql.Open("postgres", url)
+	if err != nil {
+		return nil, err
+	}
+
+	return newSQLStore(db, postgresDialect)
+}
+
+func newSQLStore(db *sql.DB, d dialect) (*SQLStore, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	s := &SQLStore{db: db, dialect: d}
+	if err := s.createSchema(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating schema: %w", err)
+	}
+	return s, nil
+}
+
+// Close closes the underlying database
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLStore) createSchema(ctx context.Context) error {
+	replacer := strings.NewReplacer("{{timestamp}}", s.dialect.timestamp, "{{float}}", s.dialect.float)
+	for _, stmt := range schema {
+		if _, err := s.db.ExecContext(ctx, replacer.Replace(stmt)); err != nil {
+			return err
+		}
+	}
+
+	// Selecting a column is the one existence check both databases share
+	for _, c := range addedColumns {
+		rows, err := s.db.QueryContext(ctx, `SELECT `+c.column+` FROM `+c.table+` WHERE 1 = 0`)
+		if err == nil {
+			rows.Close()
+			continue
+		}
+		stmt := `ALTER TABLE ` + c.table + ` ADD COLUMN ` + c.column + ` ` + replacer.Replace(c.definition)
+		if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+func (s *SQLStore) exec(ctx context.Context, q querier, query string, args ...any) (sql.Result, error) {
+	return q.ExecContext(ctx, s.dialect.rebind(query), args...)
+}
+
+func (s *SQLStore) query(ctx context.Context, q querier, query string, args ...any) (*sql.Rows, error) {
+	return q.QueryContext(ctx, s.dialect.rebind(query), args...)
+}
+
+func (s *SQLStore) queryRow(ctx context.Context, q querier, query string, args ...any) *sql.Row {
+	return q.QueryRowContext(ctx, s.dialect.rebind(query), args...)
+}
+
+// GetUser finds a user by Firebase UID
+func (s *SQLStore) GetUser(ctx context.Context, firebaseUID string) (models.User, error) {
+	return s.getUser(ctx, s.db, firebaseUID)
+}
+
+func (s *SQLStore) getUser(ctx context.Context, q querier, firebaseUID string) (models.User, error) {
+	var user models.User
+	var id string
+	err := s.queryRow(ctx, q, `
+		SELECT id, firebase_uid, email, name, phone, email_verified, created_at, updated_at
+		FROM users WHERE firebase_uid = ?`, firebaseUID,
+	).Scan(&id, &user.FirebaseUID, &user.Email, &user.Name, &user.Phone, &user.EmailVerified, &user.CreatedAt, &user.UpdatedAt)
+	if err != nil {
+		return models.User{}, sqlErr(err)
+	}
+
+	user.ID, _ = primitive.ObjectIDFromHex(id)
+	return user, nil
+}
+
+// CreateUser inserts a new user
+func (s *SQLStore) CreateUser(ctx context.Context, user models.User) error {
+	_, err := s.exec(ctx, s.db, `
+		INSERT INTO users (id, firebase_uid, email, name, phone, email_verified, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		user.ID.Hex(), user.FirebaseUID, user.Email, user.Name, user.Phone, user.EmailVerified,
+		user.CreatedAt.UTC(), user.UpdatedAt.UTC(),
+	)
+	return sqlErr(err)
+}
+
+// UpdateUser changes a user's name and phone number
+func (s *SQLStore) UpdateUser(ctx context.Context, firebaseUID, name, phone string) (models.User, error) {
+	result, err := s.exec(ctx, s.db, `
+		UPDATE users SET name = ?, phone = ?, updated_at = ? WHERE firebase_uid = ?`,
+		name, phone, time.Now().UTC(), firebaseUID,
+	)
+	if err := affected(result, err); err != nil {
+		return models.User{}, err
+	}
+	return s.getUser(ctx, s.db, firebaseUID)
+}
+
+// CreateInvite inserts a new invite
+func (s *SQLStore) CreateInvite(ctx context.Context, invite models.Invite) error {
+	_, err := s.exec(ctx, s.db, `
+		INSERT INTO invites (token, group_id, member_id, role, created_by, max_uses, uses, expires_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		invite.Token, invite.GroupID, invite.MemberID, invite.Role, invite.CreatedBy,
+		invite.MaxUses, invite.Uses, invite.ExpiresAt.UTC(), invite.CreatedAt.UTC(),
+	)
+	return sqlErr(err)
+}
+
+// GetInvite finds an invite by token
+func (s *SQLStore) GetInvite(ctx context.Context, token string) (models.Invite, error) {
+	var invite models.Invite
+	err := s.queryRow(ctx, s.db, `
+		SELECT token, group_id, member_id, role, created_by, max_uses, uses, expires_at, created_at
+		FROM invites WHERE token = ?`, token,
+	).Scan(&invite.Token, &invite.GroupID, &invite.MemberID, &invite.Role, &invite.CreatedBy,
+		&invite.MaxUses, &invite.Uses, &invite.ExpiresAt, &invite.CreatedAt)
+	return invite, sqlErr(err)
+}
+
+// RedeemInvite uses up one redemption. The conditions guard against
+// concurrent redemptions exceeding the limit or racing the expiry.
+func (s *SQLStore) RedeemInvite(ctx context.Context, token string) error {
+	result, err := s.exec(ctx, s.db, `
+		UPDATE invites SET uses = uses + 1
+		WHERE token = ? AND uses < max_uses AND expires_at > ?`,
+		token, time.Now().UTC(),
+	)
+	if err := affected(result, err); err == ErrNotFound {
+		return ErrInviteUnavailable
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReleaseInvite gives back a redemption
+func (s *SQLStore) ReleaseInvite(ctx context.Context, token string) error {
+	_, err := s.exec(ctx, s.db, `UPDATE invites SET uses = uses - 1 WHERE token = ?`, token)
+	return err
+}
+
+// affected returns ErrNotFound if a statement changed no rows
+func affected(result sql.Result, err error) error {
+	if err != nil {
+		return sqlErr(err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// sqlErr maps driver errors onto the store's errors
+func sqlErr(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		return ErrDuplicate
+	}
+
+	var sqliteErr *sqlite.Error
+	if errors.As(err, &sqliteErr) {
+		switch sqliteErr.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY, sqlite3.SQLITE_CONSTRAINT_UNIQUE:
+			return ErrDuplicate
+		}
+	}
+	return err
+}
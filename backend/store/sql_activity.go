@@ -0,0 +1,100 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"split-it/backend/models"
+	"strconv"
+)
+
+// AddActivity appends an entry to its group's log
+func (s *SQLStore) AddActivity(ctx context.Context, activity models.Activity) error {
+	if err := s.groupExists(ctx, activity.GroupID); err != nil {
+		return err
+	}
+
+	before, err := snapshotJSON(activity.Before)
+	if err != nil {
+		return err
+	}
+	after, err := snapshotJSON(activity.After)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.exec(ctx, s.db, `
+		INSERT INTO activity (group_id, id, actor, actor_name, action, target_id, before_state, after_state, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		activity.GroupID, activity.ID, activity.Actor, activity.ActorName, activity.Action, activity.TargetID,
+		before, after, activity.CreatedAt.UTC(),
+	)
+	return sqlErr(err)
+}
+
+// ListActivity returns a page of a group's log, newest first
+func (s *SQLStore) ListActivity(ctx context.Context, groupID string, query ActivityQuery) (ActivityPage, error) {
+	cursor, err := decodeActivityCursor(query.Cursor)
+	if err != nil {
+		return ActivityPage{}, err
+	}
+	if err := s.groupExists(ctx, groupID); err != nil {
+		return ActivityPage{}, err
+	}
+
+	where := `WHERE group_id = ?`
+	args := []any{groupID}
+	if cursor != nil {
+		where += ` AND (created_at < ? OR (created_at = ? AND id < ?))`
+		args = append(args, cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+	limit := query.pageLimit()
+
+	activity := []models.Activity{}
+	err = s.scanRows(ctx, s.db, func(rows *sql.Rows) error {
+		var a models.Activity
+		var before, after sql.NullString
+		if err := rows.Scan(&a.GroupID, &a.ID, &a.Actor, &a.ActorName, &a.Action, &a.TargetID,
+			&before, &after, &a.CreatedAt); err != nil {
+			return err
+		}
+		var err error
+		if a.Before, err = parseSnapshot(before); err != nil {
+			return err
+		}
+		if a.After, err = parseSnapshot(after); err != nil {
+			return err
+		}
+		activity = append(activity, a)
+		return nil
+	}, `SELECT group_id, id, actor, actor_name, action, target_id, before_state, after_state, created_at
+		FROM activity `+where+` ORDER BY created_at DESC, id DESC LIMIT `+strconv.Itoa(limit+1), args...)
+	if err != nil {
+		return ActivityPage{}, err
+	}
+	return activityPage(activity, limit), nil
+}
+
+// snapshotJSON encodes an optional snapshot as a nullable JSON column value
+func snapshotJSON(snapshot *models.ActivitySnapshot) (sql.NullString, error) {
+	if snapshot == nil {
+		return sql.NullString{}, nil
+	}
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// parseSnapshot decodes a snapshot stored by snapshotJSON
+func parseSnapshot(data sql.NullString) (*models.ActivitySnapshot, error) {
+	if !data.Valid {
+		return nil, nil
+	}
+	var snapshot models.ActivitySnapshot
+	if err := json.Unmarshal([]byte(data.String), &snapshot); err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
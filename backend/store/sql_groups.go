@@ -0,0 +1,869 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"split-it/backend/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ListGroups returns a page of the groups a user owns or is a linked
+// member of
+func (s *SQLStore) ListGroups(ctx context.Context, uid string, query GroupQuery) (GroupPage, error) {
+	cursor, err := decodeGroupCursor(query.Cursor)
+	if err != nil {
+		return GroupPage{}, err
+	}
+
+	where := `WHERE deleted_at IS NULL AND (user_id = ? OR id IN (SELECT group_id FROM members WHERE user_id = ?))`
+	args := []any{uid, uid}
+	if cursor != nil {
+		where += ` AND (created_at < ? OR (created_at = ? AND id < ?))`
+		args = append(args, cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+	order := ` ORDER BY created_at DESC, id DESC`
+	if query.Limit > 0 {
+		order += ` LIMIT ` + strconv.Itoa(query.Limit+1)
+	}
+
+	groups, err := s.loadGroups(ctx, where+order, args...)
+	if err != nil {
+		return GroupPage{}, err
+	}
+	return groupPage(groups, query.Limit), nil
+}
+
+// GetGroup finds a group by ID
+func (s *SQLStore) GetGroup(ctx context.Context, groupID string) (models.Group, error) {
+	group, err := s.loadGroup(ctx, s.db, groupID)
+	if err == nil && group.DeletedAt != nil {
+		return models.Group{}, ErrNotFound
+	}
+	return group, err
+}
+
+// CreateGroup inserts a new group
+func (s *SQLStore) CreateGroup(ctx context.Context, group models.Group) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		_, err := s.exec(ctx, tx, `
+			INSERT INTO groups (id, object_id, name, currency, user_id, version, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			group.GroupID, group.ID.Hex(), group.Name, group.Currency, group.UserID, group.Version,
+			group.CreatedAt.UTC(), group.UpdatedAt.UTC(),
+		)
+		if err != nil {
+			return sqlErr(err)
+		}
+
+		if err := s.insertMembers(ctx, tx, group.GroupID, group.Members); err != nil {
+			return err
+		}
+		if err := s.insertCategories(ctx, tx, group.GroupID, group.Categories); err != nil {
+			return err
+		}
+		for i, e := range group.Expenses {
+			if err := s.insertExpense(ctx, tx, group.GroupID, i, e); err != nil {
+				return err
+			}
+		}
+		for i, p := range group.Payments {
+			if err := s.insertPayment(ctx, tx, group.GroupID, i, p); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UpdateGroup replaces a group's name, currency, categories and members,
+// and its expenses if given, as long as its version hasn't changed
+func (s *SQLStore) UpdateGroup(ctx context.Context, group models.Group) (models.Group, error) {
+	var updated models.Group
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := s.exec(ctx, tx, `
+			UPDATE groups SET name = ?, currency = ?, version = version + 1, updated_at = ?
+			WHERE id = ? AND version = ?`,
+			group.Name, group.Currency, time.Now().UTC(), group.GroupID, group.Version,
+		)
+		if err := affected(result, err); err == ErrNotFound {
+			// Tell a stale version apart from a missing group
+			var exists int
+			if err := s.queryRow(ctx, tx, `SELECT 1 FROM groups WHERE id = ?`, group.GroupID).Scan(&exists); err != nil {
+				return sqlErr(err)
+			}
+			return ErrConflict
+		} else if err != nil {
+			return err
+		}
+
+		if _, err := s.exec(ctx, tx, `DELETE FROM members WHERE group_id = ?`, group.GroupID); err != nil {
+			return err
+		}
+		if err := s.insertMembers(ctx, tx, group.GroupID, group.Members); err != nil {
+			return err
+		}
+
+		if _, err := s.exec(ctx, tx, `DELETE FROM group_categories WHERE group_id = ?`, group.GroupID); err != nil {
+			return err
+		}
+		if err := s.insertCategories(ctx, tx, group.GroupID, group.Categories); err != nil {
+			return err
+		}
+
+		if group.Expenses != nil {
+			// Expense child rows go with their expense
+			if _, err := s.exec(ctx, tx, `DELETE FROM expenses WHERE group_id = ?`, group.GroupID); err != nil {
+				return err
+			}
+			for i, e := range group.Expenses {
+				if err := s.insertExpense(ctx, tx, group.GroupID, i, e); err != nil {
+					return err
+				}
+			}
+		}
+
+		updated, err = s.loadGroup(ctx, tx, group.GroupID)
+		return err
+	})
+	return updated, err
+}
+
+// DeleteGroup removes a group along with everything in it
+func (s *SQLStore) DeleteGroup(ctx context.Context, groupID string) error {
+	result, err := s.exec(ctx, s.db, `DELETE FROM groups WHERE id = ?`, groupID)
+	return affected(result, err)
+}
+
+// GroupExpenses returns every expense in a group, oldest first
+func (s *SQLStore) GroupExpenses(ctx context.Context, groupID string) ([]models.Expense, error) {
+	if err := s.groupExists(ctx, groupID); err != nil {
+		return nil, err
+	}
+	return s.loadExpenses(ctx, s.db, `WHERE group_id = ? ORDER BY date, id`, groupID)
+}
+
+// GetExpense finds one expense in a group
+func (s *SQLStore) GetExpense(ctx context.Context, groupID, expenseID string) (models.Expense, error) {
+	expenses, err := s.loadExpenses(ctx, s.db, `WHERE group_id = ? AND id = ?`, groupID, expenseID)
+	if err != nil {
+		return models.Expense{}, err
+	}
+	if len(expenses) == 0 {
+		return models.Expense{}, ErrNotFound
+	}
+	return expenses[0], nil
+}
+
+// ListExpenses returns one page of a group's expenses matching a query
+func (s *SQLStore) ListExpenses(ctx context.Context, groupID string, query ExpenseQuery) (ExpensePage, error) {
+	order := query.sort()
+	cursor, err := decodeCursor(query.Cursor, order)
+	if err != nil {
+		return ExpensePage{}, err
+	}
+	if err := s.groupExists(ctx, groupID); err != nil {
+		return ExpensePage{}, err
+	}
+
+	where := `WHERE group_id = ?`
+	args := []any{groupID}
+	if !query.From.IsZero() {
+		where += ` AND date >= ?`
+		args = append(args, query.From.UTC())
+	}
+	if !query.To.IsZero() {
+		where += ` AND date < ?`
+		args = append(args, query.To.UTC())
+	}
+	if query.PaidBy != "" {
+		where += ` AND (paid_by = ? OR EXISTS (SELECT 1 FROM expense_payers p
+			WHERE p.group_id = expenses.group_id AND p.expense_id = expenses.id AND p.member_id = ?))`
+		args = append(args, query.PaidBy, query.PaidBy)
+	}
+	if query.Participant != "" {
+		where += ` AND EXISTS (SELECT 1 FROM expense_participants p
+			WHERE p.group_id = expenses.group_id AND p.expense_id = expenses.id AND p.member_id = ?)`
+		args = append(args, query.Participant)
+	}
+	if query.MinAmount != nil {
+		where += ` AND ` + amountInBaseColumn + ` >= ?`
+		args = append(args, *query.MinAmount)
+	}
+	if query.MaxAmount != nil {
+		where += ` AND ` + amountInBaseColumn + ` <= ?`
+		args = append(args, *query.MaxAmount)
+	}
+	if query.Search != "" {
+		where += ` AND LOWER(description) LIKE ? ESCAPE '\'`
+		args = append(args, "%"+likeEscaper.Replace(strings.ToLower(query.Search))+"%")
+	}
+	if query.Category != "" {
+		where += ` AND category = ?`
+		args = append(args, query.Category)
+	}
+	if query.Tag != "" {
+		where += ` AND EXISTS (SELECT 1 FROM expense_tags t
+			WHERE t.group_id = expenses.group_id AND t.expense_id = expenses.id AND t.tag = ?)`
+		args = append(args, query.Tag)
+	}
+
+	// The sort field comes from a fixed set, so it is safe to splice in
+	field, dir, op := order.Field(), "ASC", ">"
+	if field == "amount" {
+		field = amountInBaseColumn
+	}
+	if order.Descending() {
+		dir, op = "DESC", "<"
+	}
+	if cursor != nil {
+		where += ` AND (` + field + ` ` + op + ` ? OR (` + field + ` = ? AND id ` + op + ` ?))`
+		args = append(args, cursor.key(), cursor.key(), cursor.ID)
+	}
+
+	limit := query.pageLimit()
+	expenses, err := s.loadExpenses(ctx, s.db,
+		where+` ORDER BY `+field+` `+dir+`, id `+dir+` LIMIT `+strconv.Itoa(limit+1), args...)
+	if err != nil {
+		return ExpensePage{}, err
+	}
+	return page(expenses, limit, order), nil
+}
+
+// amountInBaseColumn is an expense's amount in the group's base currency,
+// like models.Expense.AmountInBase. Expenses without a currency are already
+// in the base currency.
+const amountInBaseColumn = `(CASE WHEN currency = '' THEN amount ELSE base_amount END)`
+
+// likeEscaper escapes the LIKE wildcards in search text
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// ExpenseTotals counts and sums the expenses of each of the given groups
+func (s *SQLStore) ExpenseTotals(ctx context.Context, groupIDs []string) (map[string]ExpenseTotal, error) {
+	totals := make(map[string]ExpenseTotal)
+	if len(groupIDs) == 0 {
+		return totals, nil
+	}
+
+	args := make([]any, len(groupIDs))
+	for i, id := range groupIDs {
+		args[i] = id
+	}
+
+	err := s.scanRows(ctx, s.db, func(rows *sql.Rows) error {
+		var groupID string
+		var t ExpenseTotal
+		if err := rows.Scan(&groupID, &t.Count, &t.Total); err != nil {
+			return err
+		}
+		totals[groupID] = t
+		return nil
+	}, `SELECT group_id, COUNT(*), SUM(`+amountInBaseColumn+`) FROM expenses
+		WHERE group_id IN (`+placeholders(len(args))+`) GROUP BY group_id`, args...)
+	return totals, err
+}
+
+// AddExpense appends an expense to a group
+func (s *SQLStore) AddExpense(ctx context.Context, groupID string, expense models.Expense) error {
+	return s.mutate(ctx, groupID, func(tx *sql.Tx) error {
+		position, err := s.nextPosition(ctx, tx, "expenses", groupID)
+		if err != nil {
+			return err
+		}
+		return s.insertExpense(ctx, tx, groupID, position, expense)
+	})
+}
+
+// UpdateExpense edits an expense in place, keeping its ID, date and
+// attachments
+func (s *SQLStore) UpdateExpense(ctx context.Context, groupID string, expense models.Expense) (models.Expense, error) {
+	err := s.mutate(ctx, groupID, func(tx *sql.Tx) error {
+		var position int
+		err := s.queryRow(ctx, tx, `
+			SELECT position, date FROM expenses WHERE group_id = ? AND id = ?`, groupID, expense.ID,
+		).Scan(&position, &expense.Date)
+		if err != nil {
+			return sqlErr(err)
+		}
+
+		// Deleting the row takes its attachments with it, so they are
+		// read first and inserted again along with it
+		expense.Attachments = nil
+		err = s.scanRows(ctx, tx, func(rows *sql.Rows) error {
+			var a models.Attachment
+			if err := rows.Scan(&a.ID, &a.Filename, &a.ContentType, &a.Size, &a.UploadedBy, &a.UploadedAt); err != nil {
+				return err
+			}
+			expense.Attachments = append(expense.Attachments, a)
+			return nil
+		}, `SELECT `+attachmentColumns+` FROM expense_attachments
+			WHERE group_id = ? AND expense_id = ? ORDER BY position`, groupID, expense.ID)
+		if err != nil {
+			return err
+		}
+
+		if _, err := s.exec(ctx, tx, `DELETE FROM expenses WHERE group_id = ? AND id = ?`, groupID, expense.ID); err != nil {
+			return err
+		}
+		return s.insertExpense(ctx, tx, groupID, position, expense)
+	})
+	if err != nil {
+		return models.Expense{}, err
+	}
+	return expense, nil
+}
+
+// DeleteExpense removes an expense from a group
+func (s *SQLStore) DeleteExpense(ctx context.Context, groupID, expenseID string) error {
+	return s.mutate(ctx, groupID, func(tx *sql.Tx) error {
+		_, err := s.exec(ctx, tx, `DELETE FROM expenses WHERE group_id = ? AND id = ?`, groupID, expenseID)
+		return err
+	})
+}
+
+// AddAttachment appends an attachment to an expense
+func (s *SQLStore) AddAttachment(ctx context.Context, groupID, expenseID string, attachment models.Attachment) error {
+	return s.mutate(ctx, groupID, func(tx *sql.Tx) error {
+		var position int
+		err := s.queryRow(ctx, tx, `
+			SELECT COALESCE(MAX(a.position), -1) + 1
+			FROM expenses e LEFT JOIN expense_attachments a ON a.group_id = e.group_id AND a.expense_id = e.id
+			WHERE e.group_id = ? AND e.id = ?
+			GROUP BY e.id`, groupID, expenseID,
+		).Scan(&position)
+		if err != nil {
+			return sqlErr(err)
+		}
+		return s.insertAttachment(ctx, tx, groupID, expenseID, position, attachment)
+	})
+}
+
+// RemoveAttachment removes an attachment from an expense
+func (s *SQLStore) RemoveAttachment(ctx context.Context, groupID, expenseID, attachmentID string) error {
+	return s.mutate(ctx, groupID, func(tx *sql.Tx) error {
+		result, err := s.exec(ctx, tx, `
+			DELETE FROM expense_attachments WHERE group_id = ? AND expense_id = ? AND id = ?`,
+			groupID, expenseID, attachmentID,
+		)
+		return affected(result, err)
+	})
+}
+
+// AddPayment appends a payment to a group
+func (s *SQLStore) AddPayment(ctx context.Context, groupID string, payment models.Payment) error {
+	return s.mutate(ctx, groupID, func(tx *sql.Tx) error {
+		position, err := s.nextPosition(ctx, tx, "payments", groupID)
+		if err != nil {
+			return err
+		}
+		return s.insertPayment(ctx, tx, groupID, position, payment)
+	})
+}
+
+// DeletePayment removes a payment from a group
+func (s *SQLStore) DeletePayment(ctx context.Context, groupID, paymentID string) error {
+	return s.mutate(ctx, groupID, func(tx *sql.Tx) error {
+		result, err := s.exec(ctx, tx, `DELETE FROM payments WHERE group_id = ? AND id = ?`, groupID, paymentID)
+		return affected(result, err)
+	})
+}
+
+// AddMember appends a member to a group. It returns ErrDuplicate if the
+// member's user is already linked to another member of the group.
+func (s *SQLStore) AddMember(ctx context.Context, groupID string, member models.Member) (models.Group, error) {
+	return s.mutateGroup(ctx, groupID, func(tx *sql.Tx) error {
+		position, err := s.nextPosition(ctx, tx, "members", groupID)
+		if err != nil {
+			return err
+		}
+		return s.insertMember(ctx, tx, groupID, position, member)
+	})
+}
+
+// LinkMember links a placeholder member to a user account. It returns
+// ErrConflict if the member doesn't exist or is already linked, and
+// ErrDuplicate if the user is already linked to another member of the group.
+func (s *SQLStore) LinkMember(ctx context.Context, groupID, memberID, uid string, role models.Role) (models.Group, error) {
+	return s.mutateGroup(ctx, groupID, func(tx *sql.Tx) error {
+		result, err := s.exec(ctx, tx, `
+			UPDATE members SET user_id = ?, role = ?
+			WHERE group_id = ? AND id = ? AND user_id = ''`,
+			uid, role, groupID, memberID,
+		)
+		if err := affected(result, err); err == ErrNotFound {
+			return ErrConflict
+		} else if err != nil {
+			return err
+		}
+		return nil
+	})
+}
+
+// SetMemberRole changes a member's role
+func (s *SQLStore) SetMemberRole(ctx context.Context, groupID, memberID string, role models.Role) (models.Group, error) {
+	return s.mutateGroup(ctx, groupID, func(tx *sql.Tx) error {
+		result, err := s.exec(ctx, tx, `
+			UPDATE members SET role = ? WHERE group_id = ? AND id = ?`, role, groupID, memberID)
+		return affected(result, err)
+	})
+}
+
+// RemoveMember removes a member from a group
+func (s *SQLStore) RemoveMember(ctx context.Context, groupID, memberID string) error {
+	return s.mutate(ctx, groupID, func(tx *sql.Tx) error {
+		_, err := s.exec(ctx, tx, `DELETE FROM members WHERE group_id = ? AND id = ?`, groupID, memberID)
+		return err
+	})
+}
+
+// groupExists returns ErrNotFound if there is no group with the given ID
+func (s *SQLStore) groupExists(ctx context.Context, groupID string) error {
+	var exists int
+	err := s.queryRow(ctx, s.db, `SELECT 1 FROM groups WHERE id = ?`, groupID).Scan(&exists)
+	return sqlErr(err)
+}
+
+// inTx runs fn in a transaction, committing only if it succeeds
+func (s *SQLStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// mutate bumps a group's version and timestamp and applies fn in the same
+// transaction. Bumping first locks the group row, so concurrent changes to
+// the same group are applied one after another.
+func (s *SQLStore) mutate(ctx context.Context, groupID string, fn func(tx *sql.Tx) error) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := s.exec(ctx, tx, `
+			UPDATE groups SET version = version + 1, updated_at = ? WHERE id = ?`,
+			time.Now().UTC(), groupID,
+		)
+		if err := affected(result, err); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// mutateGroup is mutate for changes that return the updated group
+func (s *SQLStore) mutateGroup(ctx context.Context, groupID string, fn func(tx *sql.Tx) error) (models.Group, error) {
+	var group models.Group
+	err := s.mutate(ctx, groupID, func(tx *sql.Tx) error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		var err error
+		group, err = s.loadGroup(ctx, tx, groupID)
+		return err
+	})
+	return group, err
+}
+
+// nextPosition returns the position after the last row of a group's list
+func (s *SQLStore) nextPosition(ctx context.Context, tx *sql.Tx, table, groupID string) (int, error) {
+	var position int
+	err := s.queryRow(ctx, tx,
+		`SELECT COALESCE(MAX(position), -1) + 1 FROM `+table+` WHERE group_id = ?`, groupID,
+	).Scan(&position)
+	return position, err
+}
+
+func (s *SQLStore) insertMembers(ctx context.Context, tx *sql.Tx, groupID string, members []models.Member) error {
+	for i, m := range members {
+		if err := s.insertMember(ctx, tx, groupID, i, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) insertMember(ctx context.Context, tx *sql.Tx, groupID string, position int, m models.Member) error {
+	_, err := s.exec(ctx, tx, `
+		INSERT INTO members (group_id, id, position, name, user_id, role)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		groupID, m.ID, position, m.Name, m.UserID, m.Role,
+	)
+	return sqlErr(err)
+}
+
+func (s *SQLStore) insertCategories(ctx context.Context, tx *sql.Tx, groupID string, categories []string) error {
+	for i, name := range categories {
+		if _, err := s.exec(ctx, tx, `
+			INSERT INTO group_categories (group_id, position, name)
+			VALUES (?, ?, ?)`,
+			groupID, i, name,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) insertExpense(ctx context.Context, tx *sql.Tx, groupID string, position int, e models.Expense) error {
+	var split models.Split
+	if e.Split != nil {
+		split = *e.Split
+	}
+
+	_, err := s.exec(ctx, tx, `
+		INSERT INTO expenses (group_id, id, position, description, amount, currency, exchange_rate, base_amount, category, paid_by, split_type, split_tax, split_tip, date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		groupID, e.ID, position, e.Description, e.Amount, e.Currency, e.ExchangeRate, e.BaseAmount,
+		e.Category, e.PaidBy, split.Type, split.Tax, split.Tip, e.Date.UTC(),
+	)
+	if err != nil {
+		return sqlErr(err)
+	}
+
+	for i, memberID := range e.Participants {
+		if _, err := s.exec(ctx, tx, `
+			INSERT INTO expense_participants (group_id, expense_id, position, member_id)
+			VALUES (?, ?, ?, ?)`,
+			groupID, e.ID, i, memberID,
+		); err != nil {
+			return err
+		}
+	}
+
+	for i, tag := range e.Tags {
+		if _, err := s.exec(ctx, tx, `
+			INSERT INTO expense_tags (group_id, expense_id, position, tag)
+			VALUES (?, ?, ?, ?)`,
+			groupID, e.ID, i, tag,
+		); err != nil {
+			return err
+		}
+	}
+
+	for i, p := range e.Payers {
+		if _, err := s.exec(ctx, tx, `
+			INSERT INTO expense_payers (group_id, expense_id, position, member_id, amount)
+			VALUES (?, ?, ?, ?, ?)`,
+			groupID, e.ID, i, p.MemberID, p.Amount,
+		); err != nil {
+			return err
+		}
+	}
+
+	for i, p := range split.Parts {
+		if _, err := s.exec(ctx, tx, `
+			INSERT INTO expense_split_parts (group_id, expense_id, position, member_id, amount, percent, shares)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			groupID, e.ID, i, p.MemberID, p.Amount, p.Percent, p.Shares,
+		); err != nil {
+			return err
+		}
+	}
+
+	for i, item := range split.Items {
+		if _, err := s.exec(ctx, tx, `
+			INSERT INTO expense_items (group_id, expense_id, position, description, amount)
+			VALUES (?, ?, ?, ?, ?)`,
+			groupID, e.ID, i, item.Description, item.Amount,
+		); err != nil {
+			return err
+		}
+		for j, memberID := range item.Participants {
+			if _, err := s.exec(ctx, tx, `
+				INSERT INTO expense_item_participants (group_id, expense_id, item_position, position, member_id)
+				VALUES (?, ?, ?, ?, ?)`,
+				groupID, e.ID, i, j, memberID,
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, a := range e.Attachments {
+		if err := s.insertAttachment(ctx, tx, groupID, e.ID, i, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// attachmentColumns are the columns of an attachment, in the order they
+// are scanned
+const attachmentColumns = `id, filename, content_type, size, uploaded_by, uploaded_at`
+
+func (s *SQLStore) insertAttachment(ctx context.Context, tx *sql.Tx, groupID, expenseID string, position int, a models.Attachment) error {
+	_, err := s.exec(ctx, tx, `
+		INSERT INTO expense_attachments (group_id, expense_id, position, `+attachmentColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		groupID, expenseID, position, a.ID, a.Filename, a.ContentType, a.Size, a.UploadedBy, a.UploadedAt.UTC(),
+	)
+	return sqlErr(err)
+}
+
+func (s *SQLStore) insertPayment(ctx context.Context, tx *sql.Tx, groupID string, position int, p models.Payment) error {
+	_, err := s.exec(ctx, tx, `
+		INSERT INTO payments (group_id, id, position, from_member, to_member, amount, note, date)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		groupID, p.ID, position, p.From, p.To, p.Amount, p.Note, p.Date.UTC(),
+	)
+	return sqlErr(err)
+}
+
+// loadGroup reads a group with its members, categories and payments
+func (s *SQLStore) loadGroup(ctx context.Context, q querier, groupID string) (models.Group, error) {
+	group := models.Group{
+		GroupID:  groupID,
+		Members:  []models.Member{},
+		Payments: []models.Payment{},
+	}
+
+	var objectID string
+	var deletedAt sql.NullTime
+	err := s.queryRow(ctx, q, `
+		SELECT object_id, name, currency, user_id, version, created_at, updated_at, deleted_at, deleted_by
+		FROM groups WHERE id = ?`, groupID,
+	).Scan(&objectID, &group.Name, &group.Currency, &group.UserID, &group.Version, &group.CreatedAt, &group.UpdatedAt,
+		&deletedAt, &group.DeletedBy)
+	if err != nil {
+		return models.Group{}, sqlErr(err)
+	}
+	group.ID, _ = primitive.ObjectIDFromHex(objectID)
+	if deletedAt.Valid {
+		group.DeletedAt = &deletedAt.Time
+	}
+
+	err = s.scanRows(ctx, q, func(rows *sql.Rows) error {
+		var m models.Member
+		if err := rows.Scan(&m.ID, &m.Name, &m.UserID, &m.Role); err != nil {
+			return err
+		}
+		group.Members = append(group.Members, m)
+		return nil
+	}, `SELECT id, name, user_id, role FROM members WHERE group_id = ? ORDER BY position`, groupID)
+	if err != nil {
+		return models.Group{}, err
+	}
+
+	err = s.scanRows(ctx, q, func(rows *sql.Rows) error {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		group.Categories = append(group.Categories, name)
+		return nil
+	}, `SELECT name FROM group_categories WHERE group_id = ? ORDER BY position`, groupID)
+	if err != nil {
+		return models.Group{}, err
+	}
+
+	err = s.scanRows(ctx, q, func(rows *sql.Rows) error {
+		var p models.Payment
+		if err := rows.Scan(&p.ID, &p.From, &p.To, &p.Amount, &p.Note, &p.Date); err != nil {
+			return err
+		}
+		group.Payments = append(group.Payments, p)
+		return nil
+	}, `SELECT id, from_member, to_member, amount, note, date FROM payments WHERE group_id = ? ORDER BY position`, groupID)
+	if err != nil {
+		return models.Group{}, err
+	}
+
+	return group, nil
+}
+
+// loadGroups reads the groups selected by a WHERE clause (which may carry
+// ORDER BY and LIMIT), skipping any deleted since they were selected
+func (s *SQLStore) loadGroups(ctx context.Context, where string, args ...any) ([]models.Group, error) {
+	var ids []string
+	err := s.scanRows(ctx, s.db, func(rows *sql.Rows) error {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		return nil
+	}, `SELECT id FROM groups `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]models.Group, 0, len(ids))
+	for _, id := range ids {
+		group, err := s.loadGroup(ctx, s.db, id)
+		if err == ErrNotFound {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// loadExpenses reads the expenses selected by a WHERE clause (which may
+// carry ORDER BY and LIMIT) along with their participants, tags, payers,
+// split and attachments
+func (s *SQLStore) loadExpenses(ctx context.Context, q querier, where string, args ...any) ([]models.Expense, error) {
+	expenses := []models.Expense{}
+
+	// Expenses are indexed by ID so their child rows can be attached
+	index := make(map[string]int)
+	err := s.scanRows(ctx, q, func(rows *sql.Rows) error {
+		var e models.Expense
+		split := models.Split{Parts: []models.SplitPart{}}
+		err := rows.Scan(&e.ID, &e.GroupID, &e.Description, &e.Amount, &e.Currency, &e.ExchangeRate, &e.BaseAmount,
+			&e.Category, &e.PaidBy, &split.Type, &split.Tax, &split.Tip, &e.Date)
+		if err != nil {
+			return err
+		}
+		if split.Type != "" {
+			e.Split = &split
+		}
+		index[e.ID] = len(expenses)
+		expenses = append(expenses, e)
+		return nil
+	}, `SELECT id, group_id, description, amount, currency, exchange_rate, base_amount, category, paid_by, split_type, split_tax, split_tip, date
+		FROM expenses `+where, args...)
+	if err != nil || len(expenses) == 0 {
+		return expenses, err
+	}
+
+	// Child rows are fetched for just the loaded expenses
+	childArgs := []any{expenses[0].GroupID}
+	for _, e := range expenses {
+		childArgs = append(childArgs, e.ID)
+	}
+	childFilter := `WHERE group_id = ? AND expense_id IN (` + placeholders(len(expenses)) + `)`
+	childWhere := childFilter + ` ORDER BY expense_id, position`
+
+	err = s.scanRows(ctx, q, func(rows *sql.Rows) error {
+		var expenseID, memberID string
+		if err := rows.Scan(&expenseID, &memberID); err != nil {
+			return err
+		}
+		e := &expenses[index[expenseID]]
+		e.Participants = append(e.Participants, memberID)
+		return nil
+	}, `SELECT expense_id, member_id FROM expense_participants `+childWhere, childArgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.scanRows(ctx, q, func(rows *sql.Rows) error {
+		var expenseID, tag string
+		if err := rows.Scan(&expenseID, &tag); err != nil {
+			return err
+		}
+		e := &expenses[index[expenseID]]
+		e.Tags = append(e.Tags, tag)
+		return nil
+	}, `SELECT expense_id, tag FROM expense_tags `+childWhere, childArgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.scanRows(ctx, q, func(rows *sql.Rows) error {
+		var expenseID string
+		var p models.Payer
+		if err := rows.Scan(&expenseID, &p.MemberID, &p.Amount); err != nil {
+			return err
+		}
+		e := &expenses[index[expenseID]]
+		e.Payers = append(e.Payers, p)
+		return nil
+	}, `SELECT expense_id, member_id, amount FROM expense_payers `+childWhere, childArgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.scanRows(ctx, q, func(rows *sql.Rows) error {
+		var expenseID string
+		var p models.SplitPart
+		if err := rows.Scan(&expenseID, &p.MemberID, &p.Amount, &p.Percent, &p.Shares); err != nil {
+			return err
+		}
+		if e := &expenses[index[expenseID]]; e.Split != nil {
+			e.Split.Parts = append(e.Split.Parts, p)
+		}
+		return nil
+	}, `SELECT expense_id, member_id, amount, percent, shares FROM expense_split_parts `+childWhere, childArgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.scanRows(ctx, q, func(rows *sql.Rows) error {
+		var expenseID string
+		item := models.LineItem{Participants: []string{}}
+		if err := rows.Scan(&expenseID, &item.Description, &item.Amount); err != nil {
+			return err
+		}
+		if e := &expenses[index[expenseID]]; e.Split != nil {
+			e.Split.Items = append(e.Split.Items, item)
+		}
+		return nil
+	}, `SELECT expense_id, description, amount FROM expense_items `+childWhere, childArgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.scanRows(ctx, q, func(rows *sql.Rows) error {
+		var expenseID, memberID string
+		var itemPosition int
+		if err := rows.Scan(&expenseID, &itemPosition, &memberID); err != nil {
+			return err
+		}
+		if e := &expenses[index[expenseID]]; e.Split != nil && itemPosition < len(e.Split.Items) {
+			item := &e.Split.Items[itemPosition]
+			item.Participants = append(item.Participants, memberID)
+		}
+		return nil
+	}, `SELECT expense_id, item_position, member_id FROM expense_item_participants `+childFilter+
+		` ORDER BY expense_id, item_position, position`, childArgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.scanRows(ctx, q, func(rows *sql.Rows) error {
+		var expenseID string
+		var a models.Attachment
+		if err := rows.Scan(&expenseID, &a.ID, &a.Filename, &a.ContentType, &a.Size, &a.UploadedBy, &a.UploadedAt); err != nil {
+			return err
+		}
+		e := &expenses[index[expenseID]]
+		e.Attachments = append(e.Attachments, a)
+		return nil
+	}, `SELECT expense_id, `+attachmentColumns+` FROM expense_attachments `+childWhere, childArgs...)
+	if err != nil {
+		return nil, err
+	}
+
+	return expenses, nil
+}
+
+// placeholders returns n comma-separated ? placeholders
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// scanRows runs a query and calls scan for each row
+func (s *SQLStore) scanRows(ctx context.Context, q querier, scan func(rows *sql.Rows) error, query string, args ...any) error {
+	rows, err := s.query(ctx, q, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
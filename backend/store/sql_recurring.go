@@ -0,0 +1,136 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"split-it/backend/models"
+	"time"
+)
+
+// recurringColumns are the columns scanned by scanRecurring, in order
+const recurringColumns = `group_id, id, template, frequency, interval_count, start_date, end_date, next_run, created_by, created_at`
+
+// ListRecurring returns a group's recurring expenses, oldest first
+func (s *SQLStore) ListRecurring(ctx context.Context, groupID string) ([]models.RecurringExpense, error) {
+	if err := s.groupExists(ctx, groupID); err != nil {
+		return nil, err
+	}
+	return s.loadRecurring(ctx, s.db, `WHERE group_id = ? ORDER BY created_at, id`, groupID)
+}
+
+// GetRecurring finds one recurring expense in a group
+func (s *SQLStore) GetRecurring(ctx context.Context, groupID, id string) (models.RecurringExpense, error) {
+	recurring, err := s.loadRecurring(ctx, s.db, `WHERE group_id = ? AND id = ?`, groupID, id)
+	if err != nil {
+		return models.RecurringExpense{}, err
+	}
+	if len(recurring) == 0 {
+		return models.RecurringExpense{}, ErrNotFound
+	}
+	return recurring[0], nil
+}
+
+// CreateRecurring adds a recurring expense to its group
+func (s *SQLStore) CreateRecurring(ctx context.Context, recurring models.RecurringExpense) error {
+	if err := s.groupExists(ctx, recurring.GroupID); err != nil {
+		return err
+	}
+
+	template, err := json.Marshal(recurring.Template)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.exec(ctx, s.db, `
+		INSERT INTO recurring_expenses (`+recurringColumns+`)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		recurring.GroupID, recurring.ID, string(template), recurring.Frequency, recurring.Interval,
+		recurring.StartDate.UTC(), nullTime(recurring.EndDate), nullTime(recurring.NextRun),
+		recurring.CreatedBy, recurring.CreatedAt.UTC(),
+	)
+	return sqlErr(err)
+}
+
+// UpdateRecurring replaces the template and schedule of a recurring expense
+func (s *SQLStore) UpdateRecurring(ctx context.Context, recurring models.RecurringExpense) (models.RecurringExpense, error) {
+	template, err := json.Marshal(recurring.Template)
+	if err != nil {
+		return models.RecurringExpense{}, err
+	}
+
+	result, err := s.exec(ctx, s.db, `
+		UPDATE recurring_expenses
+		SET template = ?, frequency = ?, interval_count = ?, start_date = ?, end_date = ?, next_run = ?
+		WHERE group_id = ? AND id = ?`,
+		string(template), recurring.Frequency, recurring.Interval, recurring.StartDate.UTC(),
+		nullTime(recurring.EndDate), nullTime(recurring.NextRun), recurring.GroupID, recurring.ID,
+	)
+	if err := affected(result, err); err != nil {
+		return models.RecurringExpense{}, err
+	}
+	return s.GetRecurring(ctx, recurring.GroupID, recurring.ID)
+}
+
+// DeleteRecurring removes a recurring expense
+func (s *SQLStore) DeleteRecurring(ctx context.Context, groupID, id string) error {
+	result, err := s.exec(ctx, s.db, `DELETE FROM recurring_expenses WHERE group_id = ? AND id = ?`, groupID, id)
+	return affected(result, err)
+}
+
+// DueRecurring returns recurring expenses whose next run is due
+func (s *SQLStore) DueRecurring(ctx context.Context, now time.Time, limit int) ([]models.RecurringExpense, error) {
+	return s.loadRecurring(ctx, s.db, `WHERE next_run <= ? ORDER BY next_run LIMIT ?`, now.UTC(), limit)
+}
+
+// AdvanceRecurring moves a recurring expense on from a due run. Matching on
+// the due run makes it a compare-and-swap.
+func (s *SQLStore) AdvanceRecurring(ctx context.Context, groupID, id string, due time.Time, next *time.Time) error {
+	result, err := s.exec(ctx, s.db, `
+		UPDATE recurring_expenses SET next_run = ?
+		WHERE group_id = ? AND id = ? AND next_run = ?`,
+		nullTime(next), groupID, id, due.UTC(),
+	)
+	if err := affected(result, err); err != ErrNotFound {
+		return err
+	}
+
+	if _, err := s.GetRecurring(ctx, groupID, id); err != nil {
+		return err
+	}
+	return ErrConflict
+}
+
+// loadRecurring reads the recurring expenses matching a WHERE clause
+func (s *SQLStore) loadRecurring(ctx context.Context, q querier, where string, args ...any) ([]models.RecurringExpense, error) {
+	recurring := []models.RecurringExpense{}
+	err := s.scanRows(ctx, q, func(rows *sql.Rows) error {
+		var r models.RecurringExpense
+		var template string
+		var endDate, nextRun sql.NullTime
+		if err := rows.Scan(&r.GroupID, &r.ID, &template, &r.Frequency, &r.Interval, &r.StartDate,
+			&endDate, &nextRun, &r.CreatedBy, &r.CreatedAt); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(template), &r.Template); err != nil {
+			return err
+		}
+		if endDate.Valid {
+			r.EndDate = &endDate.Time
+		}
+		if nextRun.Valid {
+			r.NextRun = &nextRun.Time
+		}
+		recurring = append(recurring, r)
+		return nil
+	}, `SELECT `+recurringColumns+` FROM recurring_expenses `+where, args...)
+	return recurring, err
+}
+
+// nullTime converts an optional time to a nullable UTC column value
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.UTC(), Valid: true}
+}
@@ -0,0 +1,17 @@
+package store_test
+
+import (
+	"split-it/backend/store"
+	"testing"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	testStore(t, func(t *testing.T) store.Store {
+		s, err := store.OpenSQLite(":memory:")
+		if err != nil {
+			t.Fatalf("OpenSQLite: %v", err)
+		}
+		t.Cleanup(func() { s.Close() })
+		return s
+	})
+}
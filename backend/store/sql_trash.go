@@ -0,0 +1,165 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"split-it/backend/models"
+	"strconv"
+	"time"
+)
+
+// TrashExpense moves an expense into its group's trash
+func (s *SQLStore) TrashExpense(ctx context.Context, groupID, expenseID, deletedBy string, at time.Time) (models.TrashedExpense, error) {
+	var trashed models.TrashedExpense
+	err := s.mutate(ctx, groupID, func(tx *sql.Tx) error {
+		expenses, err := s.loadExpenses(ctx, tx, `WHERE group_id = ? AND id = ?`, groupID, expenseID)
+		if err != nil {
+			return err
+		}
+		if len(expenses) == 0 {
+			return ErrNotFound
+		}
+
+		trashed = models.TrashedExpense{GroupID: groupID, Expense: expenses[0], DeletedBy: deletedBy, DeletedAt: at}
+		expense, err := json.Marshal(trashed.Expense)
+		if err != nil {
+			return err
+		}
+
+		if _, err := s.exec(ctx, tx, `DELETE FROM trashed_expenses WHERE group_id = ? AND expense_id = ?`, groupID, expenseID); err != nil {
+			return err
+		}
+		_, err = s.exec(ctx, tx, `
+			INSERT INTO trashed_expenses (group_id, expense_id, expense, deleted_by, deleted_at)
+			VALUES (?, ?, ?, ?, ?)`,
+			groupID, expenseID, string(expense), deletedBy, at.UTC(),
+		)
+		if err != nil {
+			return sqlErr(err)
+		}
+
+		// Expense child rows go with their expense
+		_, err = s.exec(ctx, tx, `DELETE FROM expenses WHERE group_id = ? AND id = ?`, groupID, expenseID)
+		return err
+	})
+	return trashed, err
+}
+
+// ListTrashedExpenses returns a group's trashed expenses, most recently
+// deleted first
+func (s *SQLStore) ListTrashedExpenses(ctx context.Context, groupID string) ([]models.TrashedExpense, error) {
+	if err := s.groupExists(ctx, groupID); err != nil {
+		return nil, err
+	}
+	return s.loadTrashedExpenses(ctx, s.db, `WHERE group_id = ? ORDER BY deleted_at DESC, expense_id`, groupID)
+}
+
+// RestoreExpense moves an expense out of the trash and back into its group
+func (s *SQLStore) RestoreExpense(ctx context.Context, groupID, expenseID string) (models.Expense, error) {
+	var restored models.Expense
+	err := s.mutate(ctx, groupID, func(tx *sql.Tx) error {
+		trashed, err := s.loadTrashedExpenses(ctx, tx, `WHERE group_id = ? AND expense_id = ?`, groupID, expenseID)
+		if err != nil {
+			return err
+		}
+		if len(trashed) == 0 {
+			return ErrNotFound
+		}
+		restored = trashed[0].Expense
+
+		position, err := s.nextPosition(ctx, tx, "expenses", groupID)
+		if err != nil {
+			return err
+		}
+		if err := s.insertExpense(ctx, tx, groupID, position, restored); err != nil {
+			return err
+		}
+
+		_, err = s.exec(ctx, tx, `DELETE FROM trashed_expenses WHERE group_id = ? AND expense_id = ?`, groupID, expenseID)
+		return err
+	})
+	return restored, err
+}
+
+// ExpiredExpenses returns trashed expenses deleted before the given time
+func (s *SQLStore) ExpiredExpenses(ctx context.Context, before time.Time, limit int) ([]models.TrashedExpense, error) {
+	return s.loadTrashedExpenses(ctx, s.db,
+		`WHERE deleted_at < ? ORDER BY deleted_at, group_id, expense_id LIMIT `+strconv.Itoa(limit), before.UTC())
+}
+
+// PurgeExpense permanently deletes a trashed expense that was deleted
+// before the given time
+func (s *SQLStore) PurgeExpense(ctx context.Context, groupID, expenseID string, before time.Time) error {
+	result, err := s.exec(ctx, s.db, `
+		DELETE FROM trashed_expenses WHERE group_id = ? AND expense_id = ? AND deleted_at < ?`,
+		groupID, expenseID, before.UTC(),
+	)
+	return affected(result, err)
+}
+
+// TrashGroup moves a group into the trash
+func (s *SQLStore) TrashGroup(ctx context.Context, groupID, deletedBy string, at time.Time) error {
+	result, err := s.exec(ctx, s.db, `
+		UPDATE groups SET deleted_at = ?, deleted_by = ? WHERE id = ? AND deleted_at IS NULL`,
+		at.UTC(), deletedBy, groupID,
+	)
+	return affected(result, err)
+}
+
+// ListTrashedGroups returns the groups in the trash that a user owns, most
+// recently deleted first
+func (s *SQLStore) ListTrashedGroups(ctx context.Context, uid string) ([]models.Group, error) {
+	return s.loadGroups(ctx, `WHERE deleted_at IS NOT NULL AND user_id = ? ORDER BY deleted_at DESC, id`, uid)
+}
+
+// GetTrashedGroup finds a group in the trash by ID
+func (s *SQLStore) GetTrashedGroup(ctx context.Context, groupID string) (models.Group, error) {
+	group, err := s.loadGroup(ctx, s.db, groupID)
+	if err == nil && group.DeletedAt == nil {
+		return models.Group{}, ErrNotFound
+	}
+	return group, err
+}
+
+// RestoreGroup moves a group out of the trash
+func (s *SQLStore) RestoreGroup(ctx context.Context, groupID string) (models.Group, error) {
+	result, err := s.exec(ctx, s.db, `
+		UPDATE groups SET deleted_at = NULL, deleted_by = '' WHERE id = ? AND deleted_at IS NOT NULL`, groupID)
+	if err := affected(result, err); err != nil {
+		return models.Group{}, err
+	}
+	return s.loadGroup(ctx, s.db, groupID)
+}
+
+// ExpiredGroups returns groups in the trash deleted before the given time
+func (s *SQLStore) ExpiredGroups(ctx context.Context, before time.Time, limit int) ([]models.Group, error) {
+	return s.loadGroups(ctx, `WHERE deleted_at < ? ORDER BY deleted_at, id LIMIT `+strconv.Itoa(limit), before.UTC())
+}
+
+// PurgeGroup permanently deletes a group in the trash that was deleted
+// before the given time, along with everything in it
+func (s *SQLStore) PurgeGroup(ctx context.Context, groupID string, before time.Time) error {
+	result, err := s.exec(ctx, s.db, `DELETE FROM groups WHERE id = ? AND deleted_at < ?`, groupID, before.UTC())
+	return affected(result, err)
+}
+
+// loadTrashedExpenses reads the trashed expenses selected by a WHERE clause
+// (which may carry ORDER BY and LIMIT)
+func (s *SQLStore) loadTrashedExpenses(ctx context.Context, q querier, where string, args ...any) ([]models.TrashedExpense, error) {
+	trashed := []models.TrashedExpense{}
+	err := s.scanRows(ctx, q, func(rows *sql.Rows) error {
+		var t models.TrashedExpense
+		var expense string
+		if err := rows.Scan(&t.GroupID, &expense, &t.DeletedBy, &t.DeletedAt); err != nil {
+			return err
+		}
+		if err := json.Unmarshal([]byte(expense), &t.Expense); err != nil {
+			return err
+		}
+		t.Expense.GroupID = t.GroupID
+		trashed = append(trashed, t)
+		return nil
+	}, `SELECT group_id, expense, deleted_by, deleted_at FROM trashed_expenses `+where, args...)
+	return trashed, err
+}
@@ -0,0 +1,217 @@
+// Package store defines the persistence interfaces used by the API routes,
+// along with MongoDB and SQL (SQLite and PostgreSQL) implementations and an
+// in-memory implementation for tests and local development.
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"split-it/backend/config"
+	"split-it/backend/models"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when the requested record doesn't exist
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned when a write loses a race, e.g. the group's
+	// version changed or a member was linked by someone else
+	ErrConflict = errors.New("conflict")
+	// ErrDuplicate is returned when creating a record whose ID is taken
+	ErrDuplicate = errors.New("duplicate")
+	// ErrInviteUnavailable is returned when an invite has expired or run out of uses
+	ErrInviteUnavailable = errors.New("invite expired or used up")
+	// ErrInvalidCursor is returned when a page cursor can't be decoded
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// UserStore persists user profiles, keyed by Firebase UID
+type UserStore interface {
+	GetUser(ctx context.Context, firebaseUID string) (models.User, error)
+	CreateUser(ctx context.Context, user models.User) error
+	UpdateUser(ctx context.Context, firebaseUID, name, phone string) (models.User, error)
+}
+
+// GroupStore persists groups along with their members, expenses and
+// payments. Access control is left to the caller; every mutation bumps the
+// group's version and updatedAt.
+//
+// Expenses are stored apart from their group, so groups are returned
+// without them; use GroupExpenses or ListExpenses to read them.
+//
+// Groups in the trash are left out of ListGroups and GetGroup; TrashStore
+// finds them.
+type GroupStore interface {
+	// ListGroups returns a page of the groups a user owns or is a linked
+	// member of, newest first
+	ListGroups(ctx context.Context, uid string, query GroupQuery) (GroupPage, error)
+	GetGroup(ctx context.Context, groupID string) (models.Group, error)
+	// CreateGroup inserts a group along with any expenses it holds. It
+	// returns ErrDuplicate if the group's ID is taken, even by a group in the
+	// trash.
+	CreateGroup(ctx context.Context, group models.Group) error
+	// UpdateGroup replaces the name, currency, categories and members of a
+	// group, and its expenses when group.Expenses is non-nil, as long as its
+	// stored version still equals group.Version. The expense IDs must be
+	// unique.
+	UpdateGroup(ctx context.Context, group models.Group) (models.Group, error)
+	// DeleteGroup permanently removes a group along with everything in it
+	DeleteGroup(ctx context.Context, groupID string) error
+
+	// GroupExpenses returns every expense in a group, oldest first
+	GroupExpenses(ctx context.Context, groupID string) ([]models.Expense, error)
+	// ListExpenses returns one page of the group's expenses that match the
+	// query, in the order it asks for
+	ListExpenses(ctx context.Context, groupID string, query ExpenseQuery) (ExpensePage, error)
+	GetExpense(ctx context.Context, groupID, expenseID string) (models.Expense, error)
+	// ExpenseTotals counts and sums the expenses of each of the given groups.
+	// Groups without expenses are missing from the result.
+	ExpenseTotals(ctx context.Context, groupIDs []string) (map[string]ExpenseTotal, error)
+	// AddExpense returns ErrDuplicate if the group has an expense with the
+	// same ID
+	AddExpense(ctx context.Context, groupID string, expense models.Expense) error
+	// UpdateExpense replaces an expense in place, keeping its date and
+	// attachments
+	UpdateExpense(ctx context.Context, groupID string, expense models.Expense) (models.Expense, error)
+	DeleteExpense(ctx context.Context, groupID, expenseID string) error
+	// AddAttachment records a file attached to an expense
+	AddAttachment(ctx context.Context, groupID, expenseID string, attachment models.Attachment) error
+	RemoveAttachment(ctx context.Context, groupID, expenseID, attachmentID string) error
+
+	// AddPayment appends a payment to a group. It returns ErrDuplicate if
+	// the group has a payment with the same ID.
+	AddPayment(ctx context.Context, groupID string, payment models.Payment) error
+	// DeletePayment returns ErrNotFound if the group or payment doesn't exist
+	DeletePayment(ctx context.Context, groupID, paymentID string) error
+
+	// AddMember returns ErrDuplicate if the member's user is already linked
+	// to a member of the group
+	AddMember(ctx context.Context, groupID string, member models.Member) (models.Group, error)
+	// LinkMember links an unlinked placeholder member to a user account. A
+	// user can be linked to at most one member of a group.
+	LinkMember(ctx context.Context, groupID, memberID, uid string, role models.Role) (models.Group, error)
+	SetMemberRole(ctx context.Context, groupID, memberID string, role models.Role) (models.Group, error)
+	RemoveMember(ctx context.Context, groupID, memberID string) error
+}
+
+// InviteStore persists group invitations, keyed by token
+type InviteStore interface {
+	CreateInvite(ctx context.Context, invite models.Invite) error
+	GetInvite(ctx context.Context, token string) (models.Invite, error)
+	// RedeemInvite uses up one redemption of a valid invite
+	RedeemInvite(ctx context.Context, token string) error
+	// ReleaseInvite gives back a redemption that wasn't used
+	ReleaseInvite(ctx context.Context, token string) error
+}
+
+// RecurringStore persists recurring expenses. They are deleted along with
+// their group.
+type RecurringStore interface {
+	// ListRecurring returns a group's recurring expenses, oldest first
+	ListRecurring(ctx context.Context, groupID string) ([]models.RecurringExpense, error)
+	GetRecurring(ctx context.Context, groupID, id string) (models.RecurringExpense, error)
+	CreateRecurring(ctx context.Context, recurring models.RecurringExpense) error
+	// UpdateRecurring replaces the template and schedule of a recurring
+	// expense, keeping its creator and creation time
+	UpdateRecurring(ctx context.Context, recurring models.RecurringExpense) (models.RecurringExpense, error)
+	DeleteRecurring(ctx context.Context, groupID, id string) error
+
+	// DueRecurring returns up to limit recurring expenses, across all
+	// groups, whose next run is at or before now, earliest first
+	DueRecurring(ctx context.Context, now time.Time, limit int) ([]models.RecurringExpense, error)
+	// AdvanceRecurring moves a recurring expense whose next run is due on
+	// to next, or ends it when next is nil. It returns ErrConflict if the
+	// next run is no longer due, because another scheduler got there first
+	// or the schedule was edited.
+	AdvanceRecurring(ctx context.Context, groupID, id string, due time.Time, next *time.Time) error
+}
+
+// ActivityStore persists the activity logs of groups. Entries are only
+// ever added; they are deleted along with their group.
+type ActivityStore interface {
+	// AddActivity appends an entry to its group's log
+	AddActivity(ctx context.Context, activity models.Activity) error
+	// ListActivity returns a page of a group's log, newest first
+	ListActivity(ctx context.Context, groupID string, query ActivityQuery) (ActivityPage, error)
+}
+
+// TrashStore keeps deleted groups and expenses, so they can be restored
+// until they have been in the trash long enough to be purged. A trashed
+// group keeps everything in it, and its ID stays taken.
+type TrashStore interface {
+	// TrashExpense moves an expense from its group into the group's trash.
+	// It replaces any expense with the same ID already in the trash.
+	TrashExpense(ctx context.Context, groupID, expenseID, deletedBy string, at time.Time) (models.TrashedExpense, error)
+	// ListTrashedExpenses returns the expenses in a group's trash, most
+	// recently deleted first
+	ListTrashedExpenses(ctx context.Context, groupID string) ([]models.TrashedExpense, error)
+	// RestoreExpense moves an expense out of the trash and back into its
+	// group. It returns ErrDuplicate if the group has an expense with the
+	// same ID.
+	RestoreExpense(ctx context.Context, groupID, expenseID string) (models.Expense, error)
+	// ExpiredExpenses returns up to limit trashed expenses, across all
+	// groups, that were deleted before the given time, earliest first
+	ExpiredExpenses(ctx context.Context, before time.Time, limit int) ([]models.TrashedExpense, error)
+	// PurgeExpense permanently deletes a trashed expense. It returns
+	// ErrNotFound unless the expense was deleted before the given time, so
+	// one that was restored and deleted again in the meantime is kept.
+	PurgeExpense(ctx context.Context, groupID, expenseID string, before time.Time) error
+
+	// TrashGroup moves a group into the trash
+	TrashGroup(ctx context.Context, groupID, deletedBy string, at time.Time) error
+	// ListTrashedGroups returns the groups in the trash that a user owns,
+	// most recently deleted first
+	ListTrashedGroups(ctx context.Context, uid string) ([]models.Group, error)
+	GetTrashedGroup(ctx context.Context, groupID string) (models.Group, error)
+	// RestoreGroup moves a group out of the trash
+	RestoreGroup(ctx context.Context, groupID string) (models.Group, error)
+	// ExpiredGroups returns up to limit groups in the trash that were
+	// deleted before the given time, earliest first
+	ExpiredGroups(ctx context.Context, before time.Time, limit int) ([]models.Group, error)
+	// PurgeGroup permanently deletes a group in the trash along with
+	// everything in it. It returns ErrNotFound unless the group was deleted
+	// before the given time.
+	PurgeGroup(ctx context.Context, groupID string, before time.Time) error
+}
+
+// Store bundles every store the API needs
+type Store interface {
+	UserStore
+	GroupStore
+	InviteStore
+	RecurringStore
+	ActivityStore
+	TrashStore
+}
+
+// Open returns the store selected by the STORAGE_BACKEND environment
+// variable: "mongo" (the default), "sqlite", "postgres" or "memory".
+// SQLite uses the file at SQLITE_PATH and PostgreSQL connects to
+// DATABASE_URL.
+func Open() (Store, error) {
+	backend := os.Getenv("STORAGE_BACKEND")
+
+	switch backend {
+	case "", "mongo":
+		config.ConnectDB()
+		return NewMongoStore(config.GetDB()), nil
+	case "sqlite":
+		path := os.Getenv("SQLITE_PATH")
+		if path == "" {
+			path = "split-it.db"
+		}
+		return OpenSQLite(path)
+	case "postgres":
+		url := os.Getenv("DATABASE_URL")
+		if url == "" {
+			return nil, fmt.Errorf("DATABASE_URL environment variable is not set")
+		}
+		return OpenPostgres(url)
+	case "memory":
+		return NewMemoryStore(), nil
+	}
+
+	return nil, fmt.Errorf("unknown STORAGE_BACKEND %q", backend)
+}
@@ -0,0 +1,1131 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"split-it/backend/models"
+	"split-it/backend/money"
+	"split-it/backend/store"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, func(t *testing.T) store.Store {
+		return store.NewMemoryStore()
+	})
+}
+
+// testStore runs the behaviour every Store implementation has to share.
+// open returns an empty store for each subtest.
+
+func testStore(t *testing.T, open func(t *testing.T) store.Store) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s store.Store)
+	}{
+		{"Users", testUsers},
+		{"Groups", testGroups},
+		{"GroupVersions", testGroupVersions},
+		{"Payments", testPayments},
+		{"Members", testMembers},
+		{"Invites", testInvites},
+		{"Expenses", testExpenses},
+		{"GroupExpenses", testGroupExpenses},
+		{"ListExpenses", testListExpenses},
+		{"FilterExpenses", testFilterExpenses},
+		{"ListGroups", testListGroups},
+		{"ExpenseTotals", testExpenseTotals},
+		{"BaseAmounts", testBaseAmounts},
+		{"Categories", testCategories},
+		{"Recurring", testRecurring},
+		{"Attachments", testAttachments},
+		{"Activity", testActivity},
+		{"TrashedExpenses", testTrashedExpenses},
+		{"TrashedGroups", testTrashedGroups},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, open(t))
+		})
+	}
+}
+
+// day is a fixed time the tests count from. Times are kept to whole
+// seconds in UTC, which every backend stores exactly.
+var day = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func newGroup(id, owner string) models.Group {
+	return models.Group{
+		GroupID:  id,
+		Name:     "Group " + id,
+		Currency: "USD",
+		Members: []models.Member{
+			{ID: "m1", Name: "Alice", UserID: owner, Role: models.RoleOwner},
+			{ID: "m2", Name: "Bob"},
+		},
+		Payments:  []models.Payment{},
+		UserID:    owner,
+		Version:   1,
+		CreatedAt: day,
+		UpdatedAt: day,
+	}
+}
+
+func newExpense(id string, amount money.Amount, date time.Time) models.Expense {
+	return models.Expense{
+		ID:           id,
+		Description:  "Expense " + id,
+		Amount:       amount,
+		PaidBy:       "m1",
+		Participants: []string{"m1", "m2"},
+		Date:         date,
+	}
+}
+
+func createGroup(t *testing.T, s store.Store, group models.Group) {
+	t.Helper()
+	if err := s.CreateGroup(context.Background(), group); err != nil {
+		t.Fatalf("CreateGroup(%s): %v", group.GroupID, err)
+	}
+}
+
+func addExpense(t *testing.T, s store.Store, groupID string, expense models.Expense) {
+	t.Helper()
+	if err := s.AddExpense(context.Background(), groupID, expense); err != nil {
+		t.Fatalf("AddExpense(%s): %v", expense.ID, err)
+	}
+}
+
+func getGroup(t *testing.T, s store.Store, groupID string) models.Group {
+	t.Helper()
+	group, err := s.GetGroup(context.Background(), groupID)
+	if err != nil {
+		t.Fatalf("GetGroup(%s): %v", groupID, err)
+	}
+	return group
+}
+
+func wantErr(t *testing.T, what string, got, want error) {
+	t.Helper()
+	if !errors.Is(got, want) {
+		t.Errorf("%s: got error %v, want %v", what, got, want)
+	}
+}
+
+func expenseIDs(expenses []models.Expense) []string {
+	ids := make([]string, len(expenses))
+	for i, e := range expenses {
+		ids[i] = e.ID
+	}
+	return ids
+}
+
+func equalIDs(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func groupIDs(groups []models.Group) []string {
+	ids := make([]string, len(groups))
+	for i, g := range groups {
+		ids[i] = g.GroupID
+	}
+	return ids
+}
+
+func testUsers(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	_, err := s.GetUser(ctx, "u1")
+	wantErr(t, "GetUser before CreateUser", err, store.ErrNotFound)
+
+	user := models.User{FirebaseUID: "u1", Email: "alice@example.com", Name: "Alice", CreatedAt: day, UpdatedAt: day}
+	if err := s.CreateUser(ctx, user); err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	wantErr(t, "CreateUser twice", s.CreateUser(ctx, user), store.ErrDuplicate)
+
+	updated, err := s.UpdateUser(ctx, "u1", "Alice B", "555-0100")
+	if err != nil {
+		t.Fatalf("UpdateUser: %v", err)
+	}
+	if updated.Name != "Alice B" || updated.Phone != "555-0100" || updated.Email != user.Email {
+		t.Errorf("UpdateUser returned %+v", updated)
+	}
+
+	got, err := s.GetUser(ctx, "u1")
+	if err != nil {
+		t.Fatalf("GetUser: %v", err)
+	}
+	if got.Name != "Alice B" || got.Phone != "555-0100" {
+		t.Errorf("GetUser after UpdateUser returned %+v", got)
+	}
+
+	_, err = s.UpdateUser(ctx, "u2", "Nobody", "")
+	wantErr(t, "UpdateUser of a missing user", err, store.ErrNotFound)
+}
+
+func testGroups(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	_, err := s.GetGroup(ctx, "g1")
+	wantErr(t, "GetGroup before CreateGroup", err, store.ErrNotFound)
+
+	group := newGroup("g1", "u1")
+	createGroup(t, s, group)
+	wantErr(t, "CreateGroup with a taken ID", s.CreateGroup(ctx, newGroup("g1", "u2")), store.ErrDuplicate)
+
+	got := getGroup(t, s, "g1")
+	if got.Name != group.Name || got.Currency != "USD" || got.UserID != "u1" || got.Version != 1 {
+		t.Errorf("GetGroup returned %+v", got)
+	}
+	if len(got.Members) != 2 || got.Members[0].UserID != "u1" || got.Members[0].Role != models.RoleOwner {
+		t.Errorf("GetGroup returned members %+v", got.Members)
+	}
+
+	if err := s.DeleteGroup(ctx, "g1"); err != nil {
+		t.Fatalf("DeleteGroup: %v", err)
+	}
+	_, err = s.GetGroup(ctx, "g1")
+	wantErr(t, "GetGroup after DeleteGroup", err, store.ErrNotFound)
+	wantErr(t, "DeleteGroup twice", s.DeleteGroup(ctx, "g1"), store.ErrNotFound)
+
+	// The ID is free again once the group is gone
+	createGroup(t, s, newGroup("g1", "u1"))
+}
+
+func testGroupVersions(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	createGroup(t, s, newGroup("g1", "u1"))
+	addExpense(t, s, "g1", newExpense("e1", 1000, day))
+	addExpense(t, s, "g1", newExpense("e2", 2000, day.Add(time.Hour)))
+
+	// Every mutation moves the version on
+	group := getGroup(t, s, "g1")
+	if group.Version != 3 {
+		t.Fatalf("version after two expenses = %d, want 3", group.Version)
+	}
+
+	update := group
+	update.Name = "Renamed"
+	update.Members = append(update.Members, models.Member{ID: "m3", Name: "Carol"})
+	updated, err := s.UpdateGroup(ctx, update)
+	if err != nil {
+		t.Fatalf("UpdateGroup: %v", err)
+	}
+	if updated.Version != 4 || updated.Name != "Renamed" || len(updated.Members) != 3 {
+		t.Errorf("UpdateGroup returned version %d, name %q and %d members", updated.Version, updated.Name, len(updated.Members))
+	}
+
+	// A stale version loses
+	update.Name = "Stale"
+	_, err = s.UpdateGroup(ctx, update)
+	wantErr(t, "UpdateGroup with a stale version", err, store.ErrConflict)
+	if got := getGroup(t, s, "g1"); got.Name != "Renamed" || got.Version != 4 {
+		t.Errorf("stale UpdateGroup changed the group to %q, version %d", got.Name, got.Version)
+	}
+
+	_, err = s.UpdateGroup(ctx, newGroup("missing", "u1"))
+	wantErr(t, "UpdateGroup of a missing group", err, store.ErrNotFound)
+}
+
+func testPayments(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	createGroup(t, s, newGroup("g1", "u1"))
+
+	payment := models.Payment{ID: "p1", From: "m2", To: "m1", Amount: 1500, Note: "Cash", Date: day}
+	if err := s.AddPayment(ctx, "g1", payment); err != nil {
+		t.Fatalf("AddPayment: %v", err)
+	}
+	wantErr(t, "AddPayment with a taken ID", s.AddPayment(ctx, "g1", payment), store.ErrDuplicate)
+	wantErr(t, "AddPayment to a missing group", s.AddPayment(ctx, "missing", payment), store.ErrNotFound)
+
+	group := getGroup(t, s, "g1")
+	if len(group.Payments) != 1 || group.Payments[0] != payment {
+		t.Errorf("payments = %+v, want %+v", group.Payments, payment)
+	}
+	if group.Version != 2 {
+		t.Errorf("version after AddPayment = %d, want 2", group.Version)
+	}
+
+	if err := s.DeletePayment(ctx, "g1", "p1"); err != nil {
+		t.Fatalf("DeletePayment: %v", err)
+	}
+	wantErr(t, "DeletePayment twice", s.DeletePayment(ctx, "g1", "p1"), store.ErrNotFound)
+	wantErr(t, "DeletePayment in a missing group", s.DeletePayment(ctx, "missing", "p1"), store.ErrNotFound)
+
+	// Failed deletes leave the version alone
+	if group := getGroup(t, s, "g1"); len(group.Payments) != 0 || group.Version != 3 {
+		t.Errorf("after DeletePayment: %d payments, version %d; want none and 3", len(group.Payments), group.Version)
+	}
+}
+
+func testMembers(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	createGroup(t, s, newGroup("g1", "u1"))
+
+	group, err := s.AddMember(ctx, "g1", models.Member{ID: "m3", Name: "Carol", UserID: "u3", Role: models.RoleViewer})
+	if err != nil {
+		t.Fatalf("AddMember: %v", err)
+	}
+	if len(group.Members) != 3 || group.RoleOf("u3") != models.RoleViewer {
+		t.Errorf("AddMember returned members %+v", group.Members)
+	}
+	_, err = s.AddMember(ctx, "g1", models.Member{ID: "m4", Name: "Dan", UserID: "u3"})
+	wantErr(t, "AddMember of a linked user", err, store.ErrDuplicate)
+	// Any number of members can be unlinked
+	if _, err := s.AddMember(ctx, "g1", models.Member{ID: "m4", Name: "Dan"}); err != nil {
+		t.Fatalf("AddMember of a placeholder: %v", err)
+	}
+
+	group, err = s.LinkMember(ctx, "g1", "m2", "u2", models.RoleMember)
+	if err != nil {
+		t.Fatalf("LinkMember: %v", err)
+	}
+	if group.RoleOf("u2") != models.RoleMember {
+		t.Errorf("linked member has role %q, want member", group.RoleOf("u2"))
+	}
+	_, err = s.LinkMember(ctx, "g1", "m2", "u4", models.RoleMember)
+	wantErr(t, "LinkMember of a linked member", err, store.ErrConflict)
+	_, err = s.LinkMember(ctx, "g1", "m4", "u3", models.RoleMember)
+	wantErr(t, "LinkMember of a linked user", err, store.ErrDuplicate)
+
+	group, err = s.SetMemberRole(ctx, "g1", "m2", models.RoleAdmin)
+	if err != nil {
+		t.Fatalf("SetMemberRole: %v", err)
+	}
+	if group.RoleOf("u2") != models.RoleAdmin {
+		t.Errorf("role after SetMemberRole = %q, want admin", group.RoleOf("u2"))
+	}
+	_, err = s.SetMemberRole(ctx, "g1", "missing", models.RoleAdmin)
+	wantErr(t, "SetMemberRole of a missing member", err, store.ErrNotFound)
+
+	if err := s.RemoveMember(ctx, "g1", "m3"); err != nil {
+		t.Fatalf("RemoveMember: %v", err)
+	}
+	group = getGroup(t, s, "g1")
+	if len(group.Members) != 3 || group.RoleOf("u3") != "" {
+		t.Errorf("members after RemoveMember = %+v", group.Members)
+	}
+	if group.Version != 6 {
+		t.Errorf("version after five member changes = %d, want 6", group.Version)
+	}
+}
+
+func testInvites(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	createGroup(t, s, newGroup("g1", "u1"))
+
+	invite := models.Invite{Token: "t1", GroupID: "g1", MemberID: "m2", Role: models.RoleMember, CreatedBy: "u1", MaxUses: 2, ExpiresAt: time.Now().Add(time.Hour).Truncate(time.Second), CreatedAt: day}
+	if err := s.CreateInvite(ctx, invite); err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	wantErr(t, "CreateInvite with a taken token", s.CreateInvite(ctx, invite), store.ErrDuplicate)
+
+	got, err := s.GetInvite(ctx, "t1")
+	if err != nil {
+		t.Fatalf("GetInvite: %v", err)
+	}
+	if got.GroupID != "g1" || got.MemberID != "m2" || got.Role != models.RoleMember || got.MaxUses != 2 || !got.ExpiresAt.Equal(invite.ExpiresAt) {
+		t.Errorf("GetInvite returned %+v", got)
+	}
+	_, err = s.GetInvite(ctx, "missing")
+	wantErr(t, "GetInvite of a missing token", err, store.ErrNotFound)
+
+	// Two uses, then it's used up until one is given back
+	for i := 0; i < 2; i++ {
+		if err := s.RedeemInvite(ctx, "t1"); err != nil {
+			t.Fatalf("RedeemInvite %d: %v", i+1, err)
+		}
+	}
+	wantErr(t, "RedeemInvite once used up", s.RedeemInvite(ctx, "t1"), store.ErrInviteUnavailable)
+	if err := s.ReleaseInvite(ctx, "t1"); err != nil {
+		t.Fatalf("ReleaseInvite: %v", err)
+	}
+	if err := s.RedeemInvite(ctx, "t1"); err != nil {
+		t.Errorf("RedeemInvite after ReleaseInvite: %v", err)
+	}
+
+	expired := invite
+	expired.Token = "t2"
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	if err := s.CreateInvite(ctx, expired); err != nil {
+		t.Fatalf("CreateInvite: %v", err)
+	}
+	wantErr(t, "RedeemInvite when expired", s.RedeemInvite(ctx, "t2"), store.ErrInviteUnavailable)
+}
+
+func testExpenses(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	createGroup(t, s, newGroup("g1", "u1"))
+	createGroup(t, s, newGroup("g2", "u1"))
+
+	// Added out of order, listed oldest first
+	addExpense(t, s, "g1", newExpense("e2", 2000, day.Add(time.Hour)))
+	addExpense(t, s, "g1", newExpense("e1", 1000, day))
+	addExpense(t, s, "g1", newExpense("e3", 3000, day.Add(2*time.Hour)))
+
+	wantErr(t, "AddExpense with a taken ID", s.AddExpense(ctx, "g1", newExpense("e1", 5, day)), store.ErrDuplicate)
+	wantErr(t, "AddExpense to a missing group", s.AddExpense(ctx, "missing", newExpense("e1", 5, day)), store.ErrNotFound)
+
+	// IDs only have to be unique within a group
+	addExpense(t, s, "g2", newExpense("e1", 700, day))
+
+	expenses, err := s.GroupExpenses(ctx, "g1")
+	if err != nil {
+		t.Fatalf("GroupExpenses: %v", err)
+	}
+	if !equalIDs(expenseIDs(expenses), []string{"e1", "e2", "e3"}) {
+		t.Errorf("GroupExpenses = %v, want [e1 e2 e3]", expenseIDs(expenses))
+	}
+	if group := getGroup(t, s, "g1"); len(group.Expenses) != 0 {
+		t.Errorf("GetGroup returned %d expenses, want them left out", len(group.Expenses))
+	}
+
+	got, err := s.GetExpense(ctx, "g1", "e1")
+	if err != nil {
+		t.Fatalf("GetExpense: %v", err)
+	}
+	if got.Amount != 1000 || got.PaidBy != "m1" || len(got.Participants) != 2 || !got.Date.Equal(day) {
+		t.Errorf("GetExpense returned %+v", got)
+	}
+	_, err = s.GetExpense(ctx, "g1", "missing")
+	wantErr(t, "GetExpense of a missing expense", err, store.ErrNotFound)
+
+	// Updating keeps the date
+	edit := newExpense("e1", 1200, day.Add(48*time.Hour))
+	edit.Description = "Edited"
+	updated, err := s.UpdateExpense(ctx, "g1", edit)
+	if err != nil {
+		t.Fatalf("UpdateExpense: %v", err)
+	}
+	if updated.Description != "Edited" || updated.Amount != 1200 || !updated.Date.Equal(day) {
+		t.Errorf("UpdateExpense returned %+v", updated)
+	}
+	got, err = s.GetExpense(ctx, "g1", "e1")
+	if err != nil {
+		t.Fatalf("GetExpense: %v", err)
+	}
+	if got.Description != "Edited" || !got.Date.Equal(day) {
+		t.Errorf("GetExpense after UpdateExpense returned %+v", got)
+	}
+	_, err = s.UpdateExpense(ctx, "g1", newExpense("missing", 100, day))
+	wantErr(t, "UpdateExpense of a missing expense", err, store.ErrNotFound)
+
+	before := getGroup(t, s, "g1").Version
+	if err := s.DeleteExpense(ctx, "g1", "e2"); err != nil {
+		t.Fatalf("DeleteExpense: %v", err)
+	}
+	_, err = s.GetExpense(ctx, "g1", "e2")
+	wantErr(t, "GetExpense after DeleteExpense", err, store.ErrNotFound)
+	if after := getGroup(t, s, "g1").Version; after != before+1 {
+		t.Errorf("DeleteExpense moved the version from %d to %d", before, after)
+	}
+}
+
+func testGroupExpenses(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	// Expenses given to CreateGroup are stored with the group
+	group := newGroup("g1", "u1")
+	group.Expenses = []models.Expense{newExpense("e1", 1000, day), newExpense("e2", 2000, day.Add(time.Hour))}
+	createGroup(t, s, group)
+
+	// Without expenses, UpdateGroup keeps the stored ones
+	update := getGroup(t, s, "g1")
+	update.Name = "Renamed"
+	if _, err := s.UpdateGroup(ctx, update); err != nil {
+		t.Fatalf("UpdateGroup: %v", err)
+	}
+	expenses, err := s.GroupExpenses(ctx, "g1")
+	if err != nil {
+		t.Fatalf("GroupExpenses: %v", err)
+	}
+	if !equalIDs(expenseIDs(expenses), []string{"e1", "e2"}) {
+		t.Errorf("expenses after UpdateGroup without expenses = %v, want [e1 e2]", expenseIDs(expenses))
+	}
+
+	// Given expenses replace the stored ones
+	update = getGroup(t, s, "g1")
+	update.Expenses = []models.Expense{newExpense("e2", 2500, day.Add(time.Hour)), newExpense("e3", 3000, day.Add(2*time.Hour))}
+	if _, err := s.UpdateGroup(ctx, update); err != nil {
+		t.Fatalf("UpdateGroup with expenses: %v", err)
+	}
+	expenses, err = s.GroupExpenses(ctx, "g1")
+	if err != nil {
+		t.Fatalf("GroupExpenses: %v", err)
+	}
+	if !equalIDs(expenseIDs(expenses), []string{"e2", "e3"}) {
+		t.Fatalf("expenses after UpdateGroup = %v, want [e2 e3]", expenseIDs(expenses))
+	}
+	if expenses[0].Amount != 2500 {
+		t.Errorf("replaced expense has amount %v, want 25.00", expenses[0].Amount)
+	}
+
+	// A stale update leaves the expenses alone
+	update.Expenses = []models.Expense{newExpense("e4", 4000, day)}
+	_, err = s.UpdateGroup(ctx, update)
+	wantErr(t, "UpdateGroup with a stale version", err, store.ErrConflict)
+	if expenses, err := s.GroupExpenses(ctx, "g1"); err != nil || !equalIDs(expenseIDs(expenses), []string{"e2", "e3"}) {
+		t.Errorf("expenses after a stale UpdateGroup = %v, %v", expenseIDs(expenses), err)
+	}
+
+	// Expenses go with their group
+	if err := s.DeleteGroup(ctx, "g1"); err != nil {
+		t.Fatalf("DeleteGroup: %v", err)
+	}
+	_, err = s.GroupExpenses(ctx, "g1")
+	wantErr(t, "GroupExpenses after DeleteGroup", err, store.ErrNotFound)
+	createGroup(t, s, newGroup("g1", "u1"))
+	if expenses, err := s.GroupExpenses(ctx, "g1"); err != nil || len(expenses) != 0 {
+		t.Errorf("expenses of a new group with a deleted one's ID = %v, %v", expenseIDs(expenses), err)
+	}
+}
+
+func testListExpenses(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	createGroup(t, s, newGroup("g1", "u1"))
+
+	// Two share a date, so the ID breaks the tie
+	for i := 0; i < 5; i++ {
+		addExpense(t, s, "g1", newExpense(string(rune('a'+i)), 1000, day.Add(time.Duration(i/2)*time.Hour)))
+	}
+
+	// Newest first, two at a time
+	var ids []string
+	cursor := ""
+	for pages := 0; pages < 6; pages++ {
+		page, err := s.ListExpenses(ctx, "g1", store.ExpenseQuery{Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("ListExpenses: %v", err)
+		}
+		ids = append(ids, expenseIDs(page.Expenses)...)
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if !equalIDs(ids, []string{"e", "d", "c", "b", "a"}) {
+		t.Errorf("paging newest first = %v, want [e d c b a]", ids)
+	}
+
+	_, err := s.ListExpenses(ctx, "g1", store.ExpenseQuery{Limit: 2, Cursor: "not a cursor"})
+	wantErr(t, "ListExpenses with a bad cursor", err, store.ErrInvalidCursor)
+	_, err = s.ListExpenses(ctx, "missing", store.ExpenseQuery{Limit: 2})
+	wantErr(t, "ListExpenses of a missing group", err, store.ErrNotFound)
+}
+
+func testFilterExpenses(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	createGroup(t, s, newGroup("g1", "u1"))
+
+	for i, amount := range []money.Amount{3000, 1000, 5000, 2000, 4000} {
+		e := newExpense(string(rune('a'+i)), amount, day.Add(time.Duration(i)*time.Hour))
+		if i%2 == 1 {
+			e.PaidBy = "m2"
+			e.Description = "Dinner"
+		}
+		addExpense(t, s, "g1", e)
+	}
+	// Amounts are compared in the base currency: 90.00 in this currency
+	// is 15.00 in the group's
+	foreign := newExpense("f", 9000, day.Add(5*time.Hour))
+	foreign.Currency = "JPY"
+	foreign.ExchangeRate = 0.1667
+	foreign.BaseAmount = 1500
+	addExpense(t, s, "g1", foreign)
+
+	list := func(query store.ExpenseQuery) []string {
+		t.Helper()
+		query.Limit = 10
+		page, err := s.ListExpenses(ctx, "g1", query)
+		if err != nil {
+			t.Fatalf("ListExpenses(%+v): %v", query, err)
+		}
+		return expenseIDs(page.Expenses)
+	}
+
+	if got := list(store.ExpenseQuery{Sort: store.SortLargest}); !equalIDs(got, []string{"c", "e", "a", "d", "f", "b"}) {
+		t.Errorf("largest first = %v, want [c e a d f b]", got)
+	}
+	if got := list(store.ExpenseQuery{Sort: store.SortOldest}); !equalIDs(got, []string{"a", "b", "c", "d", "e", "f"}) {
+		t.Errorf("oldest first = %v, want [a b c d e f]", got)
+	}
+	if got := list(store.ExpenseQuery{PaidBy: "m2"}); !equalIDs(got, []string{"d", "b"}) {
+		t.Errorf("paid by m2 = %v, want [d b]", got)
+	}
+	if got := list(store.ExpenseQuery{Participant: "m3"}); len(got) != 0 {
+		t.Errorf("shared with a stranger = %v, want none", got)
+	}
+	if got := list(store.ExpenseQuery{Search: "dinner"}); !equalIDs(got, []string{"d", "b"}) {
+		t.Errorf("matching dinner = %v, want [d b]", got)
+	}
+
+	// From is inclusive and To exclusive
+	from, to := day.Add(time.Hour), day.Add(3*time.Hour)
+	if got := list(store.ExpenseQuery{From: from, To: to}); !equalIDs(got, []string{"c", "b"}) {
+		t.Errorf("from hour 1 to hour 3 = %v, want [c b]", got)
+	}
+
+	min, max := money.Amount(2000), money.Amount(4000)
+	if got := list(store.ExpenseQuery{Sort: store.SortSmallest, MinAmount: &min, MaxAmount: &max}); !equalIDs(got, []string{"d", "a", "e"}) {
+		t.Errorf("between 20.00 and 40.00 = %v, want [d a e]", got)
+	}
+	min, max = money.Amount(1000), money.Amount(1500)
+	if got := list(store.ExpenseQuery{Sort: store.SortSmallest, MinAmount: &min, MaxAmount: &max}); !equalIDs(got, []string{"b", "f"}) {
+		t.Errorf("between 10.00 and 15.00 = %v, want [b f]", got)
+	}
+
+	// Sorting by amount pages like sorting by date
+	var ids []string
+	cursor := ""
+	for pages := 0; pages < 6; pages++ {
+		page, err := s.ListExpenses(ctx, "g1", store.ExpenseQuery{Limit: 2, Sort: store.SortSmallest, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("ListExpenses: %v", err)
+		}
+		ids = append(ids, expenseIDs(page.Expenses)...)
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if !equalIDs(ids, []string{"b", "f", "d", "a", "e", "c"}) {
+		t.Errorf("paging smallest first = %v, want [b f d a e c]", ids)
+	}
+}
+
+func testListGroups(t *testing.T, s store.Store) {
+	ctx := context.Background()
+
+	for i, id := range []string{"g1", "g2", "g3"} {
+		group := newGroup(id, "u1")
+		group.CreatedAt = day.Add(time.Duration(i) * time.Hour)
+		createGroup(t, s, group)
+	}
+
+	// Linked members see the group too; placeholders and strangers don't
+	other := newGroup("g4", "u2")
+	other.CreatedAt = day.Add(3 * time.Hour)
+	other.Members = append(other.Members, models.Member{ID: "m3", Name: "Alice", UserID: "u1", Role: models.RoleMember})
+	createGroup(t, s, other)
+	createGroup(t, s, newGroup("g5", "u2"))
+
+	page, err := s.ListGroups(ctx, "u1", store.GroupQuery{Limit: 3})
+	if err != nil {
+		t.Fatalf("ListGroups: %v", err)
+	}
+	if !equalIDs(groupIDs(page.Groups), []string{"g4", "g3", "g2"}) || page.NextCursor == "" {
+		t.Fatalf("first page = %v, cursor %q; want [g4 g3 g2] and a cursor", groupIDs(page.Groups), page.NextCursor)
+	}
+
+	page, err = s.ListGroups(ctx, "u1", store.GroupQuery{Limit: 3, Cursor: page.NextCursor})
+	if err != nil {
+		t.Fatalf("ListGroups with cursor: %v", err)
+	}
+	if !equalIDs(groupIDs(page.Groups), []string{"g1"}) || page.NextCursor != "" {
+		t.Errorf("second page = %v, cursor %q; want [g1] and no cursor", groupIDs(page.Groups), page.NextCursor)
+	}
+
+	page, err = s.ListGroups(ctx, "u3", store.GroupQuery{Limit: 3})
+	if err != nil {
+		t.Fatalf("ListGroups for a stranger: %v", err)
+	}
+	if len(page.Groups) != 0 {
+		t.Errorf("stranger sees %v", groupIDs(page.Groups))
+	}
+
+	_, err = s.ListGroups(ctx, "u1", store.GroupQuery{Limit: 3, Cursor: "not a cursor"})
+	wantErr(t, "ListGroups with a bad cursor", err, store.ErrInvalidCursor)
+}
+
+func testExpenseTotals(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	createGroup(t, s, newGroup("g1", "u1"))
+	createGroup(t, s, newGroup("g2", "u1"))
+	createGroup(t, s, newGroup("g3", "u1"))
+	addExpense(t, s, "g1", newExpense("e1", 1000, day))
+	addExpense(t, s, "g1", newExpense("e2", 2000, day))
+	addExpense(t, s, "g2", newExpense("e1", 700, day))
+
+	totals, err := s.ExpenseTotals(ctx, []string{"g1", "g2", "g3", "missing"})
+	if err != nil {
+		t.Fatalf("ExpenseTotals: %v", err)
+	}
+	if totals["g1"].Count != 2 || totals["g1"].Total != 3000 {
+		t.Errorf("totals of g1 = %+v, want 2 expenses totalling 30.00", totals["g1"])
+	}
+	if totals["g2"].Count != 1 || totals["g2"].Total != 700 {
+		t.Errorf("totals of g2 = %+v, want 1 expense totalling 7.00", totals["g2"])
+	}
+	if totals["g3"].Count != 0 || totals["g3"].Total != 0 {
+		t.Errorf("totals of a group without expenses = %+v", totals["g3"])
+	}
+	if _, ok := totals["missing"]; ok {
+		t.Errorf("totals include a missing group")
+	}
+}
+
+func testBaseAmounts(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	createGroup(t, s, newGroup("g1", "u1"))
+	addExpense(t, s, "g1", newExpense("e1", 1000, day))
+	foreign := newExpense("e2", 1000, day.Add(time.Hour))
+	foreign.Currency = "EUR"
+	foreign.ExchangeRate = 1.5
+	foreign.BaseAmount = 1500
+	addExpense(t, s, "g1", foreign)
+
+	got, err := s.GetExpense(ctx, "g1", "e2")
+	if err != nil {
+		t.Fatalf("GetExpense: %v", err)
+	}
+	if got.Currency != "EUR" || got.ExchangeRate != 1.5 || got.BaseAmount != 1500 || got.AmountInBase() != 1500 {
+		t.Errorf("GetExpense returned %+v", got)
+	}
+
+	// Totals are in the base currency
+	totals, err := s.ExpenseTotals(ctx, []string{"g1"})
+	if err != nil {
+		t.Fatalf("ExpenseTotals: %v", err)
+	}
+	if totals["g1"].Count != 2 || totals["g1"].Total != 2500 {
+		t.Errorf("totals = %+v, want 2 expenses totalling 25.00", totals["g1"])
+	}
+}
+
+func testCategories(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	group := newGroup("g1", "u1")
+	group.Categories = []string{"pets"}
+	createGroup(t, s, group)
+	if got := getGroup(t, s, "g1"); len(got.Categories) != 1 || got.Categories[0] != "pets" {
+		t.Errorf("GetGroup returned categories %v", got.Categories)
+	}
+
+	for i := 0; i < 4; i++ {
+		e := newExpense(string(rune('a'+i)), 1000, day.Add(time.Duration(i)*time.Hour))
+		if i%2 == 1 {
+			e.Category = "food"
+		}
+		if i >= 2 {
+			e.Tags = []string{"trip", "beach"}
+		}
+		addExpense(t, s, "g1", e)
+	}
+
+	got, err := s.GetExpense(ctx, "g1", "d")
+	if err != nil {
+		t.Fatalf("GetExpense: %v", err)
+	}
+	if got.Category != "food" || len(got.Tags) != 2 || got.Tags[0] != "trip" || got.Tags[1] != "beach" {
+		t.Errorf("GetExpense returned category %q and tags %v", got.Category, got.Tags)
+	}
+
+	list := func(query store.ExpenseQuery) []string {
+		t.Helper()
+		query.Limit = 10
+		page, err := s.ListExpenses(ctx, "g1", query)
+		if err != nil {
+			t.Fatalf("ListExpenses(%+v): %v", query, err)
+		}
+		return expenseIDs(page.Expenses)
+	}
+	if got := list(store.ExpenseQuery{Category: "food"}); !equalIDs(got, []string{"d", "b"}) {
+		t.Errorf("food = %v, want [d b]", got)
+	}
+	if got := list(store.ExpenseQuery{Tag: "beach"}); !equalIDs(got, []string{"d", "c"}) {
+		t.Errorf("tagged beach = %v, want [d c]", got)
+	}
+	if got := list(store.ExpenseQuery{Category: "food", Tag: "trip"}); !equalIDs(got, []string{"d"}) {
+		t.Errorf("food tagged trip = %v, want [d]", got)
+	}
+}
+
+func testRecurring(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	createGroup(t, s, newGroup("g1", "u1"))
+	createGroup(t, s, newGroup("g2", "u1"))
+
+	recurring := func(groupID, id string, next time.Time) models.RecurringExpense {
+		return models.RecurringExpense{
+			ID:        id,
+			GroupID:   groupID,
+			Template:  models.NewExpenseTemplate(newExpense("", 1000, time.Time{})),
+			Frequency: models.FrequencyDaily,
+			Interval:  1,
+			StartDate: day,
+			NextRun:   &next,
+			CreatedBy: "u1",
+			CreatedAt: day,
+		}
+	}
+
+	for _, r := range []models.RecurringExpense{
+		recurring("g1", "r1", day.Add(2*time.Hour)),
+		recurring("g1", "r2", day),
+		recurring("g2", "r1", day.Add(time.Hour)),
+		recurring("g2", "r3", day.Add(48*time.Hour)),
+	} {
+		if err := s.CreateRecurring(ctx, r); err != nil {
+			t.Fatalf("CreateRecurring(%s/%s): %v", r.GroupID, r.ID, err)
+		}
+	}
+	wantErr(t, "CreateRecurring with a taken ID", s.CreateRecurring(ctx, recurring("g1", "r1", day)), store.ErrDuplicate)
+	wantErr(t, "CreateRecurring in a missing group", s.CreateRecurring(ctx, recurring("missing", "r1", day)), store.ErrNotFound)
+
+	list, err := s.ListRecurring(ctx, "g1")
+	if err != nil {
+		t.Fatalf("ListRecurring: %v", err)
+	}
+	if len(list) != 2 || list[0].ID != "r1" || list[1].ID != "r2" {
+		t.Errorf("ListRecurring = %+v, want r1 and r2", list)
+	}
+
+	got, err := s.GetRecurring(ctx, "g1", "r1")
+	if err != nil {
+		t.Fatalf("GetRecurring: %v", err)
+	}
+	if got.Template.Amount != 1000 || got.Frequency != models.FrequencyDaily || !got.StartDate.Equal(day) || got.NextRun == nil || !got.NextRun.Equal(day.Add(2*time.Hour)) {
+		t.Errorf("GetRecurring returned %+v", got)
+	}
+
+	// Updating keeps the creator
+	edit := recurring("g1", "r1", day.Add(3*time.Hour))
+	edit.Template.Amount = 1500
+	edit.CreatedBy = "u2"
+	edit.CreatedAt = day.Add(time.Hour)
+	updated, err := s.UpdateRecurring(ctx, edit)
+	if err != nil {
+		t.Fatalf("UpdateRecurring: %v", err)
+	}
+	if updated.Template.Amount != 1500 || updated.CreatedBy != "u1" || !updated.CreatedAt.Equal(day) {
+		t.Errorf("UpdateRecurring returned %+v", updated)
+	}
+	_, err = s.UpdateRecurring(ctx, recurring("g1", "missing", day))
+	wantErr(t, "UpdateRecurring of a missing recurring expense", err, store.ErrNotFound)
+
+	// Due across groups, earliest first
+	due, err := s.DueRecurring(ctx, day.Add(3*time.Hour), 10)
+	if err != nil {
+		t.Fatalf("DueRecurring: %v", err)
+	}
+	var dueIDs []string
+	for _, r := range due {
+		dueIDs = append(dueIDs, r.GroupID+"/"+r.ID)
+	}
+	if !equalIDs(dueIDs, []string{"g1/r2", "g2/r1", "g1/r1"}) {
+		t.Errorf("DueRecurring = %v, want [g1/r2 g2/r1 g1/r1]", dueIDs)
+	}
+	if due, err := s.DueRecurring(ctx, day.Add(3*time.Hour), 1); err != nil || len(due) != 1 {
+		t.Errorf("DueRecurring with limit 1 returned %d, %v", len(due), err)
+	}
+
+	// Only the first to move a run on wins
+	next := day.Add(24 * time.Hour)
+	if err := s.AdvanceRecurring(ctx, "g1", "r2", day, &next); err != nil {
+		t.Fatalf("AdvanceRecurring: %v", err)
+	}
+	wantErr(t, "AdvanceRecurring from the same run twice", s.AdvanceRecurring(ctx, "g1", "r2", day, &next), store.ErrConflict)
+	wantErr(t, "AdvanceRecurring of a missing recurring expense", s.AdvanceRecurring(ctx, "g1", "missing", day, &next), store.ErrNotFound)
+	if got, err := s.GetRecurring(ctx, "g1", "r2"); err != nil || got.NextRun == nil || !got.NextRun.Equal(next) {
+		t.Errorf("after AdvanceRecurring: %+v, %v", got.NextRun, err)
+	}
+
+	// A nil next run ends the schedule
+	if err := s.AdvanceRecurring(ctx, "g1", "r2", next, nil); err != nil {
+		t.Fatalf("AdvanceRecurring to the end: %v", err)
+	}
+	if got, err := s.GetRecurring(ctx, "g1", "r2"); err != nil || got.NextRun != nil {
+		t.Errorf("ended schedule has next run %v, %v", got.NextRun, err)
+	}
+
+	if err := s.DeleteRecurring(ctx, "g1", "r1"); err != nil {
+		t.Fatalf("DeleteRecurring: %v", err)
+	}
+	wantErr(t, "DeleteRecurring twice", s.DeleteRecurring(ctx, "g1", "r1"), store.ErrNotFound)
+
+	// Recurring expenses go with their group
+	if err := s.DeleteGroup(ctx, "g2"); err != nil {
+		t.Fatalf("DeleteGroup: %v", err)
+	}
+	_, err = s.GetRecurring(ctx, "g2", "r1")
+	wantErr(t, "GetRecurring after DeleteGroup", err, store.ErrNotFound)
+}
+
+func testAttachments(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	createGroup(t, s, newGroup("g1", "u1"))
+	addExpense(t, s, "g1", newExpense("e1", 1000, day))
+
+	for _, id := range []string{"a1", "a2"} {
+		attachment := models.Attachment{ID: id, Filename: id + ".pdf", ContentType: "application/pdf", Size: 10, UploadedBy: "u1", UploadedAt: day}
+		if err := s.AddAttachment(ctx, "g1", "e1", attachment); err != nil {
+			t.Fatalf("AddAttachment(%s): %v", id, err)
+		}
+	}
+	wantErr(t, "AddAttachment to a missing expense", s.AddAttachment(ctx, "g1", "missing", models.Attachment{ID: "a3"}), store.ErrNotFound)
+
+	if err := s.RemoveAttachment(ctx, "g1", "e1", "a1"); err != nil {
+		t.Fatalf("RemoveAttachment: %v", err)
+	}
+	wantErr(t, "RemoveAttachment twice", s.RemoveAttachment(ctx, "g1", "e1", "a1"), store.ErrNotFound)
+
+	got, err := s.GetExpense(ctx, "g1", "e1")
+	if err != nil {
+		t.Fatalf("GetExpense: %v", err)
+	}
+	if len(got.Attachments) != 1 || got.Attachments[0].ID != "a2" || got.Attachments[0].Filename != "a2.pdf" || got.Attachments[0].Size != 10 {
+		t.Errorf("attachments = %+v, want a2 only", got.Attachments)
+	}
+
+	// Editing an expense keeps its attachments
+	edit := newExpense("e1", 1200, day)
+	if _, err := s.UpdateExpense(ctx, "g1", edit); err != nil {
+		t.Fatalf("UpdateExpense: %v", err)
+	}
+	got, err = s.GetExpense(ctx, "g1", "e1")
+	if err != nil {
+		t.Fatalf("GetExpense: %v", err)
+	}
+	if got.Amount != 1200 || len(got.Attachments) != 1 {
+		t.Errorf("after UpdateExpense: amount %v, attachments %+v", got.Amount, got.Attachments)
+	}
+}
+
+func testActivity(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	createGroup(t, s, newGroup("g1", "u1"))
+
+	expense := newExpense("e1", 1000, day)
+	for i := 0; i < 5; i++ {
+		activity := models.Activity{
+			ID:        string(rune('a' + i)),
+			GroupID:   "g1",
+			Actor:     "u1",
+			ActorName: "Alice",
+			Action:    models.ActivityExpenseAdded,
+			TargetID:  "e1",
+			After:     &models.ActivitySnapshot{Expense: &expense},
+			// Two entries share a time, so the ID breaks the tie
+			CreatedAt: day.Add(time.Duration(i/2) * time.Minute),
+		}
+		if err := s.AddActivity(ctx, activity); err != nil {
+			t.Fatalf("AddActivity(%s): %v", activity.ID, err)
+		}
+	}
+	wantErr(t, "AddActivity in a missing group", s.AddActivity(ctx, models.Activity{ID: "x", GroupID: "missing", CreatedAt: day}), store.ErrNotFound)
+
+	var ids []string
+	cursor := ""
+	for pages := 0; pages < 6; pages++ {
+		page, err := s.ListActivity(ctx, "g1", store.ActivityQuery{Limit: 2, Cursor: cursor})
+		if err != nil {
+			t.Fatalf("ListActivity: %v", err)
+		}
+		for _, a := range page.Activity {
+			ids = append(ids, a.ID)
+		}
+		if cursor = page.NextCursor; cursor == "" {
+			break
+		}
+	}
+	if !equalIDs(ids, []string{"e", "d", "c", "b", "a"}) {
+		t.Errorf("activity newest first = %v, want [e d c b a]", ids)
+	}
+
+	page, err := s.ListActivity(ctx, "g1", store.ActivityQuery{Limit: 1})
+	if err != nil {
+		t.Fatalf("ListActivity: %v", err)
+	}
+	a := page.Activity[0]
+	if a.Actor != "u1" || a.ActorName != "Alice" || a.Action != models.ActivityExpenseAdded || a.TargetID != "e1" || a.Before != nil {
+		t.Errorf("ListActivity returned %+v", a)
+	}
+	if a.After == nil || a.After.Expense == nil || a.After.Expense.ID != "e1" || a.After.Expense.Amount != 1000 {
+		t.Errorf("snapshot after = %+v, want expense e1", a.After)
+	}
+
+	_, err = s.ListActivity(ctx, "g1", store.ActivityQuery{Limit: 2, Cursor: "not a cursor"})
+	wantErr(t, "ListActivity with a bad cursor", err, store.ErrInvalidCursor)
+	_, err = s.ListActivity(ctx, "missing", store.ActivityQuery{Limit: 2})
+	wantErr(t, "ListActivity of a missing group", err, store.ErrNotFound)
+}
+
+func testTrashedExpenses(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	createGroup(t, s, newGroup("g1", "u1"))
+	addExpense(t, s, "g1", newExpense("e1", 1000, day))
+	addExpense(t, s, "g1", newExpense("e2", 2000, day))
+	attachment := models.Attachment{ID: "a1", Filename: "receipt.png", ContentType: "image/png", Size: 3, UploadedBy: "u1", UploadedAt: day}
+	if err := s.AddAttachment(ctx, "g1", "e1", attachment); err != nil {
+		t.Fatalf("AddAttachment: %v", err)
+	}
+
+	trashed, err := s.TrashExpense(ctx, "g1", "e1", "u2", day)
+	if err != nil {
+		t.Fatalf("TrashExpense: %v", err)
+	}
+	if trashed.Expense.ID != "e1" || trashed.DeletedBy != "u2" || !trashed.DeletedAt.Equal(day) || len(trashed.Expense.Attachments) != 1 {
+		t.Errorf("TrashExpense returned %+v", trashed)
+	}
+	if _, err := s.TrashExpense(ctx, "g1", "e2", "u1", day.Add(time.Hour)); err != nil {
+		t.Fatalf("TrashExpense: %v", err)
+	}
+	_, err = s.TrashExpense(ctx, "g1", "e1", "u2", day)
+	wantErr(t, "TrashExpense twice", err, store.ErrNotFound)
+
+	_, err = s.GetExpense(ctx, "g1", "e1")
+	wantErr(t, "GetExpense of a trashed expense", err, store.ErrNotFound)
+	if totals, err := s.ExpenseTotals(ctx, []string{"g1"}); err != nil || totals["g1"].Count != 0 {
+		t.Errorf("totals with everything trashed = %+v, %v", totals["g1"], err)
+	}
+
+	trash, err := s.ListTrashedExpenses(ctx, "g1")
+	if err != nil {
+		t.Fatalf("ListTrashedExpenses: %v", err)
+	}
+	if len(trash) != 2 || trash[0].Expense.ID != "e2" || trash[1].Expense.ID != "e1" {
+		t.Errorf("trash = %+v, want e2 then e1", trash)
+	}
+
+	// Restoring brings back the attachments, unless the ID was taken since
+	restored, err := s.RestoreExpense(ctx, "g1", "e1")
+	if err != nil {
+		t.Fatalf("RestoreExpense: %v", err)
+	}
+	if restored.Amount != 1000 || len(restored.Attachments) != 1 {
+		t.Errorf("RestoreExpense returned %+v", restored)
+	}
+	_, err = s.RestoreExpense(ctx, "g1", "e1")
+	wantErr(t, "RestoreExpense twice", err, store.ErrNotFound)
+
+	addExpense(t, s, "g1", newExpense("e2", 2500, day))
+	_, err = s.RestoreExpense(ctx, "g1", "e2")
+	wantErr(t, "RestoreExpense over a taken ID", err, store.ErrDuplicate)
+
+	// Trashing the same ID again replaces the copy in the trash
+	if _, err := s.TrashExpense(ctx, "g1", "e2", "u1", day.Add(2*time.Hour)); err != nil {
+		t.Fatalf("TrashExpense: %v", err)
+	}
+	trash, err = s.ListTrashedExpenses(ctx, "g1")
+	if err != nil {
+		t.Fatalf("ListTrashedExpenses: %v", err)
+	}
+	if len(trash) != 1 || trash[0].Expense.Amount != 2500 {
+		t.Errorf("trash after trashing e2 again = %+v, want the 25.00 copy only", trash)
+	}
+
+	// Only expenses deleted before the cutoff expire
+	expired, err := s.ExpiredExpenses(ctx, day.Add(2*time.Hour), 10)
+	if err != nil {
+		t.Fatalf("ExpiredExpenses: %v", err)
+	}
+	if len(expired) != 0 {
+		t.Errorf("expired before the deletion = %+v", expired)
+	}
+	expired, err = s.ExpiredExpenses(ctx, day.Add(3*time.Hour), 10)
+	if err != nil {
+		t.Fatalf("ExpiredExpenses: %v", err)
+	}
+	if len(expired) != 1 || expired[0].GroupID != "g1" || expired[0].Expense.ID != "e2" {
+		t.Errorf("expired = %+v, want g1/e2", expired)
+	}
+
+	wantErr(t, "PurgeExpense before it expired", s.PurgeExpense(ctx, "g1", "e2", day.Add(2*time.Hour)), store.ErrNotFound)
+	if err := s.PurgeExpense(ctx, "g1", "e2", day.Add(3*time.Hour)); err != nil {
+		t.Fatalf("PurgeExpense: %v", err)
+	}
+	if trash, err := s.ListTrashedExpenses(ctx, "g1"); err != nil || len(trash) != 0 {
+		t.Errorf("trash after purging = %+v, %v", trash, err)
+	}
+}
+
+func testTrashedGroups(t *testing.T, s store.Store) {
+	ctx := context.Background()
+	for _, id := range []string{"g1", "g2", "g3"} {
+		createGroup(t, s, newGroup(id, "u1"))
+	}
+	addExpense(t, s, "g1", newExpense("e1", 1000, day))
+
+	if err := s.TrashGroup(ctx, "g1", "u1", day); err != nil {
+		t.Fatalf("TrashGroup: %v", err)
+	}
+	if err := s.TrashGroup(ctx, "g2", "u1", day.Add(time.Hour)); err != nil {
+		t.Fatalf("TrashGroup: %v", err)
+	}
+	wantErr(t, "TrashGroup twice", s.TrashGroup(ctx, "g1", "u1", day), store.ErrNotFound)
+
+	_, err := s.GetGroup(ctx, "g1")
+	wantErr(t, "GetGroup of a trashed group", err, store.ErrNotFound)
+	page, err := s.ListGroups(ctx, "u1", store.GroupQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("ListGroups: %v", err)
+	}
+	if !equalIDs(groupIDs(page.Groups), []string{"g3"}) {
+		t.Errorf("ListGroups with two groups trashed = %v, want [g3]", groupIDs(page.Groups))
+	}
+
+	// The ID stays taken
+	wantErr(t, "CreateGroup over a trashed group", s.CreateGroup(ctx, newGroup("g1", "u2")), store.ErrDuplicate)
+
+	trashed, err := s.GetTrashedGroup(ctx, "g1")
+	if err != nil {
+		t.Fatalf("GetTrashedGroup: %v", err)
+	}
+	if trashed.DeletedAt == nil || !trashed.DeletedAt.Equal(day) || trashed.DeletedBy != "u1" {
+		t.Errorf("GetTrashedGroup returned deleted at %v by %q", trashed.DeletedAt, trashed.DeletedBy)
+	}
+	_, err = s.GetTrashedGroup(ctx, "g3")
+	wantErr(t, "GetTrashedGroup of a live group", err, store.ErrNotFound)
+
+	list, err := s.ListTrashedGroups(ctx, "u1")
+	if err != nil {
+		t.Fatalf("ListTrashedGroups: %v", err)
+	}
+	if !equalIDs(groupIDs(list), []string{"g2", "g1"}) {
+		t.Errorf("ListTrashedGroups = %v, want [g2 g1]", groupIDs(list))
+	}
+	if list, err := s.ListTrashedGroups(ctx, "u2"); err != nil || len(list) != 0 {
+		t.Errorf("ListTrashedGroups for someone else = %v, %v", groupIDs(list), err)
+	}
+
+	// Restoring brings everything back
+	restored, err := s.RestoreGroup(ctx, "g1")
+	if err != nil {
+		t.Fatalf("RestoreGroup: %v", err)
+	}
+	if restored.DeletedAt != nil || restored.DeletedBy != "" {
+		t.Errorf("RestoreGroup returned deleted at %v by %q", restored.DeletedAt, restored.DeletedBy)
+	}
+	_, err = s.RestoreGroup(ctx, "g1")
+	wantErr(t, "RestoreGroup twice", err, store.ErrNotFound)
+	if _, err := s.GetExpense(ctx, "g1", "e1"); err != nil {
+		t.Errorf("GetExpense in a restored group: %v", err)
+	}
+
+	expired, err := s.ExpiredGroups(ctx, day.Add(2*time.Hour), 10)
+	if err != nil {
+		t.Fatalf("ExpiredGroups: %v", err)
+	}
+	if !equalIDs(groupIDs(expired), []string{"g2"}) {
+		t.Errorf("ExpiredGroups = %v, want [g2]", groupIDs(expired))
+	}
+
+	wantErr(t, "PurgeGroup before it expired", s.PurgeGroup(ctx, "g2", day), store.ErrNotFound)
+	wantErr(t, "PurgeGroup of a live group", s.PurgeGroup(ctx, "g1", day.Add(2*time.Hour)), store.ErrNotFound)
+	if err := s.PurgeGroup(ctx, "g2", day.Add(2*time.Hour)); err != nil {
+		t.Fatalf("PurgeGroup: %v", err)
+	}
+	_, err = s.GetTrashedGroup(ctx, "g2")
+	wantErr(t, "GetTrashedGroup after PurgeGroup", err, store.ErrNotFound)
+
+	// Purged IDs can be used again
+	createGroup(t, s, newGroup("g2", "u1"))
+}
@@ -0,0 +1,183 @@
+// Package trash runs the job that permanently deletes groups and expenses
+// once they have been in the trash for longer than the retention period.
+package trash
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"split-it/backend/models"
+	"split-it/backend/store"
+	"time"
+)
+
+const (
+	// DefaultRetention is how long deleted items are kept by default
+	DefaultRetention = 30 * 24 * time.Hour
+	// PurgeInterval is how often the purger looks for expired items
+	PurgeInterval = time.Hour
+	// batchSize is the number of expired items fetched at a time
+	batchSize = 100
+)
+
+// Purger permanently deletes expired items from the trash, along with the
+// attachments of the expenses that go with them.
+//
+// Each item is purged on the condition that it is still expired, so one
+// that was restored, or restored and deleted again, after it was fetched is
+// left alone. Several instances can run at once.
+type Purger struct {
+	groups    store.GroupStore
+	trash     store.TrashStore
+	blobs     store.BlobStore
+	retention time.Duration
+}
+
+// NewPurger returns a purger that deletes items once they have been in the
+// trash for longer than retention
+func NewPurger(groups store.GroupStore, trash store.TrashStore, blobs store.BlobStore, retention time.Duration) *Purger {
+	return &Purger{groups: groups, trash: trash, blobs: blobs, retention: retention}
+}
+
+// Run purges expired items every PurgeInterval until the context is
+// cancelled
+func (p *Purger) Run(ctx context.Context) {
+	for {
+		if _, err := p.Purge(ctx, time.Now()); err != nil && ctx.Err() == nil {
+			log.Printf("⚠️  Purging trash: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(PurgeInterval):
+		}
+	}
+}
+
+// Purge permanently deletes every item that has expired by now and returns
+// the number of groups and expenses deleted. An item that fails is left in
+// the trash and retried on the next call; the others are still purged.
+func (p *Purger) Purge(ctx context.Context, now time.Time) (int, error) {
+	cutoff := now.Add(-p.retention)
+
+	purged, err := p.purgeExpenses(ctx, cutoff)
+	n, groupErr := p.purgeGroups(ctx, cutoff)
+	purged += n
+	if err == nil {
+		err = groupErr
+	}
+	return purged, err
+}
+
+// purgeExpenses deletes the trashed expenses deleted before cutoff
+func (p *Purger) purgeExpenses(ctx context.Context, cutoff time.Time) (int, error) {
+	purged := 0
+	var firstErr error
+
+	for {
+		expired, err := p.trash.ExpiredExpenses(ctx, cutoff, batchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		progress := false
+		for _, t := range expired {
+			err := p.trash.PurgeExpense(ctx, t.GroupID, t.Expense.ID, cutoff)
+			if err == nil {
+				purged++
+				p.deleteAttachments(ctx, t.GroupID, []models.Expense{t.Expense})
+			} else if err != store.ErrNotFound {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("expense %s in group %s: %w", t.Expense.ID, t.GroupID, err)
+				}
+				continue
+			}
+			// Either way it won't be fetched again
+			progress = true
+		}
+
+		// A full batch may have more behind it, unless nothing in it could
+		// be purged, in which case the same batch would come back
+		if len(expired) < batchSize || !progress {
+			return purged, firstErr
+		}
+	}
+}
+
+// purgeGroups deletes the groups in the trash deleted before cutoff
+func (p *Purger) purgeGroups(ctx context.Context, cutoff time.Time) (int, error) {
+	purged := 0
+	var firstErr error
+
+	for {
+		expired, err := p.trash.ExpiredGroups(ctx, cutoff, batchSize)
+		if err != nil {
+			return purged, err
+		}
+
+		progress := false
+		for _, g := range expired {
+			ok, err := p.purgeGroup(ctx, g.GroupID, cutoff)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("group %s: %w", g.GroupID, err)
+				}
+				continue
+			}
+			if ok {
+				purged++
+			}
+			progress = true
+		}
+
+		if len(expired) < batchSize || !progress {
+			return purged, firstErr
+		}
+	}
+}
+
+// purgeGroup deletes a group in the trash and the attachments of its
+// expenses, trashed or not, reporting false if it was restored first
+func (p *Purger) purgeGroup(ctx context.Context, groupID string, cutoff time.Time) (bool, error) {
+	// Read first so their attachments can be deleted along with them
+	expenses, err := p.groups.GroupExpenses(ctx, groupID)
+	if err != nil && err != store.ErrNotFound {
+		return false, err
+	}
+	trashed, err := p.trash.ListTrashedExpenses(ctx, groupID)
+	if err != nil && err != store.ErrNotFound {
+		return false, err
+	}
+	for _, t := range trashed {
+		expenses = append(expenses, t.Expense)
+	}
+
+	err = p.trash.PurgeGroup(ctx, groupID, cutoff)
+	if err == store.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	p.deleteAttachments(ctx, groupID, expenses)
+	return true, nil
+}
+
+// deleteAttachments removes the stored contents of the attachments of
+// expenses that are gone. A blob that can't be removed only takes up space,
+// so failures are logged rather than retried.
+func (p *Purger) deleteAttachments(ctx context.Context, groupID string, expenses []models.Expense) {
+	for _, e := range expenses {
+		for _, a := range e.Attachments {
+			key, err := store.AttachmentKey(groupID, e.ID, a.ID)
+			if err != nil {
+				// It was never stored
+				continue
+			}
+			if err := p.blobs.Delete(ctx, key); err != nil {
+				log.Printf("⚠️  Deleting attachment %s: %v", key, err)
+			}
+		}
+	}
+}
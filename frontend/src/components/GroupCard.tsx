@@ -27,6 +27,8 @@ interface GroupCardProps {
     name: string;
     members: Member[];
     expenses?: Expense[];
+    expenseCount?: number;
+    totalAmount?: number;
   };
   onDelete?: (groupId: string) => void;
 }
@@ -41,8 +43,9 @@ export const GroupCard: FC<GroupCardProps> = ({ group, onDelete }) => {
     }
   };
   
-  const totalExpenses = group.expenses?.reduce((sum, exp) => sum + exp.amount, 0) || 0;
-  const expenseCount = group.expenses?.length || 0;
+  // Group lists carry totals instead of the expenses themselves
+  const totalExpenses = group.totalAmount ?? group.expenses?.reduce((sum, exp) => sum + exp.amount, 0) ?? 0;
+  const expenseCount = group.expenseCount ?? group.expenses?.length ?? 0;
 
   return (
     <Card 
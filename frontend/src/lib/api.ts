@@ -9,6 +9,10 @@ interface Group {
   name: string;
   members: Member[];
   expenses: Expense[];
+  expenseCount?: number;
+  totalAmount?: number;
+  myBalance?: number;
+  lastActivity?: string;
   createdAt: string;
 }
 
@@ -107,7 +111,10 @@ export const api = {
 
   getGroup: async (groupId: string): Promise<Group> => {
     const headers = await getAuthHeader();
-    const res = await axios.get(`${BASE_URL}/api/groups/${groupId}`, { headers });
+    const res = await axios.get(`${BASE_URL}/api/groups/${groupId}`, {
+      headers,
+      params: { include: 'expenses' },
+    });
     return res.data.data || res.data;
   },
 };
@@ -27,6 +27,8 @@ interface Group {
   name: string;
   members: Member[];
   expenses?: any[];
+  expenseCount?: number;
+  totalAmount?: number;
 }
 
 export const Dashboard: FC = () => {
@@ -129,7 +131,7 @@ export const Dashboard: FC = () => {
   );
 
   const totalExpenses = groups.reduce((sum, group) => 
-    sum + (group.expenses?.reduce((s, e) => s + e.amount, 0) || 0), 0
+    sum + (group.totalAmount ?? group.expenses?.reduce((s, e) => s + e.amount, 0) ?? 0), 0
   );
 
   return (